@@ -0,0 +1,314 @@
+package blueskybot
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bluesky-social/indigo/api/atproto"
+	"github.com/flicknow/go-bluesky-bot/pkg/auth"
+	"github.com/flicknow/go-bluesky-bot/pkg/cmd"
+	"github.com/flicknow/go-bluesky-bot/pkg/dbx"
+	"github.com/flicknow/go-bluesky-bot/pkg/identity"
+	"github.com/flicknow/go-bluesky-bot/pkg/labeler"
+	cli "github.com/urfave/cli/v2"
+)
+
+const AdminTokenIssuer = "admin-token"
+
+// service auth tokens for the admin routes have to be minted for the route's
+// own lxm, so a token for one route or any other method can't be replayed
+// against another
+const (
+	AdminLabelsLxm         = "xyz.flicknow.admin.labels"
+	AdminAuditLxm          = "xyz.flicknow.admin.audit"
+	AdminReportsLxm        = "xyz.flicknow.admin.reports"
+	AdminResolveReportsLxm = "xyz.flicknow.admin.resolveReports"
+	AdminFeedCacheLxm      = "xyz.flicknow.admin.feedCache"
+)
+
+type adminIssueLabelsRequest struct {
+	Subjects []string `json:"subjects"`
+	Label    string   `json:"label"`
+	Neg      bool     `json:"neg"`
+}
+
+type adminLabelsResponse struct {
+	Labels []*atproto.LabelDefs_Label `json:"labels"`
+}
+
+type adminAuditResponse struct {
+	Cursor string               `json:"cursor,omitempty"`
+	Audits []*dbx.LabelAuditRow `json:"audits"`
+}
+
+type adminErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// adminAuth accepts either the shared admin token or a service auth token
+// issued for the labeler and the route's lxm by one of the allow-listed dids.
+type adminAuth struct {
+	token    string
+	dids     map[string]bool
+	verifier *auth.Verifier
+}
+
+func newAdminAuth(ctx context.Context, verifier *auth.Verifier) *adminAuth {
+	token, _ := ctx.Value("admin-token").(string)
+
+	dids := make(map[string]bool)
+	for _, did := range cmd.StringSliceValue(ctx, "admin-dids") {
+		dids[did] = true
+	}
+
+	return &adminAuth{
+		token:    token,
+		dids:     dids,
+		verifier: verifier,
+	}
+}
+
+func (a *adminAuth) authenticate(r *http.Request, lxm string) (string, error) {
+	bearer := auth.BearerToken(r)
+	if bearer == "" {
+		return "", ErrUnauthorized
+	}
+
+	if (a.token != "") && (subtle.ConstantTimeCompare([]byte(bearer), []byte(a.token)) == 1) {
+		return AdminTokenIssuer, nil
+	}
+
+	if len(a.dids) == 0 {
+		return "", ErrUnauthorized
+	}
+
+	claims, err := a.verifier.Verify(r.Context(), bearer, LabelerDid, lxm)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrUnauthorized, err)
+	}
+	if !a.dids[claims.Did()] {
+		return "", fmt.Errorf("%w: %s is not an admin", ErrUnauthorized, claims.Did())
+	}
+
+	return claims.Did(), nil
+}
+
+func writeAdminError(w http.ResponseWriter, status int, err error) {
+	b, _ := json.Marshal(&adminErrorResponse{Error: err.Error()})
+	w.Header().Add("content-type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(b)
+}
+
+func adminErrorStatus(err error) int {
+	if errors.Is(err, dbx.ErrUnknownLabelSubject) {
+		return 404
+	} else if errors.Is(err, labeler.ErrUnknownLabel) {
+		return 400
+	}
+	return 500
+}
+
+func (s *Server) adminLabels(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s\n", r.Method, r.URL.String())
+
+	issuer, err := s.admin.authenticate(r, AdminLabelsLxm)
+	if err != nil {
+		log.Printf("admin auth failed: %+v\n", err)
+		Unauthorized(w)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		subject := r.URL.Query().Get("subject")
+		if subject == "" {
+			writeAdminError(w, 400, fmt.Errorf("subject is required"))
+			return
+		}
+
+		labels, err := s.Indexer.Db.SelectActiveLabels(subject)
+		if err != nil {
+			log.Printf("SelectActiveLabels err: %+v\n", err)
+			writeAdminError(w, adminErrorStatus(err), err)
+			return
+		}
+
+		s.writeJson(w, &adminLabelsResponse{Labels: labels})
+	case "POST":
+		req := &adminIssueLabelsRequest{}
+		err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(req)
+		if err != nil {
+			writeAdminError(w, 400, err)
+			return
+		}
+		if (req.Label == "") || (len(req.Subjects) == 0) {
+			writeAdminError(w, 400, fmt.Errorf("label and subjects are required"))
+			return
+		}
+
+		labels, err := s.Indexer.Db.IssueLabels(issuer, req.Subjects, req.Label, req.Neg)
+		if err != nil {
+			log.Printf("IssueLabels err: %+v\n", err)
+			writeAdminError(w, adminErrorStatus(err), err)
+			return
+		}
+
+		log.Printf("%s issued %s (neg=%t) on %s\n", issuer, req.Label, req.Neg, strings.Join(req.Subjects, ", "))
+		s.writeJson(w, &adminLabelsResponse{Labels: labels})
+	default:
+		w.WriteHeader(405)
+	}
+}
+
+func (s *Server) adminAudit(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s\n", r.Method, r.URL.String())
+
+	_, err := s.admin.authenticate(r, AdminAuditLxm)
+	if err != nil {
+		log.Printf("admin auth failed: %+v\n", err)
+		Unauthorized(w)
+		return
+	}
+
+	query := r.URL.Query()
+
+	limit := 50
+	if limitStr := query.Get("limit"); limitStr != "" {
+		l, err := strconv.Atoi(limitStr)
+		if (err != nil) || (l < 1) || (l > 250) {
+			BadRequest(w)
+			return
+		}
+		limit = l
+	}
+
+	before := dbx.SQLiteMaxInt
+	if cursorStr := query.Get("cursor"); cursorStr != "" {
+		c, err := strconv.ParseInt(cursorStr, 10, 64)
+		if err != nil {
+			BadRequest(w)
+			return
+		}
+		before = c
+	}
+
+	var audits []*dbx.LabelAuditRow
+	if subject := query.Get("subject"); subject != "" {
+		audits, err = s.Indexer.Db.LabelAudits.SelectAuditsBySubject(subject, before, limit)
+	} else {
+		audits, err = s.Indexer.Db.LabelAudits.SelectAudits(before, limit)
+	}
+	if err != nil {
+		log.Printf("SelectAudits err: %+v\n", err)
+		ISE(w)
+		return
+	}
+
+	response := &adminAuditResponse{Audits: audits}
+	if len(audits) == limit {
+		response.Cursor = strconv.FormatInt(audits[len(audits)-1].LabelAuditId, 10)
+	}
+
+	s.writeJson(w, response)
+}
+
+type adminClient struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+func newAdminClient(cctx *cli.Context) *adminClient {
+	return &adminClient{
+		url:    strings.TrimSuffix(cctx.String("admin-url"), "/"),
+		token:  cctx.String("admin-token"),
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (c *adminClient) do(method string, path string, body any, response any) error {
+	var reader io.Reader = nil
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequest(method, c.url+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != 200 {
+		errResponse := &adminErrorResponse{}
+		json.NewDecoder(res.Body).Decode(errResponse)
+		if errResponse.Error != "" {
+			return fmt.Errorf("%s %s returned %d: %s", method, path, res.StatusCode, errResponse.Error)
+		}
+		return fmt.Errorf("%s %s returned %d", method, path, res.StatusCode)
+	}
+
+	return json.NewDecoder(res.Body).Decode(response)
+}
+
+func (c *adminClient) IssueLabels(subjects []string, label string, neg bool) ([]*atproto.LabelDefs_Label, error) {
+	response := &adminLabelsResponse{}
+	err := c.do("POST", "/admin/labels", &adminIssueLabelsRequest{Subjects: subjects, Label: label, Neg: neg}, response)
+	if err != nil {
+		return nil, err
+	}
+	return response.Labels, nil
+}
+
+func (c *adminClient) SelectActiveLabels(subject string) ([]*atproto.LabelDefs_Label, error) {
+	response := &adminLabelsResponse{}
+	err := c.do("GET", "/admin/labels?subject="+url.QueryEscape(subject), nil, response)
+	if err != nil {
+		return nil, err
+	}
+	return response.Labels, nil
+}
+
+// resolveLabelSubjects turns handles into dids, leaving dids and at:// uris
+// as they are.
+func resolveLabelSubjects(ctx context.Context, args []string) ([]string, error) {
+	resolver := identity.NewResolver(identity.NewConfig(ctx))
+	subjects := make([]string, 0, len(args))
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "did:") || strings.HasPrefix(arg, "at://") {
+			subjects = append(subjects, arg)
+			continue
+		}
+
+		did, err := resolver.ResolveHandle(ctx, arg)
+		if err != nil {
+			return nil, err
+		}
+		subjects = append(subjects, did)
+	}
+	return subjects, nil
+}
@@ -1,19 +1,19 @@
 package blueskybot
 
 import (
-	"bytes"
-	"time"
+	"fmt"
 
-	"github.com/bluesky-social/indigo/api/atproto"
 	"github.com/flicknow/go-bluesky-bot/pkg/cmd"
-	"github.com/flicknow/go-bluesky-bot/pkg/dbx"
+	"github.com/flicknow/go-bluesky-bot/pkg/utils"
 	cli "github.com/urfave/cli/v2"
 )
 
 var BirthdayCmd = &cli.Command{
-	Name: "birthday",
+	Name:      "birthday",
+	Usage:     "apply or negate the birthday label through the admin api",
+	ArgsUsage: "<handle|did>...",
 	Flags: cmd.CombineFlags(
-		cmd.WithDb,
+		cmd.WithAdminClient,
 		&cli.BoolFlag{
 			Name:  "neg",
 			Usage: "negate a label value",
@@ -21,68 +21,17 @@ var BirthdayCmd = &cli.Command{
 		},
 	),
 	Action: func(cctx *cli.Context) error {
-		d := dbx.NewDBx(cmd.ToContext(cctx))
-		bday, err := d.Labels.FindOrCreateLabel("birthday")
+		subjects, err := resolveLabelSubjects(cmd.ToContext(cctx), cctx.Args().Slice())
 		if err != nil {
 			return err
 		}
 
-		now := time.Now()
-		labels := make([]*dbx.CustomLabel, cctx.Args().Len())
-		for i, user := range cctx.Args().Slice() {
-			did, err := lookupDid(user)
-			if err != nil {
-				return err
-			}
-
-			actor, err := d.Actors.FindOrCreateActor(did)
-			if err != nil {
-				return err
-			}
-
-			neg := cctx.Bool("neg")
-			ver := int64(1)
-			label := &atproto.LabelDefs_Label{
-				Cts: now.UTC().Format(time.RFC3339),
-				Src: LabelerDid,
-				Uri: actor.Did,
-				Val: "birthday",
-				Ver: &ver,
-			}
-			if neg {
-				label.Neg = &neg
-			}
-
-			sigBuf := new(bytes.Buffer)
-			err = label.MarshalCBOR(sigBuf)
-			if err != nil {
-				return err
-			}
-
-			sigBytes, err := d.SigningKey.HashAndSign(sigBuf.Bytes())
-			if err != nil {
-				return err
-			}
-			label.Sig = sigBytes
-
-			cborBuf := new(bytes.Buffer)
-			err = label.MarshalCBOR(cborBuf)
-			if err != nil {
-				return err
-			}
-
-			labels[i] = &dbx.CustomLabel{
-				SubjectType: dbx.AccountLabelType,
-				SubjectId:   actor.ActorId,
-				CreatedAt:   now.Unix(),
-				LabelId:     bday.LabelId,
-				Neg:         0,
-				Cbor:        cborBuf.Bytes(),
-			}
-			if neg {
-				labels[i].Neg = 1
-			}
+		labels, err := newAdminClient(cctx).IssueLabels(subjects, "birthday", cctx.Bool("neg"))
+		if err != nil {
+			return err
 		}
-		return d.CustomLabels.InsertLabels(labels)
+
+		fmt.Println(utils.Dump(labels))
+		return nil
 	},
 }
@@ -7,17 +7,19 @@ import (
 	"log"
 	"net/http"
 	_ "net/http/pprof"
+	"os"
 	"os/signal"
 	"reflect"
 	"syscall"
 	"time"
 
-	"github.com/bluesky-social/indigo/api/atproto"
 	"github.com/flicknow/go-bluesky-bot/pkg/client"
 	"github.com/flicknow/go-bluesky-bot/pkg/cmd"
 	"github.com/flicknow/go-bluesky-bot/pkg/dbx"
 	"github.com/flicknow/go-bluesky-bot/pkg/firehose"
+	"github.com/flicknow/go-bluesky-bot/pkg/health"
 	"github.com/flicknow/go-bluesky-bot/pkg/indexer"
+	"github.com/flicknow/go-bluesky-bot/pkg/metrics"
 	"github.com/flicknow/go-bluesky-bot/pkg/ticker"
 	"github.com/flicknow/go-bluesky-bot/pkg/utils"
 	cli "github.com/urfave/cli/v2"
@@ -49,6 +51,7 @@ var BlueskyBot = &cli.Command{
 		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGQUIT, syscall.SIGTERM)
 		defer stop()
 
+		http.Handle("/metrics", metrics.Handler())
 		go func() {
 			log.Println(http.ListenAndServe(":6060", nil))
 		}()
@@ -66,6 +69,18 @@ var BlueskyBot = &cli.Command{
 		indexer.Start()
 		defer indexer.Stop()
 
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		defer signal.Stop(hup)
+		go func() {
+			for range hup {
+				err := indexer.ReloadRules()
+				if err != nil {
+					log.Printf("error reloading label rules: %+v\n", err)
+				}
+			}
+		}()
+
 		hose := firehose.NewFirehose(cmd.ToContext(cctx))
 		fCh, err := hose.Start(ctx)
 		if err != nil {
@@ -82,6 +97,10 @@ var BlueskyBot = &cli.Command{
 			labeler.Stop()
 		}()
 
+		loop := &health.Heartbeat{}
+		loop.Beat()
+		handleRunHealth(http.DefaultServeMux, health.NewConfig(cmd.ToContext(cctx)), indexer.Db, loop, hose, labeler)
+
 		defer func() {
 			if r := recover(); r != nil {
 				fmt.Printf("caught exception: %#v\n", r)
@@ -117,6 +136,9 @@ var BlueskyBot = &cli.Command{
 		}()
 		defer func() { pinger.Stop() }()
 
+		beat := ticker.NewTicker(5 * time.Second)
+		defer func() { beat.Stop() }()
+
 		var fEvt *firehose.FirehoseEvent
 		var lEvt *firehose.LabelerEvent
 		var post *dbx.PostRow
@@ -127,6 +149,8 @@ var BlueskyBot = &cli.Command{
 			case <-ctx.Done():
 				fmt.Println("Interrupt!")
 				return nil
+			case <-beat.C:
+				loop.Beat()
 			case lEvt = <-lCh:
 				if lEvt == nil {
 					fmt.Println("> END OF LOOP")
@@ -288,14 +312,7 @@ var BlueskyBot = &cli.Command{
 						continue
 					}
 
-					blockRef := &firehose.BlockRef{
-						Subject: client.Did(),
-						Ref: &atproto.RepoStrongRef{
-							Uri: fmt.Sprintf("at://%s/tombstone/tombstone", fEvt.Tombstone),
-						},
-					}
-
-					err = dbx.RetryDbIsLocked(func() error { return indexer.Block(blockRef) })()
+					err = dbx.RetryDbIsLocked(func() error { return indexer.Tombstone(fEvt.Tombstone) })()
 					if err != nil {
 						continue
 					}
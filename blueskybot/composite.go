@@ -0,0 +1,49 @@
+package blueskybot
+
+import (
+	"github.com/flicknow/go-bluesky-bot/pkg/dbx"
+	"github.com/flicknow/go-bluesky-bot/pkg/feeds"
+	"github.com/flicknow/go-bluesky-bot/pkg/indexer"
+)
+
+// compositeLabels gathers the labels of every component, so cached pages of
+// a composite feed are invalidated along with any of its parts.
+func (s *Server) compositeLabels(feed *feeds.Feed) []string {
+	labels := make([]string, 0)
+	for _, c := range feed.Components {
+		component, componentLabels := s.feeds.Resolve(c.Feed)
+		if component == nil {
+			continue
+		}
+		if component.Kind == feeds.KindLabels {
+			componentLabels = expandLabels(componentLabels)
+		}
+		labels = append(labels, componentLabels...)
+	}
+	return labels
+}
+
+// selectCompositePosts fetches a page from each component at its own cursor
+// and interleaves them by weight. Each component is asked for a full page, so
+// the mix still fills up when some of them run dry.
+func (s *Server) selectCompositePosts(indexer *indexer.Indexer, feed *feeds.Feed, did string, cursor feeds.CompositeCursor, limit int) ([]*feeds.CompositeItem, feeds.CompositeCursor, error) {
+	pages := make([][]*dbx.PostRow, len(feed.Components))
+	for i, c := range feed.Components {
+		component, labels := s.feeds.Resolve(c.Feed)
+		if (component == nil) || component.Disabled {
+			continue
+		}
+		if component.Kind == feeds.KindLabels {
+			labels = expandLabels(labels)
+		}
+
+		posts, err := selectFeedPosts(indexer, component, labels, did, cursor[i], limit)
+		if err != nil {
+			return nil, nil, err
+		}
+		pages[i] = posts
+	}
+
+	items, next := feed.Interleave(cursor, pages, limit)
+	return items, next, nil
+}
@@ -0,0 +1,89 @@
+package blueskybot
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/flicknow/go-bluesky-bot/pkg/crypto"
+)
+
+type didWebDocument struct {
+	Context []string `json:"@context"`
+	identity.DIDDocument
+}
+
+// didWebEndpoint is where a did:web is hosted, ie did:web:flicknow.xyz is
+// served from https://flicknow.xyz.
+func didWebEndpoint(did string) (string, error) {
+	if !strings.HasPrefix(did, "did:web:") {
+		return "", fmt.Errorf("%s is not a did:web", did)
+	}
+
+	host, err := url.PathUnescape(did[len("did:web:"):])
+	if err != nil {
+		return "", fmt.Errorf("could not parse host from %s: %w", did, err)
+	}
+	if (host == "") || strings.Contains(host, "/") {
+		return "", fmt.Errorf("%s does not have a usable host", did)
+	}
+
+	return "https://" + host, nil
+}
+
+// newDidWebDocument describes this deployment as a feed generator and, when
+// there's a signing key, as the labeler signing with it.
+func newDidWebDocument(did string, endpoint string, key *crypto.SigningKey) (*didWebDocument, error) {
+	parsed, err := syntax.ParseDID(did)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := &didWebDocument{
+		Context:     []string{"https://www.w3.org/ns/did/v1", "https://w3id.org/security/multikey/v1"},
+		DIDDocument: identity.DIDDocument{DID: parsed},
+	}
+	doc.Service = append(doc.Service, identity.DocService{
+		ID:              "#bsky_fg",
+		Type:            "BskyFeedGenerator",
+		ServiceEndpoint: endpoint,
+	})
+
+	if key == nil {
+		return doc, nil
+	}
+
+	pub, err := key.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+	doc.VerificationMethod = append(doc.VerificationMethod, identity.DocVerificationMethod{
+		ID:                 did + "#atproto_label",
+		Type:               "Multikey",
+		Controller:         did,
+		PublicKeyMultibase: pub.Multibase(),
+	})
+	doc.Service = append(doc.Service, identity.DocService{
+		ID:              "#atproto_labeler",
+		Type:            "AtprotoLabeler",
+		ServiceEndpoint: endpoint,
+	})
+
+	return doc, nil
+}
+
+func (s *Server) wellKnownDid(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s\n", r.Method, r.URL.String())
+
+	if s.didDocument == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Add("cache-control", "public, max-age=300")
+	s.writeJson(w, s.didDocument)
+}
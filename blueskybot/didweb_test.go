@@ -0,0 +1,124 @@
+package blueskybot
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	indigocrypto "github.com/bluesky-social/indigo/atproto/crypto"
+	"github.com/flicknow/go-bluesky-bot/pkg/crypto"
+	"github.com/stretchr/testify/assert"
+)
+
+type servedService struct {
+	Id              string `json:"id"`
+	Type            string `json:"type"`
+	ServiceEndpoint string `json:"serviceEndpoint"`
+}
+
+type servedVerificationMethod struct {
+	Id                 string `json:"id"`
+	Type               string `json:"type"`
+	Controller         string `json:"controller"`
+	PublicKeyMultibase string `json:"publicKeyMultibase"`
+}
+
+type servedDocument struct {
+	Context            []string                    `json:"@context"`
+	Id                 string                      `json:"id"`
+	Service            []*servedService            `json:"service"`
+	VerificationMethod []*servedVerificationMethod `json:"verificationMethod"`
+}
+
+func TestDidWebEndpoint(t *testing.T) {
+	tests := []struct {
+		did      string
+		endpoint string
+		ok       bool
+	}{
+		{did: "did:web:flicknow.xyz", endpoint: "https://flicknow.xyz", ok: true},
+		{did: "did:web:localhost%3A8080", endpoint: "https://localhost:8080", ok: true},
+		{did: "did:plc:jcce2sa3fgue4wiocvf7e7xj"},
+		{did: "did:web:"},
+		{did: "did:web:flicknow.xyz%2Ffeeds"},
+	}
+
+	for _, test := range tests {
+		endpoint, err := didWebEndpoint(test.did)
+		if !test.ok {
+			assert.Error(t, err, test.did)
+			continue
+		}
+		assert.Nil(t, err, test.did)
+		assert.Equal(t, test.endpoint, endpoint, test.did)
+	}
+}
+
+func TestWellKnownDid(t *testing.T) {
+	priv, err := indigocrypto.GeneratePrivateKeyK256()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := crypto.NewSigningKeyFromPrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := key.PublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	did := "did:web:flicknow.xyz"
+	endpoint := "https://flicknow.xyz"
+	feedGenerator := &servedService{Id: "#bsky_fg", Type: "BskyFeedGenerator", ServiceEndpoint: endpoint}
+
+	tests := []struct {
+		name     string
+		key      *crypto.SigningKey
+		services []*servedService
+		methods  []*servedVerificationMethod
+	}{
+		{
+			name:     "feed generator only",
+			services: []*servedService{feedGenerator},
+		},
+		{
+			name: "feed generator and labeler",
+			key:  key,
+			services: []*servedService{
+				feedGenerator,
+				{Id: "#atproto_labeler", Type: "AtprotoLabeler", ServiceEndpoint: endpoint},
+			},
+			methods: []*servedVerificationMethod{
+				{Id: did + "#atproto_label", Type: "Multikey", Controller: did, PublicKeyMultibase: pub.Multibase()},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		doc, err := newDidWebDocument(did, endpoint, test.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		s := &Server{didDocument: doc}
+		w := httptest.NewRecorder()
+		s.wellKnownDid(w, httptest.NewRequest("GET", "/.well-known/did.json", nil))
+		assert.Equal(t, 200, w.Code, test.name)
+		assert.Equal(t, "public, max-age=300", w.Header().Get("cache-control"), test.name)
+
+		served := &servedDocument{}
+		err = json.Unmarshal(w.Body.Bytes(), served)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, did, served.Id, test.name)
+		assert.Contains(t, served.Context, "https://www.w3.org/ns/did/v1", test.name)
+		assert.Equal(t, test.services, served.Service, test.name)
+		assert.Equal(t, test.methods, served.VerificationMethod, test.name)
+	}
+
+	w := httptest.NewRecorder()
+	(&Server{}).wellKnownDid(w, httptest.NewRequest("GET", "/.well-known/did.json", nil))
+	assert.Equal(t, 404, w.Code)
+}
@@ -0,0 +1,88 @@
+package blueskybot
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/flicknow/go-bluesky-bot/pkg/dbx"
+	"github.com/flicknow/go-bluesky-bot/pkg/ticker"
+)
+
+var FeedCachePollInterval = 2 * time.Second
+
+// expandLabels swaps in the regional variants of labels that have them.
+func expandLabels(labels []string) []string {
+	expanded := make([]string, 0, len(labels))
+	for _, label := range labels {
+		if more, ok := ExpandedLabels[label]; ok {
+			expanded = append(expanded, more...)
+		} else {
+			expanded = append(expanded, label)
+		}
+	}
+	return expanded
+}
+
+// watchFeedCache invalidates cached feeds as the indexer labels new posts.
+// The indexer runs in its own process, so this polls post_labels rather
+// than hooking the inserts.
+func (s *Server) watchFeedCache(t *ticker.Ticker) {
+	defer s.removeTicker(t)
+
+	db := s.Indexer.Db
+	cursor, err := db.PostLabels.SelectLastPostLabelId()
+	if err != nil {
+		log.Printf("ERROR starting feed cache watcher: %+v\n", err)
+		return
+	}
+
+	names := make(map[int64]string)
+	for range t.C {
+		var rows []*dbx.PostLabelRow
+		err := dbx.RetryDbIsLocked(func() error {
+			rows, err = db.PostLabels.SelectLabelIdsSince(cursor)
+			return err
+		})()
+		if err != nil {
+			log.Printf("ERROR polling post labels for feed cache: %+v\n", err)
+			continue
+		}
+
+		labels := make([]string, 0, len(rows))
+		for _, row := range rows {
+			if row.PostLabelId > cursor {
+				cursor = row.PostLabelId
+			}
+
+			name, ok := names[row.LabelId]
+			if !ok {
+				label, err := db.Labels.FindLabelByLabelId(row.LabelId)
+				if err != nil {
+					log.Printf("ERROR finding label %d for feed cache: %+v\n", row.LabelId, err)
+					continue
+				} else if label == nil {
+					continue
+				}
+				name = label.Name
+				names[row.LabelId] = name
+			}
+			labels = append(labels, name)
+		}
+
+		s.cache.Invalidate(labels...)
+	}
+}
+
+func (s *Server) adminFeedCache(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s\n", r.Method, r.URL.String())
+
+	_, err := s.admin.authenticate(r, AdminFeedCacheLxm)
+	if err != nil {
+		log.Printf("admin auth failed: %+v\n", err)
+		Unauthorized(w)
+		return
+	}
+
+	s.writeJson(w, s.cache.Stats())
+}
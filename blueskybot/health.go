@@ -0,0 +1,82 @@
+package blueskybot
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/flicknow/go-bluesky-bot/pkg/dbx"
+	"github.com/flicknow/go-bluesky-bot/pkg/firehose"
+	"github.com/flicknow/go-bluesky-bot/pkg/health"
+)
+
+func signingKeyCheck(db *dbx.DBx, disabled func() error) *health.Check {
+	return health.Func("signing-key", func(ctx context.Context) error {
+		if db.SigningKey == nil {
+			return fmt.Errorf("no signing key loaded")
+		}
+		if err := disabled(); err != nil {
+			return err
+		}
+		return nil
+	})
+}
+
+// indexFreshness is the firehose lag as seen by processes that only read
+// the index, judged by the newest post indexed.
+func indexFreshness(db *dbx.DBx) func(ctx context.Context) (time.Time, error) {
+	return func(ctx context.Context) (time.Time, error) {
+		latest, err := db.Posts.SelectLatestCreatedAt(time.Now().Unix())
+		if (err != nil) || (latest == 0) {
+			return time.Time{}, err
+		}
+		return time.Unix(latest, 0), nil
+	}
+}
+
+// handleHealth serves health checks for the feed server. /healthz stays the
+// disk check it has always been, and a labeler key problem shouldn't take
+// feeds out of rotation, so the signing key is only reported on /readyz.
+func (s *Server) handleHealth(mux *http.ServeMux, config *health.Config) {
+	db := s.Indexer.Db
+
+	live := health.Handler(
+		health.Func("http", func(ctx context.Context) error { return nil }),
+	)
+	ready := health.Handler(
+		health.DiskFree(config.DiskPath, config.MinDiskFree),
+		health.Func("db", db.CheckWritable),
+		health.Fresh("firehose", config.MaxFirehoseLag, indexFreshness(db)),
+		health.Optional(signingKeyCheck(db, func() error { return s.labelsDisabled })),
+	)
+	disk := health.Handler(
+		health.DiskFree(config.DiskPath, config.MinDiskFree),
+	)
+
+	mux.HandleFunc("/livez", live)
+	mux.HandleFunc("/readyz", ready)
+	mux.HandleFunc("/healthz", disk)
+}
+
+// handleRunHealth serves health checks for the run process, where liveness
+// means the event loop is still turning over.
+func handleRunHealth(mux *http.ServeMux, config *health.Config, db *dbx.DBx, loop *health.Heartbeat, hose *firehose.Firehose, labeler *firehose.LabelerFirehose) {
+	live := health.Handler(
+		health.Fresh("loop", config.MaxLoopStall, health.Since(loop.Last)),
+	)
+	ready := health.Handler(
+		health.DiskFree(config.DiskPath, config.MinDiskFree),
+		health.Func("db", db.CheckWritable),
+		health.Fresh("firehose", config.MaxFirehoseLag, health.Since(hose.LastEventTime)),
+		health.Fresh("labeler", config.MaxLabelerSilence, health.Since(labeler.LastReceived)),
+		signingKeyCheck(db, func() error { return nil }),
+	)
+	disk := health.Handler(
+		health.DiskFree(config.DiskPath, config.MinDiskFree),
+	)
+
+	mux.HandleFunc("/livez", live)
+	mux.HandleFunc("/readyz", ready)
+	mux.HandleFunc("/healthz", disk)
+}
@@ -47,7 +47,7 @@ var IndexFollowsCmd = &cli.Command{
 
 		d := i.Db
 		for _, handle := range cctx.Args().Slice() {
-			did, err := lookupDid(handle)
+			did, err := i.Identity.Resolve(ctx, handle)
 			if err != nil {
 				return err
 			}
@@ -0,0 +1,67 @@
+package blueskybot
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/bluesky-social/indigo/api/bsky"
+	"github.com/flicknow/go-bluesky-bot/pkg/auth"
+	"github.com/flicknow/go-bluesky-bot/pkg/dbx"
+)
+
+var MaxInteractions = 100
+
+func (s *Server) sendInteractions(w http.ResponseWriter, r *http.Request) {
+	claims, err := s.verifier.Verify(r.Context(), auth.BearerToken(r), s.feeds.Did, "app.bsky.feed.sendInteractions")
+	if err != nil {
+		log.Printf("sendInteractions auth failed: %+v\n", err)
+		writeXrpcError(w, 401, XrpcAuthRequired, err.Error())
+		return
+	}
+	xrpcRequestFrom(r).Viewer = claims.Did()
+	if !s.allowViewer(w, r, claims.Did()) {
+		return
+	}
+
+	input := &bsky.FeedSendInteractions_Input{}
+	err = json.NewDecoder(io.LimitReader(r.Body, 1<<18)).Decode(input)
+	if err != nil {
+		writeXrpcError(w, 400, XrpcInvalidRequest, err.Error())
+		return
+	}
+	if len(input.Interactions) > MaxInteractions {
+		writeXrpcError(w, 400, XrpcInvalidRequest, "too many interactions")
+		return
+	}
+
+	rows := make([]*dbx.InteractionRow, 0, len(input.Interactions))
+	for _, interaction := range input.Interactions {
+		if (interaction == nil) || (interaction.Item == nil) || (interaction.Event == nil) {
+			continue
+		}
+
+		row := &dbx.InteractionRow{Item: *interaction.Item, Event: *interaction.Event}
+		if interaction.FeedContext != nil {
+			row.FeedContext = *interaction.FeedContext
+		}
+		rows = append(rows, row)
+	}
+
+	recorded := 0
+	err = dbx.RetryDbIsLocked(func() error {
+		recorded, err = s.Indexer.Db.RecordInteractions(claims.Did(), rows)
+		return err
+	})()
+	if err != nil {
+		log.Printf("ERROR recording interactions from %s: %+v\n", claims.Did(), err)
+		writeXrpcError(w, 500, XrpcInternalServerError, "could not record interactions")
+		return
+	}
+	if recorded > 0 {
+		log.Printf("recorded %d interactions from %s\n", recorded, claims.Did())
+	}
+
+	s.writeJson(w, &bsky.FeedSendInteractions_Output{})
+}
@@ -0,0 +1,173 @@
+package blueskybot
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/bluesky-social/indigo/api/atproto"
+	indigocrypto "github.com/bluesky-social/indigo/atproto/crypto"
+	"github.com/flicknow/go-bluesky-bot/pkg/crypto"
+	"github.com/flicknow/go-bluesky-bot/pkg/dbx"
+	"github.com/flicknow/go-bluesky-bot/pkg/identity"
+)
+
+var LabelKeyRefreshInterval = 10 * time.Minute
+var LabelKeyRetryInterval = 30 * time.Second
+var LabelKeyLookupTimeout = 5 * time.Second
+
+// labelerKeyLookup finds the #atproto_label key in a did's document. Keys
+// can rotate, so this always goes back to the directory rather than using
+// a cached document.
+func labelerKeyLookup(resolver *identity.Resolver) func(did string) (indigocrypto.PublicKey, error) {
+	return func(did string) (indigocrypto.PublicKey, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), LabelKeyLookupTimeout)
+		defer cancel()
+
+		resolver.Purge(did)
+		doc, err := resolver.ResolveDid(ctx, did)
+		if err != nil {
+			return nil, err
+		}
+
+		method := doc.VerificationMethod("atproto_label")
+		if method == nil {
+			return nil, fmt.Errorf("could not find #atproto_label verification method for %s", did)
+		}
+		return indigocrypto.ParsePublicMultibase(method.PublicKeyMultibase)
+	}
+}
+
+var ErrLabelerKeyMismatch = errors.New("signing key does not match labeler did document")
+
+// checkLabelerKey confirms the configured signing key is the #atproto_label
+// key published in the labeler's DID document.
+func checkLabelerKey(did string, key *crypto.SigningKey, lookup func(did string) (indigocrypto.PublicKey, error)) error {
+	if key == nil {
+		return fmt.Errorf("%w: no signing key configured", ErrLabelerKeyMismatch)
+	}
+
+	published, err := lookup(did)
+	if err != nil {
+		return err
+	}
+
+	if published.DIDKey() != key.KeyId() {
+		return fmt.Errorf("%w: %s publishes %s but the signing key is %s", ErrLabelerKeyMismatch, did, published.DIDKey(), key.KeyId())
+	}
+
+	return nil
+}
+
+// labelKeyVerifier tracks the #atproto_label key currently published in the
+// labeler's DID document, so we only serve labels that consumers can verify.
+// Lookups happen outside the lock: while one is in flight, or for a short
+// while after one fails, callers get the last known key instead of waiting.
+type labelKeyVerifier struct {
+	did        string
+	fallback   *crypto.SigningKey
+	lookup     func(did string) (indigocrypto.PublicKey, error)
+	mu         sync.Mutex
+	key        indigocrypto.PublicKey
+	keyId      string
+	fetchedAt  time.Time
+	failedAt   time.Time
+	refreshing bool
+}
+
+func newLabelKeyVerifier(did string, fallback *crypto.SigningKey, lookup func(did string) (indigocrypto.PublicKey, error)) *labelKeyVerifier {
+	return &labelKeyVerifier{
+		did:      did,
+		fallback: fallback,
+		lookup:   lookup,
+	}
+}
+
+func (v *labelKeyVerifier) current() (indigocrypto.PublicKey, string) {
+	v.mu.Lock()
+	if (v.key != nil) && (time.Since(v.fetchedAt) < LabelKeyRefreshInterval) {
+		defer v.mu.Unlock()
+		return v.key, v.keyId
+	}
+	if v.refreshing || (time.Since(v.failedAt) < LabelKeyRetryInterval) {
+		defer v.mu.Unlock()
+		return v.lastKnown(false)
+	}
+	v.refreshing = true
+	v.mu.Unlock()
+
+	key, err := v.lookup(v.did)
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.refreshing = false
+
+	if err == nil {
+		if (v.key != nil) && (key.DIDKey() != v.keyId) {
+			log.Printf("labeler key for %s changed from %s to %s\n", v.did, v.keyId, key.DIDKey())
+		}
+		v.key = key
+		v.keyId = key.DIDKey()
+		v.fetchedAt = time.Now()
+		return v.key, v.keyId
+	}
+
+	log.Printf("WARNING could not lookup labeler key for %s: %+v\n", v.did, err)
+	v.failedAt = time.Now()
+	return v.lastKnown(true)
+}
+
+// lastKnown returns the last key we looked up, or the local signing key if
+// no lookup has succeeded yet. Callers must hold the lock.
+func (v *labelKeyVerifier) lastKnown(warn bool) (indigocrypto.PublicKey, string) {
+	if v.key != nil {
+		return v.key, v.keyId
+	}
+
+	if v.fallback == nil {
+		return nil, ""
+	}
+
+	fallback, err := v.fallback.PublicKey()
+	if err != nil {
+		return nil, ""
+	}
+	if warn {
+		log.Printf("WARNING falling back to local signing key %s for %s until its did document can be resolved\n", v.fallback.KeyId(), v.did)
+	}
+	return fallback, v.fallback.KeyId()
+}
+
+func (v *labelKeyVerifier) Filter(labels []*dbx.CustomLabel) []*dbx.CustomLabel {
+	key, keyId := v.current()
+	if key == nil {
+		return []*dbx.CustomLabel{}
+	}
+
+	filtered := make([]*dbx.CustomLabel, 0, len(labels))
+	for _, label := range labels {
+		if label.KeyId == keyId {
+			filtered = append(filtered, label)
+			continue
+		}
+		if label.KeyId != "" {
+			continue
+		}
+
+		// labels written before key ids were tracked have to be checked by hand
+		decoded := &atproto.LabelDefs_Label{}
+		err := decoded.UnmarshalCBOR(bytes.NewReader(label.Cbor))
+		if err != nil {
+			continue
+		}
+		if crypto.VerifyLabel(key, decoded) == nil {
+			filtered = append(filtered, label)
+		}
+	}
+
+	return filtered
+}
@@ -4,31 +4,35 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/flicknow/go-bluesky-bot/pkg/cmd"
+	"github.com/flicknow/go-bluesky-bot/pkg/identity"
 	cli "github.com/urfave/cli/v2"
 )
 
 var LookupCmd = &cli.Command{
 	Name:  "lookup",
-	Flags: []cli.Flag{},
+	Flags: cmd.WithIdentity,
 	Action: func(cctx *cli.Context) error {
+		resolver := identity.NewResolver(identity.NewConfig(cmd.ToContext(cctx)))
 		for _, uri := range cctx.Args().Slice() {
 			parts := strings.SplitN(uri[5:], "/", 3)
 
-			did, err := lookupDid(parts[0])
+			did, err := resolver.Resolve(cctx.Context, parts[0])
 			if err != nil {
 				return err
 			}
 
-			record, err := lookupPlcDirectoryRecord(did)
+			doc, err := resolver.ResolveDid(cctx.Context, did)
 			if err != nil {
 				return err
 			}
 
-			if (record.AlsoKnownAs == nil) || (len(record.AlsoKnownAs) == 0) {
-				return fmt.Errorf("could not find handle from record %+v", record)
+			handle := doc.Handle()
+			if handle == "" {
+				return fmt.Errorf("could not find handle in did document for %s", did)
 			}
 
-			fmt.Printf("https://bsky.app/profile/%s/post/%s\n", record.AlsoKnownAs[0][5:], parts[2])
+			fmt.Printf("https://bsky.app/profile/%s/post/%s\n", handle, parts[2])
 		}
 
 		return nil
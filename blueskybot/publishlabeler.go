@@ -0,0 +1,61 @@
+package blueskybot
+
+import (
+	"fmt"
+	"log"
+
+	lexutil "github.com/bluesky-social/indigo/lex/util"
+	"github.com/flicknow/go-bluesky-bot/pkg/client"
+	"github.com/flicknow/go-bluesky-bot/pkg/clock"
+	"github.com/flicknow/go-bluesky-bot/pkg/cmd"
+	"github.com/flicknow/go-bluesky-bot/pkg/labeler"
+	"github.com/flicknow/go-bluesky-bot/pkg/utils"
+	cli "github.com/urfave/cli/v2"
+)
+
+var PublishLabelerCmd = &cli.Command{
+	Name:  "publish-labeler",
+	Usage: "publish the app.bsky.labeler.service record built from the label definitions",
+	Flags: cmd.CombineFlags(
+		cmd.WithClient,
+		cmd.WithLabeler,
+	),
+	Action: func(cctx *cli.Context) error {
+		path := cctx.String("label-definitions")
+		if path == "" {
+			return fmt.Errorf("label-definitions argument is required")
+		}
+
+		defs, err := labeler.LoadDefinitions(path)
+		if err != nil {
+			return err
+		}
+
+		service := defs.LabelerService(clock.NewClock().NowString())
+		dryrun := cctx.Bool("dry-run")
+		if dryrun {
+			fmt.Println(utils.Dump(service))
+		}
+
+		client, err := client.NewClient(cctx)
+		if err != nil {
+			return err
+		}
+		if client.Did() != LabelerDid {
+			log.Printf("WARNING publishing labeler service as %s but labeler did is %s\n", client.Did(), LabelerDid)
+		}
+
+		if dryrun {
+			fmt.Printf("> would publish %d label definitions to at://%s/app.bsky.labeler.service/self\n", len(defs.Labels), client.Did())
+			return nil
+		}
+
+		output, err := client.PutRecord("app.bsky.labeler.service", "self", &lexutil.LexiconTypeDecoder{Val: service})
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("> published %d label definitions to %s\n", len(defs.Labels), output.Uri)
+		return nil
+	},
+}
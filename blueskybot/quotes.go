@@ -0,0 +1,473 @@
+package blueskybot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/flicknow/go-bluesky-bot/pkg/dbx"
+	"github.com/flicknow/go-bluesky-bot/pkg/identity"
+	"github.com/flicknow/go-bluesky-bot/pkg/utils"
+)
+
+var QuotesDefaultLimit = 25
+var QuotesMaxLimit = 100
+var QuotesExpandLimit = 10
+
+var atPostUriRegex = regexp.MustCompile(`^at://([^/]+)/app\.bsky\.feed\.post/([a-zA-Z0-9._~:-]{1,512})$`)
+var bskyPostUrlRegex = regexp.MustCompile(`^(?:https?://)?(?:www\.)?bsky\.app/profile/([^/]+)/post/([a-zA-Z0-9._~:-]{1,512})/?$`)
+
+var quotesTemplate = template.Must(template.New("quotes.html").Parse(QuotesHtmlTemplateText))
+
+type quoteView struct {
+	Uri        string       `json:"uri"`
+	Url        string       `json:"url"`
+	CreatedAt  string       `json:"createdAt"`
+	QuoteCount int64        `json:"quoteCount"`
+	Quotes     []*quoteView `json:"quotes,omitempty"`
+	Cursor     string       `json:"cursor,omitempty"`
+}
+
+type quotesResponse struct {
+	Uri        string       `json:"uri"`
+	Url        string       `json:"url"`
+	QuoteCount int64        `json:"quoteCount"`
+	Cursor     string       `json:"cursor,omitempty"`
+	Quotes     []*quoteView `json:"quotes"`
+}
+
+func bskyPostUrl(uri string) string {
+	return fmt.Sprintf("https://bsky.app/profile/%s/post/%s", utils.ParseDid(uri), utils.ParseRkey(uri))
+}
+
+func newQuoteView(post *dbx.PostRow) *quoteView {
+	return &quoteView{
+		Uri:        post.Uri,
+		Url:        bskyPostUrl(post.Uri),
+		CreatedAt:  time.Unix(post.CreatedAt, 0).UTC().Format(time.RFC3339),
+		QuoteCount: post.Quotes,
+	}
+}
+
+// parseQuoteTarget turns an at:// uri or a bsky.app post url, by handle or
+// did, into the post's at:// uri.
+func parseQuoteTarget(ctx context.Context, resolver *identity.Resolver, target string) (string, error) {
+	target = strings.TrimSpace(target)
+
+	// the mux cleans the double slash out of urls passed in the path
+	for _, scheme := range []string{"at:/", "https:/", "http:/"} {
+		if strings.HasPrefix(target, scheme) && !strings.HasPrefix(target, scheme+"/") {
+			target = scheme + "/" + target[len(scheme):]
+		}
+	}
+
+	match := atPostUriRegex.FindStringSubmatch(target)
+	if match == nil {
+		match = bskyPostUrlRegex.FindStringSubmatch(target)
+	}
+	if match == nil {
+		return "", errInvalidRequest("%s does not look like a bsky.app post url or at:// uri", target)
+	}
+
+	did, err := resolver.Resolve(ctx, match[1])
+	if err != nil {
+		log.Printf("%+v\n", err)
+		return "", errInvalidRequest("could not resolve %s", match[1])
+	}
+
+	return fmt.Sprintf("at://%s/app.bsky.feed.post/%s", did, match[2]), nil
+}
+
+// lookupQuotes pages through the quotes of a post, optionally with the
+// first few quotes of each quote.
+func (s *Server) lookupQuotes(uri string, before int64, limit int, expand bool) (*quotesResponse, error) {
+	var subject *dbx.PostRow
+	var quotes []*dbx.PostRow
+	var nested map[int64][]*dbx.PostRow
+	err := dbx.RetryDbIsLocked(func() error {
+		err := s.acquireDb()
+		if err != nil {
+			return err
+		}
+		defer s.sem.Release(1)
+
+		db := s.Indexer.Db
+		subject, quotes, err = db.SelectQuotesForUri(uri, before, limit)
+		if (err != nil) || (subject == nil) {
+			return err
+		}
+
+		counted := append([]*dbx.PostRow{subject}, quotes...)
+		nested = make(map[int64][]*dbx.PostRow)
+		if expand {
+			for _, quote := range quotes {
+				children, err := db.SelectQuotesForPost(quote, 0, QuotesExpandLimit)
+				if err != nil {
+					return err
+				}
+				if len(children) != 0 {
+					nested[quote.PostId] = children
+					counted = append(counted, children...)
+				}
+			}
+		}
+
+		return db.CountQuotes(counted...)
+	})()
+	if err != nil {
+		return nil, err
+	}
+	if subject == nil {
+		return nil, &xrpcError{Status: 404, Name: "NotFound", Message: fmt.Sprintf("%s has not been indexed", uri)}
+	}
+
+	response := &quotesResponse{
+		Uri:        subject.Uri,
+		Url:        bskyPostUrl(subject.Uri),
+		QuoteCount: subject.Quotes,
+		Quotes:     make([]*quoteView, 0, len(quotes)),
+	}
+	for _, quote := range quotes {
+		view := newQuoteView(quote)
+		if children := nested[quote.PostId]; len(children) != 0 {
+			view.Quotes = make([]*quoteView, 0, len(children))
+			for _, child := range children {
+				view.Quotes = append(view.Quotes, newQuoteView(child))
+			}
+			if int64(len(children)) < quote.Quotes {
+				view.Cursor = strconv.FormatInt(children[len(children)-1].PostId, 10)
+			}
+		}
+		response.Quotes = append(response.Quotes, view)
+	}
+	if len(quotes) == limit {
+		response.Cursor = strconv.FormatInt(quotes[len(quotes)-1].PostId, 10)
+	}
+
+	return response, nil
+}
+
+func wantsJson(r *http.Request) bool {
+	if format := r.URL.Query().Get("format"); format != "" {
+		return format == "json"
+	}
+	return strings.Contains(r.Header.Get("accept"), "application/json")
+}
+
+// quotes serves /quotes/, taking the post either from the path, as the form
+// submits it, or from the uri parameter. It answers with html unless asked
+// for json.
+func (s *Server) quotes(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s\n", r.Method, r.URL.String())
+
+	query := r.URL.Query()
+	target := query.Get("uri")
+	if target == "" {
+		target = strings.TrimPrefix(r.URL.Path, "/quotes/")
+	}
+
+	if wantsJson(r) {
+		writeCorsHeaders(w, r)
+
+		response, err := s.queryQuotes(r, target)
+		if errors.Is(err, ErrServerBusy) {
+			ServiceUnavailable(w, s.queueTimeout)
+			return
+		} else if err != nil {
+			writeXrpcErr(w, err)
+			return
+		}
+
+		w.Header().Add("cache-control", "public, max-age=30")
+		s.writeJson(w, response)
+		return
+	}
+
+	if target == "" {
+		writeQuotesHtml(w, 200, 600, &QuotesHtmlParams{Form: true})
+		return
+	}
+
+	response, err := s.queryQuotes(r, target)
+	if err != nil {
+		status := 500
+		message := "internal error"
+
+		var xerr *xrpcError
+		if errors.As(err, &xerr) {
+			status = xerr.Status
+			message = xerr.Message
+		} else if errors.Is(err, ErrServerBusy) {
+			status = 503
+			message = "server busy, try again later"
+		} else {
+			log.Printf("%+v\n", err)
+		}
+
+		writeQuotesHtml(w, status, 30, &QuotesHtmlParams{Url: target, Error: message})
+		return
+	}
+
+	expanded := query.Get("expand") == "true"
+	params := &QuotesHtmlParams{
+		Count:    response.QuoteCount,
+		Posts:    response.Quotes,
+		Url:      response.Url,
+		Expanded: expanded,
+	}
+
+	if response.Cursor != "" {
+		next := r.URL.Query()
+		next.Set("cursor", response.Cursor)
+		params.Next = fmt.Sprintf("%s?%s", r.URL.Path, next.Encode())
+	}
+
+	toggle := r.URL.Query()
+	toggle.Set("expand", strconv.FormatBool(!expanded))
+	params.ExpandLink = fmt.Sprintf("%s?%s", r.URL.Path, toggle.Encode())
+
+	writeQuotesHtml(w, 200, 30, params)
+}
+
+func (s *Server) queryQuotes(r *http.Request, target string) (*quotesResponse, error) {
+	query := r.URL.Query()
+
+	limit, err := parseXrpcLimit(query, QuotesDefaultLimit, QuotesMaxLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	var before int64 = 0
+	if cursor := query.Get("cursor"); cursor != "" {
+		before, err = strconv.ParseInt(cursor, 10, 64)
+		if (err != nil) || (before <= 0) {
+			return nil, errInvalidRequest("malformed cursor")
+		}
+	}
+
+	if target == "" {
+		return nil, errInvalidRequest("uri is required")
+	}
+
+	uri, err := parseQuoteTarget(r.Context(), s.Indexer.Identity, target)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.lookupQuotes(uri, before, limit, query.Get("expand") == "true")
+}
+
+func writeQuotesHtml(w http.ResponseWriter, status int, maxAge int, params *QuotesHtmlParams) {
+	w.Header().Add("cache-control", fmt.Sprintf("public, max-age=%d", maxAge))
+	w.Header().Add("content-type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+
+	err := quotesTemplate.Execute(w, params)
+	if err != nil {
+		log.Printf("error processing quotes html template: %s\n", err)
+	}
+}
+
+type QuotesHtmlParams struct {
+	Error      string
+	Form       bool
+	Count      int64
+	Posts      []*quoteView
+	Url        string
+	Next       string
+	ExpandLink string
+	Expanded   bool
+}
+
+var QuotesHtmlTemplateText = `
+<!doctype html>
+<html lang="en">
+	<head>
+		<meta charset="utf-8" />
+		<meta name="viewport" content="width=device-width, initial-scale=1.0" />
+		<title>Bluesky quotes</title>
+		<style>
+			:root {
+				--background-primary: #fafafa;
+				--background-secondary: #e5e5e5;
+				--text-primary: #000000;
+				--text-link: #1d4ed8;
+				--divider: #c8c8c8;
+			}
+
+			@media (prefers-color-scheme: dark) {
+				:root {
+					--background-primary: #0a0a0a;
+					--background-secondary: #171717;
+					--text-primary: #ffffff;
+					--text-link: #60a5fa;
+					--divider: #404040;
+				}
+			}
+
+			html {
+				background: var(--background-primary);
+				color: var(--text-primary);
+				color-scheme: light dark;
+				font-size: 14px;
+				line-height: 1.25rem;
+				font-family:
+					system-ui,
+					-apple-system,
+					BlinkMacSystemFont,
+					'Segoe UI',
+					Roboto,
+					Oxygen,
+					Ubuntu,
+					Cantarell,
+					'Open Sans',
+					'Helvetica Neue',
+					sans-serif;
+			}
+
+			body {
+				margin: 24px auto;
+				padding: 0 16px;
+				max-width: 680px;
+			}
+
+			h1,
+			h2,
+			h3,
+			h4,
+			h5,
+			h6,
+			p {
+				margin-block-start: 1.1rem;
+				margin-block-end: 1.1rem;
+			}
+
+			h1 {
+				font-size: 1.25rem;
+			}
+			h2 {
+				font-size: 1.125rem;
+			}
+
+			a {
+				color: var(--text-link);
+			}
+
+			pre {
+				border-radius: 4px;
+				background: var(--background-secondary);
+				padding: 8px;
+				overflow-x: auto;
+				font-size: 12px;
+			}
+
+			bluesky-post {
+				--font-size: 16px;
+				margin: 16px auto;
+			}
+
+			.bluesky-post-fallback {
+				margin: 16px 0;
+				border-left: 3px solid var(--divider);
+				padding: 4px 8px;
+			}
+			.bluesky-post-fallback p {
+				margin: 0 0 8px 0;
+			}
+
+			.quote-count {
+				margin: -8px 0 16px 0;
+			}
+
+			.quotes {
+				margin-left: 16px;
+				border-left: 3px solid var(--divider);
+				padding-left: 8px;
+			}
+		</style>
+		<script type="module" src="https://esm.sh/bluesky-post-embed@~0.1.0"></script>
+		<script type="module">
+			const dark = matchMedia('(prefers-color-scheme: dark)');
+
+			const update_theme = () => {
+				const is_dark = dark.matches;
+
+				for (const node of document.querySelectorAll('bluesky-post')) {
+					node.setAttribute('theme', !is_dark ? 'light' : 'dark');
+				}
+			};
+
+			update_theme();
+			dark.addEventListener('change', update_theme);
+		</script>
+	</head>
+	<body>
+		{{ if .Form }}
+		<form method="post" id="quotes">
+			<label for="url">Bluesky Post URL:</label>
+			<input type="text" id="url" name="url">
+			<button type="submit">Lookup Quotes!</button>
+		</form>
+		<script>
+			const formElement = document.forms['quotes'];
+
+			function lookupQuotes (e) {
+				e.preventDefault();
+
+				const data = new FormData(e.target);
+				const url = data.get("url");
+
+				formElement.action = document.location.href + url
+				formElement.removeEventListener('submit', lookupQuotes);
+				formElement.submit();
+			}
+
+			formElement.addEventListener('submit', lookupQuotes);
+		</script>
+		{{ else }}
+		{{ if .Url }}
+		<h1>Quote Posts for {{.Url}}</h1>
+		{{ end }}
+		{{ if .Error }}
+		<div>
+			Error looking up quotes:
+			<pre>{{ .Error }}</pre>
+		</div>
+		{{ else }}
+		<p>
+			{{ .Count }} quotes indexed
+			&middot;
+			<a href="{{ .ExpandLink }}">{{ if .Expanded }}hide quotes of quotes{{ else }}show quotes of quotes{{ end }}</a>
+		</p>
+		{{ end }}
+		{{ if .Posts }}
+		{{ range .Posts }}
+		<bluesky-post src="{{ .Url }}"></bluesky-post>
+		{{ if .QuoteCount }}
+		<div class="quote-count"><a href="/quotes/?uri={{ .Uri }}">see quotes ({{ .QuoteCount }})</a></div>
+		{{ end }}
+		{{ if .Quotes }}
+		<div class="quotes">
+			{{ range .Quotes }}
+			<bluesky-post src="{{ .Url }}"></bluesky-post>
+			{{ end }}
+		</div>
+		{{ end }}
+		{{ end }}
+		{{ if .Next }}
+		<p><a href="{{ .Next }}">Older quotes</a></p>
+		{{ end }}
+		{{ else if not .Error }}
+		<div>No quotes found yet</div>
+		{{ end }}
+		{{ end }}
+	</body>
+</html>
+`
@@ -0,0 +1,132 @@
+package blueskybot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/flicknow/go-bluesky-bot/pkg/ratelimit"
+)
+
+var ErrServerBusy = fmt.Errorf("ERROR: SERVER BUSY")
+
+func TooManyRequests(w http.ResponseWriter, r *http.Request, delay time.Duration) {
+	w.Header().Add("retry-after", ratelimit.RetryAfter(delay))
+	if strings.HasPrefix(r.URL.Path, "/xrpc/") {
+		writeXrpcError(w, 429, XrpcRateLimitExceeded, "too many requests")
+		return
+	}
+	w.WriteHeader(429)
+}
+
+func ServiceUnavailable(w http.ResponseWriter, retryAfter time.Duration) {
+	w.Header().Add("retry-after", ratelimit.RetryAfter(retryAfter))
+	writeXrpcError(w, 503, XrpcServiceUnavailable, "server busy, try again later")
+}
+
+// clientIp is the address the request came from. Behind a proxy that is the
+// proxy itself, so when trusted the last hop it appended to X-Forwarded-For
+// is used instead.
+func clientIp(r *http.Request, trustForwardedFor bool) string {
+	if trustForwardedFor {
+		forwarded := r.Header.Values("x-forwarded-for")
+		if len(forwarded) > 0 {
+			hops := strings.Split(forwarded[len(forwarded)-1], ",")
+			if ip := strings.TrimSpace(hops[len(hops)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func (s *Server) rateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.limiter == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ip := clientIp(r, s.limiter.Config.TrustForwardedFor)
+		route := s.limiter.Route(r.URL.Path)
+		if ok, delay := s.limiter.AllowIp(route, ip); !ok {
+			log.Printf("rate limited %s %s from %s\n", r.Method, r.URL.String(), ip)
+			TooManyRequests(w, r, delay)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// allowViewer applies the route's per did budget once the viewer has been
+// verified, writing a 429 and returning false when it is spent.
+func (s *Server) allowViewer(w http.ResponseWriter, r *http.Request, did string) bool {
+	if s.limiter == nil {
+		return true
+	}
+
+	ok, delay := s.limiter.AllowDid(s.limiter.Route(r.URL.Path), did)
+	if !ok {
+		log.Printf("rate limited %s %s for %s\n", r.Method, r.URL.String(), did)
+		TooManyRequests(w, r, delay)
+	}
+	return ok
+}
+
+// acquireDb takes a db connection, waiting behind at most maxQueue other
+// requests for up to queueTimeout before giving up with ErrServerBusy.
+func (s *Server) acquireDb() error {
+	if s.sem.TryAcquire(1) {
+		return nil
+	}
+
+	if s.queued.Add(1) > s.maxQueue {
+		s.queued.Add(-1)
+		return ErrServerBusy
+	}
+	defer s.queued.Add(-1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.queueTimeout)
+	defer cancel()
+
+	err := s.sem.Acquire(ctx, 1)
+	if err != nil {
+		return ErrServerBusy
+	}
+	return nil
+}
+
+// loadRateLimiter reads the rate limits file, falling back to the built in
+// limits. Setting it to "off" disables rate limiting. --trust-forwarded-for
+// turns on TrustForwardedFor whatever the file says.
+func loadRateLimiter(ctx context.Context) (*ratelimit.Limiter, error) {
+	path, _ := ctx.Value("rate-limits").(string)
+	if path == "off" {
+		return nil, nil
+	}
+
+	config := ratelimit.DefaultConfig()
+	if path != "" {
+		var err error
+		config, err = ratelimit.LoadConfig(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if trust, _ := ctx.Value("trust-forwarded-for").(bool); trust {
+		config.TrustForwardedFor = true
+	}
+
+	return ratelimit.NewLimiter(config)
+}
@@ -0,0 +1,288 @@
+package blueskybot
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bluesky-social/indigo/api/atproto"
+	"github.com/flicknow/go-bluesky-bot/pkg/auth"
+	"github.com/flicknow/go-bluesky-bot/pkg/cmd"
+	"github.com/flicknow/go-bluesky-bot/pkg/dbx"
+	"github.com/flicknow/go-bluesky-bot/pkg/utils"
+	cli "github.com/urfave/cli/v2"
+)
+
+var MaxReportReasonLength = 2000
+
+func (s *Server) createReport(w http.ResponseWriter, r *http.Request) {
+	claims, err := s.verifier.Verify(r.Context(), auth.BearerToken(r), LabelerDid, "com.atproto.moderation.createReport")
+	if err != nil {
+		log.Printf("createReport auth failed: %+v\n", err)
+		writeXrpcError(w, 401, XrpcAuthRequired, err.Error())
+		return
+	}
+	xrpcRequestFrom(r).Viewer = claims.Did()
+
+	input := &atproto.ModerationCreateReport_Input{}
+	err = json.NewDecoder(io.LimitReader(r.Body, 1<<16)).Decode(input)
+	if err != nil {
+		writeXrpcError(w, 400, XrpcInvalidRequest, err.Error())
+		return
+	}
+	if (input.ReasonType == nil) || (*input.ReasonType == "") {
+		writeXrpcError(w, 400, XrpcInvalidRequest, "reasonType is required")
+		return
+	}
+
+	row := &dbx.ReportRow{
+		Reporter:   claims.Did(),
+		ReasonType: *input.ReasonType,
+	}
+	if input.Reason != nil {
+		row.Reason = *input.Reason
+		if len(row.Reason) > MaxReportReasonLength {
+			writeXrpcError(w, 400, XrpcInvalidRequest, "reason is too long")
+			return
+		}
+	}
+
+	output := &atproto.ModerationCreateReport_Output{
+		Reason:     input.Reason,
+		ReasonType: input.ReasonType,
+		ReportedBy: row.Reporter,
+	}
+	switch {
+	case (input.Subject != nil) && (input.Subject.AdminDefs_RepoRef != nil) && strings.HasPrefix(input.Subject.AdminDefs_RepoRef.Did, "did:"):
+		row.Subject = input.Subject.AdminDefs_RepoRef.Did
+		output.Subject = &atproto.ModerationCreateReport_Output_Subject{AdminDefs_RepoRef: input.Subject.AdminDefs_RepoRef}
+	case (input.Subject != nil) && (input.Subject.RepoStrongRef != nil) && strings.HasPrefix(input.Subject.RepoStrongRef.Uri, "at://"):
+		row.Subject = input.Subject.RepoStrongRef.Uri
+		row.SubjectCid = input.Subject.RepoStrongRef.Cid
+		output.Subject = &atproto.ModerationCreateReport_Output_Subject{RepoStrongRef: input.Subject.RepoStrongRef}
+	default:
+		writeXrpcError(w, 400, XrpcInvalidRequest, "subject must be a repoRef or strongRef")
+		return
+	}
+
+	report, created, err := s.Indexer.Db.InsertReport(row)
+	if err != nil {
+		log.Printf("InsertReport err: %+v\n", err)
+		writeXrpcError(w, 500, XrpcInternalServerError, "could not record report")
+		return
+	}
+	if created {
+		log.Printf("%s reported %s for %s\n", report.Reporter, report.Subject, report.ReasonType)
+	}
+
+	output.Id = report.ReportId
+	output.CreatedAt = time.Unix(report.CreatedAt, 0).UTC().Format(time.RFC3339)
+	s.writeJson(w, output)
+}
+
+type adminReportsResponse struct {
+	Cursor  string           `json:"cursor,omitempty"`
+	Reports []*dbx.ReportRow `json:"reports"`
+}
+
+type adminResolveReportsRequest struct {
+	Ids   []int64 `json:"ids"`
+	Label string  `json:"label,omitempty"`
+	Neg   bool    `json:"neg,omitempty"`
+}
+
+func (s *Server) adminReports(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s\n", r.Method, r.URL.String())
+
+	_, err := s.admin.authenticate(r, AdminReportsLxm)
+	if err != nil {
+		log.Printf("admin auth failed: %+v\n", err)
+		Unauthorized(w)
+		return
+	}
+
+	query := r.URL.Query()
+
+	status := query.Get("status")
+	if status == "" {
+		status = dbx.ReportStatusOpen
+	}
+
+	limit := 50
+	if limitStr := query.Get("limit"); limitStr != "" {
+		l, err := strconv.Atoi(limitStr)
+		if (err != nil) || (l < 1) || (l > 250) {
+			BadRequest(w)
+			return
+		}
+		limit = l
+	}
+
+	before := dbx.SQLiteMaxInt
+	if cursorStr := query.Get("cursor"); cursorStr != "" {
+		c, err := strconv.ParseInt(cursorStr, 10, 64)
+		if err != nil {
+			BadRequest(w)
+			return
+		}
+		before = c
+	}
+
+	reports, err := s.Indexer.Db.Reports.SelectReports(status, before, limit)
+	if err != nil {
+		log.Printf("SelectReports err: %+v\n", err)
+		ISE(w)
+		return
+	}
+
+	response := &adminReportsResponse{Reports: reports}
+	if len(reports) == limit {
+		response.Cursor = strconv.FormatInt(reports[len(reports)-1].ReportId, 10)
+	}
+
+	s.writeJson(w, response)
+}
+
+func (s *Server) adminResolveReports(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s\n", r.Method, r.URL.String())
+
+	issuer, err := s.admin.authenticate(r, AdminResolveReportsLxm)
+	if err != nil {
+		log.Printf("admin auth failed: %+v\n", err)
+		Unauthorized(w)
+		return
+	}
+
+	if r.Method != "POST" {
+		w.WriteHeader(405)
+		return
+	}
+
+	req := &adminResolveReportsRequest{}
+	err = json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(req)
+	if err != nil {
+		writeAdminError(w, 400, err)
+		return
+	}
+	if len(req.Ids) == 0 {
+		writeAdminError(w, 400, fmt.Errorf("ids are required"))
+		return
+	}
+
+	reports, err := s.Indexer.Db.ResolveReports(issuer, req.Ids, req.Label, req.Neg)
+	if err != nil {
+		log.Printf("ResolveReports err: %+v\n", err)
+		writeAdminError(w, adminErrorStatus(err), err)
+		return
+	}
+
+	s.writeJson(w, &adminReportsResponse{Reports: reports})
+}
+
+func (c *adminClient) SelectReports(status string, cursor string, limit int) (*adminReportsResponse, error) {
+	response := &adminReportsResponse{}
+	query := url.Values{}
+	query.Set("status", status)
+	query.Set("cursor", cursor)
+	query.Set("limit", strconv.Itoa(limit))
+
+	err := c.do("GET", "/admin/reports?"+query.Encode(), nil, response)
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func (c *adminClient) ResolveReports(ids []int64, label string, neg bool) ([]*dbx.ReportRow, error) {
+	response := &adminReportsResponse{}
+	err := c.do("POST", "/admin/reports/resolve", &adminResolveReportsRequest{Ids: ids, Label: label, Neg: neg}, response)
+	if err != nil {
+		return nil, err
+	}
+	return response.Reports, nil
+}
+
+var ReportsCmd = &cli.Command{
+	Name:  "reports",
+	Usage: "review moderation reports through the admin api",
+	Subcommands: []*cli.Command{
+		ReportsListCmd,
+		ReportsResolveCmd,
+	},
+}
+
+var ReportsListCmd = &cli.Command{
+	Name:  "list",
+	Usage: "list moderation reports",
+	Flags: cmd.CombineFlags(
+		cmd.WithAdminClient,
+		&cli.StringFlag{
+			Name:  "status",
+			Usage: "status of reports to list",
+			Value: dbx.ReportStatusOpen,
+		},
+		&cli.StringFlag{
+			Name:  "cursor",
+			Usage: "list reports older than this cursor",
+		},
+		&cli.IntFlag{
+			Name:  "limit",
+			Usage: "number of reports to list",
+			Value: 50,
+		},
+	),
+	Action: func(cctx *cli.Context) error {
+		response, err := newAdminClient(cctx).SelectReports(cctx.String("status"), cctx.String("cursor"), cctx.Int("limit"))
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(utils.Dump(response))
+		return nil
+	},
+}
+
+var ReportsResolveCmd = &cli.Command{
+	Name:      "resolve",
+	Usage:     "resolve moderation reports, optionally labeling their subjects",
+	ArgsUsage: "<report-id>...",
+	Flags: cmd.CombineFlags(
+		cmd.WithAdminClient,
+		&cli.StringFlag{
+			Name:  "label",
+			Usage: "label to apply to, or negate on, the reported subjects",
+		},
+		&cli.BoolFlag{
+			Name:  "neg",
+			Usage: "negate the label instead of applying it",
+			Value: false,
+		},
+	),
+	Action: func(cctx *cli.Context) error {
+		ids := make([]int64, 0, cctx.Args().Len())
+		for _, arg := range cctx.Args().Slice() {
+			id, err := strconv.ParseInt(arg, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid report id %s: %w", arg, err)
+			}
+			ids = append(ids, id)
+		}
+		if len(ids) == 0 {
+			return fmt.Errorf("at least one report id is required")
+		}
+
+		reports, err := newAdminClient(cctx).ResolveReports(ids, cctx.String("label"), cctx.Bool("neg"))
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(utils.Dump(reports))
+		return nil
+	},
+}
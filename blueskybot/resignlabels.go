@@ -0,0 +1,78 @@
+package blueskybot
+
+import (
+	"context"
+	"fmt"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/flicknow/go-bluesky-bot/pkg/cmd"
+	"github.com/flicknow/go-bluesky-bot/pkg/dbx"
+	"github.com/flicknow/go-bluesky-bot/pkg/sleeper"
+	cli "github.com/urfave/cli/v2"
+)
+
+var ResignLabelsCmd = &cli.Command{
+	Name:  "resign-labels",
+	Usage: "re-sign custom labels with the active signing key after a key rotation",
+	Flags: cmd.CombineFlags(
+		cmd.WithDb,
+		&cli.IntFlag{
+			Name:  "chunk",
+			Usage: "chunk size",
+			Value: 100,
+		},
+		&cli.Int64Flag{
+			Name:  "pause",
+			Usage: "number of milliseconds to pause between chunks",
+			Value: 250,
+		},
+	),
+	Action: func(cctx *cli.Context) error {
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGQUIT, syscall.SIGTERM)
+		defer stop()
+
+		sleeper := sleeper.NewSleeper(ctx)
+		shutdown := false
+		go func() {
+			<-ctx.Done()
+			shutdown = true
+		}()
+
+		d := dbx.NewDBx(cmd.ToContext(cctx))
+		defer d.Close()
+
+		chunk := cctx.Int("chunk")
+		pause := cctx.Int64("pause")
+		total := 0
+		totalSkipped := 0
+		var cursor int64 = 0
+
+	RESIGN:
+		for {
+			if shutdown {
+				break RESIGN
+			}
+
+			var resigned, skipped int
+			var err error
+			cursor, resigned, skipped, err = d.ResignLabels(cursor, chunk)
+			if err != nil {
+				return err
+			}
+
+			total += resigned
+			totalSkipped += skipped
+			if resigned+skipped < chunk {
+				break RESIGN
+			}
+
+			sleeper.Sleep(time.Duration(pause) * time.Millisecond)
+		}
+
+		fmt.Printf("> re-signed %d labels with %s, skipped %d\n", total, d.SigningKey.KeyId(), totalSkipped)
+
+		return nil
+	},
+}
@@ -0,0 +1,101 @@
+package blueskybot
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/flicknow/go-bluesky-bot/pkg/clock"
+	"github.com/flicknow/go-bluesky-bot/pkg/firehose"
+	"github.com/flicknow/go-bluesky-bot/pkg/indexer"
+	"github.com/flicknow/go-bluesky-bot/pkg/rules"
+	"github.com/flicknow/go-bluesky-bot/pkg/utils"
+	cli "github.com/urfave/cli/v2"
+)
+
+var RulesCmd = &cli.Command{
+	Name:  "rules",
+	Usage: "inspect and test label rules",
+	Subcommands: []*cli.Command{
+		RulesTestCmd,
+		RulesDefaultsCmd,
+	},
+}
+
+var RulesTestCmd = &cli.Command{
+	Name:      "test",
+	Usage:     "evaluate a rules file against a post record",
+	ArgsUsage: "<rules.json> <post.json>",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "author",
+			Usage: "did of the post author",
+			Value: utils.NewTestDid(),
+		},
+		&cli.Int64Flag{
+			Name:  "actor-posts",
+			Usage: "number of posts the author has made",
+			Value: 1,
+		},
+		&cli.Int64Flag{
+			Name:  "actor-last-post",
+			Usage: "unix time of the author's previous post",
+			Value: 0,
+		},
+		&cli.BoolFlag{
+			Name:  "actor-uninitialized",
+			Usage: "treat the author as not yet initialized",
+			Value: false,
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		if cctx.Args().Len() != 2 {
+			return fmt.Errorf("expected a rules file and a post file")
+		}
+
+		ruleset, err := rules.Load(cctx.Args().Get(0))
+		if err != nil {
+			return err
+		}
+
+		b, err := os.ReadFile(cctx.Args().Get(1))
+		if err != nil {
+			return err
+		}
+
+		post := &appbsky.FeedPost{}
+		err = json.Unmarshal(b, post)
+		if err != nil {
+			return fmt.Errorf("error parsing post %s: %w", cctx.Args().Get(1), err)
+		}
+
+		author := cctx.String("author")
+		postRef := firehose.NewPostRef(post, &comatproto.RepoStrongRef{Uri: fmt.Sprintf("at://%s/app.bsky.feed.post/test", author)}, 0)
+
+		result := ruleset.Evaluate(&rules.Subject{
+			Author: author,
+			Post:   post,
+			Quote:  postRef.Quotes,
+			Actor: &rules.ActorStats{
+				Initialized: !cctx.Bool("actor-uninitialized"),
+				Posts:       cctx.Int64("actor-posts"),
+				LastPost:    cctx.Int64("actor-last-post"),
+			},
+			Now: clock.NewClock().NowUnix(),
+		})
+
+		fmt.Println(utils.Dump(result))
+		return nil
+	},
+}
+
+var RulesDefaultsCmd = &cli.Command{
+	Name:  "defaults",
+	Usage: "print the built-in label rules",
+	Action: func(cctx *cli.Context) error {
+		fmt.Println(utils.Dump(indexer.DefaultRules))
+		return nil
+	},
+}
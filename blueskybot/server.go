@@ -3,29 +3,33 @@ package blueskybot
 import (
 	"bytes"
 	"context"
-	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"html/template"
-	"io"
 	"log"
 	"net"
 	"net/http"
 	"os/signal"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/bluesky-social/indigo/api/atproto"
 	"github.com/bluesky-social/indigo/events"
+	"github.com/flicknow/go-bluesky-bot/pkg/auth"
 	"github.com/flicknow/go-bluesky-bot/pkg/client"
 	"github.com/flicknow/go-bluesky-bot/pkg/cmd"
 	"github.com/flicknow/go-bluesky-bot/pkg/dbx"
+	"github.com/flicknow/go-bluesky-bot/pkg/feeds"
+	"github.com/flicknow/go-bluesky-bot/pkg/health"
 	"github.com/flicknow/go-bluesky-bot/pkg/indexer"
+	"github.com/flicknow/go-bluesky-bot/pkg/metrics"
+	"github.com/flicknow/go-bluesky-bot/pkg/ratelimit"
 	"github.com/flicknow/go-bluesky-bot/pkg/ticker"
 	"github.com/flicknow/go-bluesky-bot/pkg/utils"
 	"github.com/gorilla/websocket"
@@ -55,13 +59,24 @@ var ExpandedLabels = map[string][]string{
 }
 
 type Server struct {
-	Indexer               *indexer.Indexer
-	enableFollowLewdsFeed bool
-	pinnedPost            string
-	server                *http.Server
-	sem                   *semaphore.Weighted
-	tickermu              sync.Mutex
-	tickers               map[*ticker.Ticker]bool
+	Indexer        *indexer.Indexer
+	feeds          *feeds.Registry
+	pinnedPost     string
+	server         *http.Server
+	sem            *semaphore.Weighted
+	queued         atomic.Int64
+	maxQueue       int64
+	queueTimeout   time.Duration
+	limiter        *ratelimit.Limiter
+	tickermu       sync.Mutex
+	tickers        map[*ticker.Ticker]bool
+	labelKeys      *labelKeyVerifier
+	admin          *adminAuth
+	verifier       *auth.Verifier
+	labelsDisabled error
+	didDocument    *didWebDocument
+	cache          *feeds.Cache
+	cursors        *feeds.CursorCodec
 }
 
 func (s *Server) Serve() error {
@@ -101,8 +116,34 @@ func (s *Server) Shutdown(ctx context.Context) error {
 	return s.server.Shutdown(ctx)
 }
 
+type feedReason struct {
+	Type   string `json:"$type"`
+	Repost string `json:"repost,omitempty"`
+}
+
 type feedPost struct {
-	Post string `json:"post"`
+	Post        string      `json:"post"`
+	Reason      *feedReason `json:"reason,omitempty"`
+	FeedContext string      `json:"feedContext,omitempty"`
+}
+
+var reasonPin = &feedReason{Type: "app.bsky.feed.defs#skeletonReasonPin"}
+
+// feedContext is passed back to us with interactions, so it records both the
+// feed and which query produced the post, ie mentions:quote.
+func feedContext(name string, source string) string {
+	if source == "" {
+		return name
+	}
+	return name + ":" + source
+}
+
+func newFeedPost(name string, post *dbx.PostRow) feedPost {
+	item := feedPost{Post: post.Uri, FeedContext: feedContext(name, post.Source)}
+	if post.RepostUri != "" {
+		item.Reason = &feedReason{Type: "app.bsky.feed.defs#skeletonReasonRepost", Repost: post.RepostUri}
+	}
+	return item
 }
 
 type feedResponse struct {
@@ -138,65 +179,87 @@ func writeCorsHeaders(w http.ResponseWriter, r *http.Request) {
 	w.Header().Add("Access-Control-Allow-Headers", "*")
 }
 
-func parseFeedAtUri(uri string) string {
-	if len(uri) <= 5 {
-		return ""
-	}
+// serveFeed checks the paging parameters shared by the feed endpoints before
+// generating the feed.
+func (s *Server) serveFeed(w http.ResponseWriter, r *http.Request, indexer *indexer.Indexer, did string, name string, pinnedPost string) {
+	query := r.URL.Query()
 
-	parts := strings.SplitN(uri[5:], "/", 3)
-	if parts == nil {
-		return ""
-	} else if len(parts) != 3 {
-		return ""
+	limit, err := parseXrpcLimit(query, 25, 100)
+	if err != nil {
+		writeXrpcErr(w, err)
+		return
 	}
 
-	return parts[2]
+	s.generateFeed(w, indexer, did, name, query.Get("cursor"), limit, pinnedPost)
 }
 
-func (s *Server) generateFeed(w http.ResponseWriter, indexer *indexer.Indexer, did string, label string, compoundCursor string, limitString string, pinnedPost string) {
-	if label == "" {
-		BadRequest(w)
+// generateFeed serves a page of the named feed. The limit should already have
+// been checked with parseXrpcLimit.
+func (s *Server) generateFeed(w http.ResponseWriter, indexer *indexer.Indexer, did string, name string, compoundCursor string, limit int, pinnedPost string) {
+	start := time.Now()
+	feedLabel := "unknown"
+	defer func() {
+		metrics.FeedDuration.WithLabelValues(feedLabel).Observe(time.Since(start).Seconds())
+	}()
+
+	if name == "" {
+		writeXrpcError(w, 400, XrpcInvalidRequest, "feed is required")
 		return
 	}
 
+	feed, labels := s.feeds.Resolve(name)
+	if feed == nil {
+		writeXrpcError(w, 400, XrpcUnknownFeed, fmt.Sprintf("unknown feed %s", name))
+		return
+	}
+	feedLabel = feed.Name
+	if feed.Auth && (did == "") {
+		writeXrpcError(w, 401, XrpcAuthRequired, fmt.Sprintf("feed %s is personalized and needs a signed in viewer", name))
+		return
+	}
+	if feed.PinnedPost != "" {
+		pinnedPost = feed.PinnedPost
+	}
+
 	if compoundCursor != "" {
 		pinnedPost = ""
 	}
 
 	var err error
-	cacheAge := 15
-	var cursor int64 = 0
-	parts := strings.SplitN(compoundCursor, "::", 2)
-	cursorIsTimestamp := true
-	if (parts != nil) && (len(parts) == 2) {
-		if parts[1][0] == 'P' {
-			parts[0] = parts[1][1:]
-			cursorIsTimestamp = false
+	paged := false
+	var cursor int64 = dbx.SQLiteMaxInt
+	cursorRkey := ""
+	var compositeCursor feeds.CompositeCursor
+	if feed.Kind == feeds.KindComposite {
+		compositeCursor = feeds.NewCompositeCursor(len(feed.Components))
+	}
+	if compoundCursor != "" {
+		decoded, err := s.cursors.Decode(compoundCursor)
+		if (err != nil) || (!decoded.Legacy() && (decoded.Kind != feed.Kind)) {
+			writeXrpcError(w, 400, XrpcInvalidRequest, "malformed cursor")
+			return
 		}
-		cursor, err = strconv.ParseInt(parts[0], 10, 64)
-		if err != nil {
-			log.Printf("WARNING could not parse time part of cursor %s from %s: %+v\n", parts[0], compoundCursor, err)
-			err = nil
+
+		if feed.Kind == feeds.KindComposite {
+			if (len(decoded.Positions) != len(compositeCursor)) || (decoded.Rkey != "") {
+				writeXrpcError(w, 400, XrpcInvalidRequest, "malformed cursor")
+				return
+			}
+			compositeCursor = feeds.CompositeCursor(decoded.Positions)
 		} else {
-			cacheAge = 600
+			if len(decoded.Positions) != 1 {
+				writeXrpcError(w, 400, XrpcInvalidRequest, "malformed cursor")
+				return
+			}
+			cursor = decoded.Positions[0]
+			cursorRkey = decoded.Rkey
 		}
-	} else {
-		cursorIsTimestamp = false
-		cursor = dbx.SQLiteMaxInt
+		paged = true
 	}
 
-	limit := 25
-	if limitString != "" {
-		var err error
-		limit, err = strconv.Atoi(limitString)
-		if err != nil {
-			log.Printf("%+v\n", err)
-			BadRequest(w)
-			return
-		}
-		if limit > 25 {
-			limit = 25
-		}
+	limitString := strconv.Itoa(limit)
+	if limit > 25 {
+		limit = 25
 	}
 
 	if limit <= 1 {
@@ -206,17 +269,44 @@ func (s *Server) generateFeed(w http.ResponseWriter, indexer *indexer.Indexer, d
 		limit = limit - 1
 	}
 
+	if feed.Kind == feeds.KindLabels {
+		labels = expandLabels(labels)
+	} else if feed.Kind == feeds.KindComposite {
+		labels = s.compositeLabels(feed)
+	}
+
+	maxAge := feed.CacheMaxAge(paged)
+	key := feeds.CacheKey{Feed: name, Cursor: compoundCursor, Limit: limitString}
+	if feed.Auth {
+		key.Viewer = did
+	}
+	var generations []int64
+	if maxAge != 0 {
+		if b, ok := s.cache.Get(key); ok {
+			writeFeedResponse(w, feed, maxAge, "hit", b)
+			return
+		}
+		generations = s.cache.Snapshot(labels)
+	}
+
 	var posts []*dbx.PostRow
-	vary := ""
+	var visible []*dbx.PostRow
+	var nextCompositeCursor feeds.CompositeCursor
 	err = dbx.RetryDbIsLocked(func() error {
-		err = s.sem.Acquire(context.Background(), 1)
-		defer s.sem.Release(1)
+		err = s.acquireDb()
 		if err != nil {
 			return err
 		}
+		defer s.sem.Release(1)
+
+		if feed.Disabled {
+			posts = make([]*dbx.PostRow, 0)
+			visible = posts
+			return nil
+		}
 
-		if cursorIsTimestamp {
-			postid, err := indexer.Db.Posts.SelectPostIdByEpochAndRkey(cursor, parts[1])
+		if cursorRkey != "" {
+			postid, err := indexer.Db.Posts.SelectPostIdByEpochAndRkey(cursor, cursorRkey)
 			if err != nil {
 				return err
 			}
@@ -225,180 +315,151 @@ func (s *Server) generateFeed(w http.ResponseWriter, indexer *indexer.Indexer, d
 			}
 		}
 
-		if label == "lewds" {
-			posts = make([]*dbx.PostRow, 0)
-			posts, err = indexer.Db.SelectPostsByLabels(cursor, limit, "underwear", "nudity", "porn", "sexual")
-		} else if label == "f-lewds" {
-			if did == "" {
-				return ErrUnauthorized
-			}
-			if s.enableFollowLewdsFeed {
-				posts, err = indexer.Db.SelectPostsByLabelsFollowed(cursor, limit, did, "underwear", "nudity", "porn", "sexual")
-				vary = "authorization"
-			} else {
-				posts = make([]*dbx.PostRow, 0)
-			}
-		} else if label == "mark" {
-			if did == "" {
-				return ErrUnauthorized
-			}
-			posts, err = indexer.Db.SelectMark(cursor, limit, did)
-			vary = "authorization"
-		} else if label == "allmentions" {
-			if did == "" {
-				return ErrUnauthorized
-			}
-			posts, err = indexer.Db.SelectMentions(cursor, limit, did)
-			vary = "authorization"
-		} else if label == "f-allmentions" {
-			if did == "" {
-				return ErrUnauthorized
-			}
-			posts, err = indexer.Db.SelectMentionsFollowed(cursor, limit, did)
-			vary = "authorization"
-		} else if label == "bangers" {
-			posts, err = indexer.Db.SelectBangers(cursor, limit)
-		} else if label == "birthdays" {
-			posts, err = indexer.Db.SelectBirthdays(cursor, limit)
-		} else if label == "f-birthdays" {
-			if did == "" {
-				return ErrUnauthorized
-			}
-			posts, err = indexer.Db.SelectBirthdaysFollowed(cursor, limit, did)
-			vary = "authorization"
-		} else if label == "dms" {
-			if did == "" {
-				return ErrUnauthorized
-			}
-			posts, err = indexer.Db.SelectDms(cursor, limit, did)
-			vary = "authorization"
-		} else if label == "mentions" {
-			if did == "" {
-				return ErrUnauthorized
-			}
-			posts, err = indexer.Db.SelectMentions(cursor, limit, did)
-			vary = "authorization"
-		} else if label == "f-mentions" {
-			if did == "" {
-				return ErrUnauthorized
-			}
-			posts, err = indexer.Db.SelectMentionsFollowed(cursor, limit, did)
-			vary = "authorization"
-		} else if label == "noskies" {
-			posts, err = indexer.Db.SelectPostsByLabels(cursor, limit, "newskie")
-		} else if label == "quotes" {
-			if did == "" {
-				return ErrUnauthorized
+		if feed.Kind == feeds.KindComposite {
+			items, next, err := s.selectCompositePosts(indexer, feed, did, compositeCursor, limit)
+			if err != nil {
+				return err
 			}
-			posts, err = indexer.Db.SelectQuotes(cursor, limit, did)
-			vary = "authorization"
-		} else if label == "firehose" {
-			posts, err = indexer.Db.SelectLatestPosts(cursor, limit)
-		} else if (len(label) > 2) && (label[:2] == "f-") {
-			if did == "" {
-				return ErrUnauthorized
+
+			posts = make([]*dbx.PostRow, 0, len(items))
+			for _, item := range items {
+				item.Post.Source = feedContext(item.Component.Feed, item.Post.Source)
+				posts = append(posts, item.Post)
 			}
-			posts, err = indexer.Db.SelectPostsByLabelsFollowed(cursor, limit, did, label[2:])
-			vary = "authorization"
+			nextCompositeCursor = next
 		} else {
-			expanded, ok := ExpandedLabels[label]
-			if ok {
-				posts, err = indexer.Db.SelectPostsByLabels(cursor, limit, expanded...)
-			} else {
-				posts, err = indexer.Db.SelectPostsByLabels(cursor, limit, label)
-			}
+			posts, err = selectFeedPosts(indexer, feed, labels, did, cursor, limit)
+		}
+		if err != nil {
+			return err
+		}
+
+		visible = posts
+		if feed.Auth {
+			visible, err = indexer.Db.FilterForViewer(did, posts)
 		}
 
 		return err
 	})()
-	if (err != nil) && errors.Is(err, ErrUnauthorized) {
-		Unauthorized(w)
+	if errors.Is(err, ErrServerBusy) {
+		log.Printf("%+v\n", err)
+		ServiceUnavailable(w, s.queueTimeout)
 		return
-	}
-	if err != nil {
+	} else if err != nil {
 		log.Printf("%+v\n", err)
-		ISE(w)
+		writeXrpcError(w, 500, XrpcInternalServerError, "could not generate feed")
 		return
 	}
 	if posts == nil {
-		w.WriteHeader(404)
+		writeXrpcError(w, 400, XrpcUnknownFeed, fmt.Sprintf("unknown feed %s", name))
 		return
 	}
 
-	feed := &feedResponse{}
+	response := &feedResponse{}
 	if len(posts) > 0 {
 		last := posts[len(posts)-1]
-		feed.Cursor = fmt.Sprintf("%d::P%d", last.CreatedAt, last.PostId)
+		if feed.Kind == feeds.KindComposite {
+			response.Cursor = s.cursors.Encode(feed.Kind, nextCompositeCursor...)
+		} else {
+			response.Cursor = s.cursors.Encode(feed.Kind, last.FeedPosition())
+		}
 	}
 
-	feed.Feed = make([]feedPost, 0)
+	response.Feed = make([]feedPost, 0)
 	if pinnedPost != "" {
-		feed.Feed = append(feed.Feed, feedPost{Post: pinnedPost})
+		response.Feed = append(response.Feed, feedPost{Post: pinnedPost, Reason: reasonPin, FeedContext: feedContext(name, "pin")})
 	}
 
-	for _, post := range posts {
-		feed.Feed = append(feed.Feed, feedPost{Post: post.Uri})
+	for _, post := range visible {
+		response.Feed = append(response.Feed, newFeedPost(name, post))
 	}
 
-	b, err := json.Marshal(feed)
+	b, err := json.Marshal(response)
 	if err != nil {
 		log.Printf("%+v\n", err)
-		ISE(w)
+		writeXrpcError(w, 500, XrpcInternalServerError, "could not generate feed")
 		return
 	}
 
-	if label == "firehose" {
-		w.Header().Add("cache-control", "no-cache")
+	status := "miss"
+	if maxAge == 0 {
+		status = "bypass"
 	} else {
-		if vary != "" {
-			w.Header().Add("vary", vary)
-		}
-		w.Header().Add("cache-control", fmt.Sprintf("public, max-age=%d", cacheAge))
+		s.cache.Set(key, b, time.Duration(maxAge)*time.Second, labels, generations)
 	}
 
-	w.Header().Add("content-type", "application/json; charset=utf-8")
-	w.WriteHeader(200)
-	w.Write(b)
+	writeFeedResponse(w, feed, maxAge, status, b)
 }
 
-type subJwt struct {
-	Iss string `json:"iss"`
-	Aud string `json:"aud"`
-	Exp int64  `json:"exp"`
+// selectFeedPosts runs the query behind a single feed, returning nil for
+// kinds it does not know.
+func selectFeedPosts(indexer *indexer.Indexer, feed *feeds.Feed, labels []string, did string, cursor int64, limit int) ([]*dbx.PostRow, error) {
+	switch feed.Kind {
+	case feeds.KindLabels:
+		return indexer.Db.SelectPostsByLabels(cursor, limit, labels...)
+	case feeds.KindFollowedLabels:
+		return indexer.Db.SelectPostsByLabelsFollowed(cursor, limit, did, labels...)
+	case feeds.KindMentions:
+		return indexer.Db.SelectMentions(cursor, limit, did)
+	case feeds.KindFollowedMentions:
+		return indexer.Db.SelectMentionsFollowed(cursor, limit, did)
+	case feeds.KindDms:
+		return indexer.Db.SelectDms(cursor, limit, did)
+	case feeds.KindMark:
+		return indexer.Db.SelectMark(cursor, limit, did)
+	case feeds.KindQuotes:
+		return indexer.Db.SelectQuotes(cursor, limit, did)
+	case feeds.KindReplies:
+		return indexer.Db.SelectReplies(cursor, limit, did)
+	case feeds.KindThreadsFollowed:
+		return indexer.Db.SelectThreadRepliesFollowed(cursor, limit, did)
+	case feeds.KindConversations:
+		return indexer.Db.SelectConversations(cursor, limit, did)
+	case feeds.KindBangers:
+		return indexer.Db.SelectBangers(cursor, limit)
+	case feeds.KindMilestone:
+		return indexer.Db.SelectMilestone(labels[0], cursor, limit)
+	case feeds.KindFollowedMilestone:
+		return indexer.Db.SelectMilestoneFollowed(labels[0], cursor, limit, did)
+	case feeds.KindLatest:
+		return indexer.Db.SelectLatestPosts(cursor, limit)
+	}
+
+	return nil, nil
 }
 
-func getDidFromRequest(r *http.Request) (string, error) {
-	header := r.Header.Get("Authorization")
-	if header == "" {
-		return "", nil
+func writeFeedResponse(w http.ResponseWriter, feed *feeds.Feed, maxAge int, status string, b []byte) {
+	if maxAge == 0 {
+		w.Header().Add("cache-control", "no-cache")
+	} else if feed.Auth {
+		// personalized skeletons must never be served from a shared cache
+		w.Header().Add("vary", "authorization")
+		w.Header().Add("cache-control", fmt.Sprintf("private, max-age=%d", maxAge))
+	} else {
+		w.Header().Add("cache-control", fmt.Sprintf("public, max-age=%d", maxAge))
 	}
 
-	parts := strings.Split(header, " ")
-	if len(parts) != 2 {
-		return "", nil
-	}
-	if strings.ToLower(parts[0]) != "bearer" {
-		return "", nil
-	}
+	metrics.FeedCache.WithLabelValues(status).Inc()
+	w.Header().Add("x-cache", status)
+	w.Header().Add("content-type", "application/json; charset=utf-8")
+	w.WriteHeader(200)
+	w.Write(b)
+}
 
-	parts = strings.Split(parts[1], ".")
-	if len(parts) != 3 {
+// viewerDid verifies the request's service auth token against the feed
+// generator's did, returning "" when the request is anonymous.
+func (s *Server) viewerDid(r *http.Request, lxm string) (string, error) {
+	token := auth.BearerToken(r)
+	if token == "" {
 		return "", nil
 	}
 
-	padded := parts[1] + strings.Repeat("=", ((4-(len(parts[1])%4))%4))
-	b, err := base64.StdEncoding.DecodeString(padded)
-	if err != nil {
-		return "", fmt.Errorf("could not parse did from header. got header=%s, part=%s, err=%w", header, parts[1], err)
-	}
-
-	jwt := &subJwt{}
-	err = json.Unmarshal(b, jwt)
+	claims, err := s.verifier.Verify(r.Context(), token, s.feeds.Did, lxm)
 	if err != nil {
 		return "", err
 	}
 
-	return jwt.Iss, nil
+	return claims.Did(), nil
 }
 
 func (s *Server) writeSubscribeLabels(c *websocket.Conn, labels []*dbx.CustomLabel) error {
@@ -406,6 +467,11 @@ func (s *Server) writeSubscribeLabels(c *websocket.Conn, labels []*dbx.CustomLab
 	subscribeLabels.Seq = labels[len(labels)-1].CustomLabelId
 	subscribeLabels.Labels = make([]*atproto.LabelDefs_Label, 0)
 
+	labels = s.labelKeys.Filter(labels)
+	if len(labels) == 0 {
+		return nil
+	}
+
 	for _, label := range labels {
 		r := bytes.NewReader(label.Cbor)
 		subscribeLabel := &atproto.LabelDefs_Label{}
@@ -435,111 +501,195 @@ func (s *Server) writeSubscribeLabels(c *websocket.Conn, labels []*dbx.CustomLab
 	return c.WriteMessage(websocket.BinaryMessage, buf.Bytes())
 }
 
-type plcDirectoryRecord struct {
-	AlsoKnownAs []string `json:"alsoKnownAs"`
-	Services    []struct {
-		ServiceEndpoint string `json:"serviceEndpoint"`
-	} `json:"service"`
+func matchesUriPatterns(patterns []string, uri string) bool {
+	for _, pattern := range patterns {
+		if strings.HasSuffix(pattern, "*") {
+			if strings.HasPrefix(uri, pattern[:len(pattern)-1]) {
+				return true
+			}
+		} else if pattern == uri {
+			return true
+		}
+	}
+	return false
 }
 
-func lookupPlcDirectoryRecord(did string) (*plcDirectoryRecord, error) {
-	url := fmt.Sprintf("https://plc.directory/%s", did)
-	resp, err := http.Get(url)
-	if err != nil {
-		return nil, err
+func (s *Server) queryLabels(w http.ResponseWriter, r *http.Request) {
+	if s.labelsDisabled != nil {
+		writeXrpcError(w, 503, "LabelerUnavailable", s.labelsDisabled.Error())
+		return
 	}
-	defer resp.Body.Close()
 
-	record := &plcDirectoryRecord{}
-	body, err := io.ReadAll(resp.Body)
-	if err := json.Unmarshal(body, record); err != nil {
-		return nil, fmt.Errorf("error parsing plc directory record: %w\n%s", err, string(body))
+	query := r.URL.Query()
+	patterns := query["uriPatterns"]
+	if len(patterns) == 0 {
+		writeXrpcError(w, 400, XrpcInvalidRequest, "uriPatterns is required")
+		return
 	}
 
-	return record, nil
-}
+	response := &atproto.LabelQueryLabels_Output{Labels: make([]*atproto.LabelDefs_Label, 0)}
 
-func lookupPds(did string) (string, error) {
-	record, err := lookupPlcDirectoryRecord(did)
+	sources := query["sources"]
+	if (len(sources) > 0) && !slices.Contains(sources, LabelerDid) {
+		s.writeJson(w, response)
+		return
+	}
+
+	limit, err := parseXrpcLimit(query, 50, 250)
 	if err != nil {
-		return "", err
+		writeXrpcErr(w, err)
+		return
 	}
 
-	if (record.Services == nil) || (len(record.Services) != 1) {
-		return "", fmt.Errorf("could not find service record from %+v", record)
+	var cursor int64 = 0
+	if cursorStr := query.Get("cursor"); cursorStr != "" {
+		c, err := strconv.ParseInt(cursorStr, 10, 64)
+		if err != nil {
+			writeXrpcError(w, 400, XrpcInvalidRequest, "malformed cursor")
+			return
+		}
+		cursor = c
 	}
 
-	return record.Services[0].ServiceEndpoint, nil
-}
+	db := s.Indexer.Db
+	chunk := 100
+SCAN:
+	for i := 0; i < 10; i++ {
+		rows, err := db.SelectCustomLabels(cursor, chunk)
+		if err != nil {
+			log.Printf("SelectCustomLabels err: %+v\n", err)
+			writeXrpcError(w, 500, XrpcInternalServerError, "could not query labels")
+			return
+		}
 
-func lookupDidByDns(handle string) (string, error) {
-	domain := fmt.Sprintf("_atproto.%s", handle)
-	records, err := net.LookupTXT(domain)
-	if err != nil {
-		return "", fmt.Errorf("could not lookup txt record for %s: %w", domain, err)
-	}
+		for _, row := range s.labelKeys.Filter(rows) {
+			label := &atproto.LabelDefs_Label{}
+			err := label.UnmarshalCBOR(bytes.NewReader(row.Cbor))
+			if err != nil {
+				log.Printf("error decoding custom label %d: %+v\n", row.CustomLabelId, err)
+				continue
+			}
+			if !matchesUriPatterns(patterns, label.Uri) {
+				continue
+			}
 
-	for _, record := range records {
-		if (len(record) > 4) && (record[:4] == "did=") {
-			return record[4:], nil
+			response.Labels = append(response.Labels, label)
+			if len(response.Labels) >= limit {
+				cursor = row.CustomLabelId
+				break SCAN
+			}
+		}
+
+		if len(rows) > 0 {
+			cursor = rows[len(rows)-1].CustomLabelId
+		}
+		if len(rows) < chunk {
+			cursor = 0
+			break SCAN
 		}
 	}
 
-	return "", fmt.Errorf("could not find did record for domain %s. found %s", domain, strings.Join(records, ", "))
+	if cursor != 0 {
+		cursorStr := strconv.FormatInt(cursor, 10)
+		response.Cursor = &cursorStr
+	}
+
+	s.writeJson(w, response)
 }
 
-func lookupDidByHttps(handle string) (string, error) {
-	url := fmt.Sprintf("https://%s/.well-known/atproto-did", handle)
-	resp, err := http.Get(url)
+func (s *Server) writeJson(w http.ResponseWriter, response any) {
+	b, err := json.Marshal(response)
 	if err != nil {
-		return "", err
+		log.Printf("%+v\n", err)
+		ISE(w)
+		return
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	w.Header().Add("content-type", "application/json; charset=utf-8")
+	w.WriteHeader(200)
+	w.Write(b)
+}
+
+func writeSubscribeLabelsInfo(c *websocket.Conn, name string, message string) error {
+	buf := new(bytes.Buffer)
+	header := events.EventHeader{
+		Op:      events.EvtKindMessage,
+		MsgType: "#info",
+	}
+	err := header.MarshalCBOR(buf)
 	if err != nil {
-		return "", err
+		return err
 	}
 
-	did := string(body)
-	if resp.StatusCode == 200 {
-		if (len(did) > 4) && (did[:4] == "did:") {
-			return did, nil
-		} else {
-			return "", fmt.Errorf("could not parse did for %s from https verification. got %s which is not a did", handle, did)
-		}
-	} else {
-		return "", fmt.Errorf("could not lookup did for %s from https verification. %s returned %s", handle, url, resp.Status)
+	info := &atproto.LabelSubscribeLabels_Info{Name: name, Message: &message}
+	err = info.MarshalCBOR(buf)
+	if err != nil {
+		return err
 	}
+
+	return c.WriteMessage(websocket.BinaryMessage, buf.Bytes())
 }
 
-func lookupDid(handle string) (string, error) {
-	length := len(handle)
-	if (length > 4) && (handle[:4] == "did:") {
-		return handle, nil
+// loadFeedRegistry reads the feeds file, falling back to the built in feeds.
+// Either way the follow lewds flag and one pair of feeds for each configured
+// milestone are applied on top.
+func loadFeedRegistry(ctx context.Context, indexer *indexer.Indexer) (*feeds.Registry, error) {
+	var registry *feeds.Registry
+	var err error
+
+	path, _ := ctx.Value("feeds").(string)
+	if path != "" {
+		registry, err = feeds.LoadRegistry(path)
+	} else {
+		registry, err = feeds.NewRegistry(feeds.DefaultDid, feeds.DefaultFeeds())
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	if (length > 12) && (handle[(length-12):] == ".bsky.social") {
-		return lookupDidByHttps(handle)
+	enableFollowLewdsFeed, _ := ctx.Value("enable-follow-lewds-feed").(bool)
+	if enableFollowLewdsFeed {
+		if lewds, _ := registry.Resolve("f-lewds"); lewds != nil {
+			lewds.Disabled = false
+		} else {
+			log.Printf("WARNING --enable-follow-lewds-feed is set but %s has no f-lewds feed\n", path)
+		}
 	}
 
-	dns, dnsErr := lookupDidByDns(handle)
-	if (dnsErr == nil) && (dns != "") {
-		return dns, nil
+	for _, milestone := range indexer.Milestones.Milestones {
+		if milestone.Label == "birthday" {
+			continue
+		}
+		err = registry.Add(feeds.MilestoneFeeds(milestone.Label, milestone.Label)...)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	https, httpsErr := lookupDidByHttps(handle)
-	if (httpsErr == nil) && (https != "") {
-		return https, nil
+	return registry, nil
+}
+
+// loadCursorCodec signs feed cursors with the configured secret. The secret
+// has to outlive signing key rotations and be shared by every server behind
+// the feed, so it is never derived or generated here.
+func loadCursorCodec(ctx context.Context) (*feeds.CursorCodec, error) {
+	secret, _ := ctx.Value("cursor-secret").(string)
+	legacy, _ := ctx.Value("legacy-cursors").(bool)
+
+	if secret == "" {
+		return nil, fmt.Errorf("--cursor-secret is required to sign feed cursors")
 	}
 
-	return "", fmt.Errorf("could not lookup did for %s:\n%s\n", dnsErr, httpsErr)
+	return feeds.NewCursorCodec([]byte(secret), legacy), nil
 }
 
-func NewServer(ctx context.Context, indexer *indexer.Indexer) *Server {
+func NewServer(ctx context.Context, indexer *indexer.Indexer) (*Server, error) {
 	addr, _ := ctx.Value("listen").(string)
 	maxConn, _ := ctx.Value("max-web-connections").(int64)
 	pinnedPost, _ := ctx.Value("pinned-post").(string)
+	cacheSize, _ := ctx.Value("feed-cache-size").(int)
+	maxQueue, _ := ctx.Value("max-web-queue").(int64)
+	queueTimeout, _ := ctx.Value("web-queue-timeout").(time.Duration)
 
 	at := func(w http.ResponseWriter, r *http.Request) {
 		log.Printf("%s %s\n", r.Method, r.URL.String())
@@ -588,7 +738,7 @@ func NewServer(ctx context.Context, indexer *indexer.Indexer) *Server {
 			return
 		}
 
-		did, err := lookupDid(did)
+		did, err := indexer.Identity.Resolve(r.Context(), did)
 		if err != nil {
 			log.Printf("%+v\n", err)
 			w.Header().Add("content-type", "text/plain; charset=utf-8")
@@ -597,7 +747,14 @@ func NewServer(ctx context.Context, indexer *indexer.Indexer) *Server {
 			return
 		}
 
-		pds, err := lookupPds(did)
+		doc, err := indexer.Identity.ResolveDid(r.Context(), did)
+		if err != nil {
+			log.Printf("%+v\n", err)
+			http.NotFound(w, r)
+			return
+		}
+
+		pds, err := doc.Pds()
 		if err != nil {
 			log.Printf("%+v\n", err)
 			http.NotFound(w, r)
@@ -613,12 +770,62 @@ func NewServer(ctx context.Context, indexer *indexer.Indexer) *Server {
 		w.Write([]byte(fmt.Sprintf("%s is in %s!\n", handle, pds)))
 	}
 
+	registry, err := loadFeedRegistry(ctx, indexer)
+	if err != nil {
+		return nil, err
+	}
+
+	verifier := auth.NewDirectoryVerifier(indexer.Identity)
 	s := &Server{
-		Indexer:    indexer,
-		pinnedPost: pinnedPost,
-		sem:        semaphore.NewWeighted(maxConn),
-		tickermu:   sync.Mutex{},
-		tickers:    make(map[*ticker.Ticker]bool),
+		Indexer:      indexer,
+		feeds:        registry,
+		pinnedPost:   pinnedPost,
+		sem:          semaphore.NewWeighted(maxConn),
+		maxQueue:     maxQueue,
+		queueTimeout: queueTimeout,
+		tickermu:     sync.Mutex{},
+		tickers:      make(map[*ticker.Ticker]bool),
+		labelKeys:    newLabelKeyVerifier(LabelerDid, indexer.Db.SigningKey, labelerKeyLookup(indexer.Identity)),
+		admin:        newAdminAuth(ctx, verifier),
+		verifier:     verifier,
+	}
+
+	s.limiter, err = loadRateLimiter(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.cursors, err = loadCursorCodec(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if cacheSize > 0 {
+		s.cache = feeds.NewCache(cacheSize)
+		go s.watchFeedCache(s.addTicker(FeedCachePollInterval))
+	}
+
+	if strings.HasPrefix(registry.Did, "did:web:") {
+		endpoint, _ := ctx.Value("service-endpoint").(string)
+		if endpoint == "" {
+			endpoint, err = didWebEndpoint(registry.Did)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		s.didDocument, err = newDidWebDocument(registry.Did, strings.TrimSuffix(endpoint, "/"), indexer.Db.SigningKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = checkLabelerKey(LabelerDid, indexer.Db.SigningKey, labelerKeyLookup(indexer.Identity))
+	if errors.Is(err, ErrLabelerKeyMismatch) {
+		log.Printf("ERROR refusing to serve labels: %+v\n", err)
+		s.labelsDisabled = err
+	} else if err != nil {
+		log.Printf("WARNING could not check labeler key for %s: %+v\n", LabelerDid, err)
 	}
 
 	mux := http.NewServeMux()
@@ -665,7 +872,7 @@ func NewServer(ctx context.Context, indexer *indexer.Indexer) *Server {
 			return
 		}
 
-		did, err := lookupDid(parts[0])
+		did, err := indexer.Identity.Resolve(r.Context(), parts[0])
 		if err != nil {
 			log.Printf("%+v\n", err)
 			w.Header().Add("cache-control", "public, max-age=30")
@@ -686,7 +893,7 @@ func NewServer(ctx context.Context, indexer *indexer.Indexer) *Server {
 
 		handle := r.URL.Path[5:]
 
-		did, err := lookupDid(handle)
+		did, err := indexer.Identity.Resolve(r.Context(), handle)
 		if err != nil {
 			log.Printf("%+v\n", err)
 			w.Header().Add("content-type", "text/plain; charset=utf-8")
@@ -700,160 +907,15 @@ func NewServer(ctx context.Context, indexer *indexer.Indexer) *Server {
 		w.WriteHeader(200)
 		w.Write([]byte(did))
 	})
-	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
-		stat := syscall.Statfs_t{}
-		err := syscall.Statfs("/var/db", &stat)
-		if err != nil {
-			ISE(w)
-			fmt.Println(err.Error())
-			return
-		}
-
-		p_free := 100 * float64(stat.Bavail) / float64(stat.Blocks)
-		if p_free < 5 {
-			w.Header().Add("content-type", "text/plain; charset=utf-8")
-			ISE(w)
-			w.Write([]byte(fmt.Sprintf("ERROR: disk is %f%% free\n", p_free)))
-			return
-		}
-
-		w.Header().Add("content-type", "text/plain; charset=utf-8")
-		w.WriteHeader(200)
-		w.Write([]byte(fmt.Sprintf("OK: disk is %f%% free\n", p_free)))
-	})
-	mux.HandleFunc("/quotes/", func(w http.ResponseWriter, r *http.Request) {
-		url := r.URL.String()
-		log.Printf("%s %s\n", r.Method, url)
-
-		tmpl, err := template.New("quotes.html").Parse(QuotesHtmlTemplateText)
-		if err != nil {
-			log.Printf("error processing quotes html template: %s\n", err)
-			ISE(w)
-			return
-		}
-
-		if url == "/quotes/" {
-			w.Header().Add("cache-control", "public, max-age=600")
-			w.Header().Add("content-type", "text/html; charset=utf-8")
-			w.WriteHeader(200)
-
-			tmplParams := &QuotesHtmlParams{Form: true}
-			err := tmpl.Execute(w, tmplParams)
-			if err != nil {
-				log.Printf("error processing quotes html template: %s\n", err)
-				ISE(w)
-			}
-
+	s.handleHealth(mux, health.NewConfig(ctx))
+	mux.HandleFunc("/quotes/", s.quotes)
+	xrpc := newXrpcRouter()
+	xrpc.subscription("com.atproto.label.subscribeLabels", func(w http.ResponseWriter, r *http.Request) {
+		if s.labelsDisabled != nil {
+			writeXrpcError(w, 503, "LabelerUnavailable", s.labelsDisabled.Error())
 			return
 		}
 
-		tmplParams := &QuotesHtmlParams{Url: fmt.Sprintf("https://%s", url[15:])}
-
-		if len(url) < 32 {
-			log.Printf("invalid length: %d\n", len(url))
-			w.Header().Add("cache-control", "public, max-age=30")
-			w.Header().Add("content-type", "text/html; charset=utf-8")
-			w.WriteHeader(400)
-
-			tmplParams.Error = fmt.Sprintf("%s does not look like a valid bsky.app post url\n", url[9:])
-			err := tmpl.Execute(w, tmplParams)
-			if err != nil {
-				log.Printf("error processing quotes html template: %s\n", err)
-				ISE(w)
-			}
-
-			return
-		}
-		if url[:32] != "/quotes/https:/bsky.app/profile/" {
-			log.Printf("invalid prefix: %s\n", url[:3])
-			w.Header().Add("cache-control", "public, max-age=30")
-			w.Header().Add("content-type", "text/html; charset=utf-8")
-			w.WriteHeader(400)
-
-			tmplParams.Error = fmt.Sprintf("%s does not look like a valid bsky.app post url\n", url[9:])
-			err := tmpl.Execute(w, tmplParams)
-			if err != nil {
-				log.Printf("error processing quotes html template: %s\n", err)
-				ISE(w)
-			}
-
-			return
-		}
-
-		parts := strings.Split(url[32:], "/")
-		if len(parts) != 3 {
-			log.Printf("invalid suffix: %s\n", url[32:])
-			w.Header().Add("cache-control", "public, max-age=30")
-			w.Header().Add("content-type", "text/html; charset=utf-8")
-			w.WriteHeader(400)
-
-			tmplParams.Error = fmt.Sprintf("%s does not look like a valid bsky.app post url\n", url[9:])
-			err := tmpl.Execute(w, tmplParams)
-			if err != nil {
-				log.Printf("error processing quotes html template: %s\n", err)
-				ISE(w)
-			}
-
-			return
-		}
-
-		did, err := lookupDid(parts[0])
-		if err != nil {
-			log.Printf("%+v\n", err)
-			w.Header().Add("cache-control", "public, max-age=30")
-			w.Header().Add("content-type", "text/html; charset=utf-8")
-			w.WriteHeader(400)
-
-			tmplParams.Error = fmt.Sprintf("%s does not look like a valid bsky.app post url\n", url[9:])
-			err := tmpl.Execute(w, tmplParams)
-			if err != nil {
-				log.Printf("error processing quotes html template: %s\n", err)
-				ISE(w)
-			}
-
-			return
-		}
-
-		aturi := fmt.Sprintf("at://%s/app.bsky.feed.post/%s", did, parts[2])
-		quotes, err := s.Indexer.Db.SelectQuotesForUri(aturi)
-		if err != nil {
-			log.Printf("%+v\n", err)
-			w.Header().Add("cache-control", "public, max-age=30")
-			w.Header().Add("content-type", "text/html; charset=utf-8")
-			w.WriteHeader(400)
-
-			tmplParams.Error = err.Error()
-			err := tmpl.Execute(w, tmplParams)
-			if err != nil {
-				log.Printf("error processing quotes html template: %s\n", err)
-				ISE(w)
-			}
-
-			return
-		}
-
-		quoteUris := make([]string, 0, len(quotes))
-		for _, quote := range quotes {
-			did := utils.ParseDid(quote.Uri)
-			rkey := utils.ParseRkey(quote.Uri)
-			uri := fmt.Sprintf("https://bsky.app/profile/%s/post/%s", did, rkey)
-			quoteUris = append(quoteUris, uri)
-		}
-
-		w.Header().Add("cache-control", "public, max-age=30")
-		w.Header().Add("content-type", "text/html; charset=utf-8")
-		w.WriteHeader(200)
-
-		tmplParams.Posts = quoteUris
-		err = tmpl.Execute(w, tmplParams)
-		if err != nil {
-			log.Printf("error processing quotes html template: %s\n", err)
-			ISE(w)
-		}
-	})
-	mux.HandleFunc("/xrpc/com.atproto.label.subscribeLabels", func(w http.ResponseWriter, r *http.Request) {
-		log.Printf("%s %s\n", r.Method, r.URL.String())
-
 		query := r.URL.Query()
 		cursorStr := query.Get("cursor")
 
@@ -909,6 +971,10 @@ func NewServer(ctx context.Context, indexer *indexer.Indexer) *Server {
 		limit := 25
 		db := s.Indexer.Db
 
+		// subscribe before backfilling so nothing inserted in between is missed
+		sub := db.CustomLabels.Hub.Subscribe()
+		defer func() { sub.Close() }()
+
 		lastId, err := db.SelectLastCustomLabelId()
 		if err != nil {
 			fmt.Printf("SelectLastCustomLabelId err: %+v\n", err)
@@ -917,35 +983,50 @@ func NewServer(ctx context.Context, indexer *indexer.Indexer) *Server {
 
 		if (cursor == 0) || (cursor > lastId) {
 			cursor = lastId - 1
+		} else {
+			firstId, err := db.CustomLabels.SelectFirstLabelId()
+			if err != nil {
+				fmt.Printf("SelectFirstLabelId err: %+v\n", err)
+				return
+			}
+			if cursor < (firstId - 1) {
+				err = writeSubscribeLabelsInfo(c, "OutdatedCursor", fmt.Sprintf("cursor %d is older than the oldest retained label %d", cursor, firstId))
+				if err != nil {
+					fmt.Printf("writeSubscribeLabelsInfo err: %+v\n", err)
+					return
+				}
+			}
 		}
 
 		ticker := s.addTicker(30 * time.Second)
 		defer s.removeTicker(ticker)
 
-	BACKFILL:
-		for len(s.tickers) != 0 {
-			labels, err := db.SelectCustomLabels(cursor, limit)
-			if err != nil {
-				fmt.Printf("SelectCustomAccountLabels err: %+v\n", err)
-				return
-			}
-			if len(labels) == 0 {
-				break BACKFILL
-			}
+		backfill := func() bool {
+			for len(s.tickers) != 0 {
+				labels, err := db.SelectCustomLabels(cursor, limit)
+				if err != nil {
+					fmt.Printf("SelectCustomLabels err: %+v\n", err)
+					return false
+				}
+				if len(labels) == 0 {
+					return true
+				}
 
-			cursor = labels[len(labels)-1].CustomLabelId
+				cursor = labels[len(labels)-1].CustomLabelId
 
-			err = s.writeSubscribeLabels(c, labels)
-			if err != nil {
-				fmt.Printf("writeSubscribeLabels err: %+v\n", err)
-				return
-			}
+				err = s.writeSubscribeLabels(c, labels)
+				if err != nil {
+					fmt.Printf("writeSubscribeLabels err: %+v\n", err)
+					return false
+				}
 
-			if len(labels) < limit {
-				break BACKFILL
+				if len(labels) < limit {
+					return true
+				}
 			}
+			return false
 		}
-		if len(s.tickers) == 0 {
+		if !backfill() {
 			return
 		}
 
@@ -953,84 +1034,84 @@ func NewServer(ctx context.Context, indexer *indexer.Indexer) *Server {
 			select {
 			case <-ctx.Done():
 				return
-			case <-ticker.C:
-				for {
-					if err := c.WriteControl(websocket.PingMessage, []byte{}, time.Now().Add(5*time.Second)); err != nil {
-						fmt.Printf("failed to ping client: %s\n", err)
+			case _, ok := <-ticker.C:
+				if !ok {
+					return
+				}
+				if err := c.WriteControl(websocket.PingMessage, []byte{}, time.Now().Add(5*time.Second)); err != nil {
+					fmt.Printf("failed to ping client: %s\n", err)
+					return
+				}
+			case labels, ok := <-sub.C:
+				if !ok {
+					// we fell behind the hub, so catch up from the db and resubscribe
+					sub = db.CustomLabels.Hub.Subscribe()
+					if !backfill() {
 						return
 					}
+					continue
+				}
 
-					labels, err := db.SelectCustomLabels(cursor, 25)
-					if err != nil {
-						fmt.Printf("SelectCustomLabels err: %+v\n", err)
-						return
+				fresh := make([]*dbx.CustomLabel, 0, len(labels))
+				for _, label := range labels {
+					if label.CustomLabelId > cursor {
+						fresh = append(fresh, label)
 					}
-					if len(labels) == 0 {
-						break
-					}
-
-					cursor = labels[len(labels)-1].CustomLabelId
+				}
+				if len(fresh) == 0 {
+					continue
+				}
 
-					err = s.writeSubscribeLabels(c, labels)
-					if err != nil {
-						fmt.Printf("writeSubscribeLabels err: %+v\n", err)
-						return
-					}
+				cursor = fresh[len(fresh)-1].CustomLabelId
 
-					if len(labels) < limit {
-						break
-					}
+				err = s.writeSubscribeLabels(c, fresh)
+				if err != nil {
+					fmt.Printf("writeSubscribeLabels err: %+v\n", err)
+					return
 				}
-
 			}
 		}
 	})
 
-	mux.HandleFunc("/xrpc/app.bsky.feed.describeFeedGenerator", func(w http.ResponseWriter, r *http.Request) {
-		writeCorsHeaders(w, r)
-
-		response := describeFeedGeneratorResponse{Did: "did:web:flicknow.xyz"}
-		response.Feeds = []describeFeedGeneratorFeed{
-			{Uri: "at://did:web:flicknow.xyz/app.bsky.feed.generator/allmentions"},
-			{Uri: "at://did:web:flicknow.xyz/app.bsky.feed.generator/f-allmentions"},
-			{Uri: "at://did:web:flicknow.xyz/app.bsky.feed.generator/ceusemlimites"},
-			{Uri: "at://did:web:flicknow.xyz/app.bsky.feed.generator/dms"},
-			{Uri: "at://did:web:flicknow.xyz/app.bsky.feed.generator/firehose"},
-			{Uri: "at://did:web:flicknow.xyz/app.bsky.feed.generator/first20"},
-			{Uri: "at://did:web:flicknow.xyz/app.bsky.feed.generator/bangers"},
-			{Uri: "at://did:web:flicknow.xyz/app.bsky.feed.generator/birthdays"},
-			{Uri: "at://did:web:flicknow.xyz/app.bsky.feed.generator/f-birthdays"},
-			{Uri: "at://did:web:flicknow.xyz/app.bsky.feed.generator/gmgn"},
-			{Uri: "at://did:web:flicknow.xyz/app.bsky.feed.generator/f-gmgn"},
-			{Uri: "at://did:web:flicknow.xyz/app.bsky.feed.generator/lewds"},
-			{Uri: "at://did:web:flicknow.xyz/app.bsky.feed.generator/f-lewds"},
-			{Uri: "at://did:web:flicknow.xyz/app.bsky.feed.generator/mark"},
-			{Uri: "at://did:web:flicknow.xyz/app.bsky.feed.generator/mentions"},
-			{Uri: "at://did:web:flicknow.xyz/app.bsky.feed.generator/f-mentions"},
-			{Uri: "at://did:web:flicknow.xyz/app.bsky.feed.generator/newskies"},
-			{Uri: "at://did:web:flicknow.xyz/app.bsky.feed.generator/noskies"},
-			{Uri: "at://did:web:flicknow.xyz/app.bsky.feed.generator/quotes"},
-			{Uri: "at://did:web:flicknow.xyz/app.bsky.feed.generator/rembangs"},
-			{Uri: "at://did:web:flicknow.xyz/app.bsky.feed.generator/renewskies"},
-			{Uri: "at://did:web:flicknow.xyz/app.bsky.feed.generator/f-renewskies"},
-			{Uri: "at://did:web:flicknow.xyz/app.bsky.feed.generator/rude"},
-		}
+	mux.Handle("/metrics", metrics.Handler())
+	mux.HandleFunc("/.well-known/did.json", s.wellKnownDid)
+	xrpc.query("com.atproto.label.queryLabels", s.queryLabels)
 
-		newskies, err := s.Indexer.Db.Labels.SelectNewskieLabels()
-		if err != nil {
-			log.Printf("%+v\n", err)
-			ISE(w)
-			return
-		}
-		for _, newskie := range newskies {
-			uri := fmt.Sprintf("at://did:web:flicknow.xyz/app.bsky.feed.generator/%s", newskie.Name)
-			response.Feeds = append(response.Feeds, describeFeedGeneratorFeed{Uri: uri})
+	mux.HandleFunc("/admin/labels", s.adminLabels)
+	mux.HandleFunc("/admin/audit", s.adminAudit)
+	mux.HandleFunc("/admin/reports", s.adminReports)
+	mux.HandleFunc("/admin/reports/resolve", s.adminResolveReports)
+	mux.HandleFunc("/admin/feed-cache", s.adminFeedCache)
+
+	xrpc.procedure("com.atproto.moderation.createReport", s.createReport)
+
+	xrpc.query("app.bsky.feed.describeFeedGenerator", func(w http.ResponseWriter, r *http.Request) {
+		response := describeFeedGeneratorResponse{Did: s.feeds.Did}
+		response.Feeds = make([]describeFeedGeneratorFeed, 0, len(s.feeds.Feeds))
+		for _, feed := range s.feeds.Feeds {
+			if feed.Hidden {
+				continue
+			}
+			if !feed.IsPattern() {
+				response.Feeds = append(response.Feeds, describeFeedGeneratorFeed{Uri: s.feeds.Uri(feed.Name)})
+				continue
+			}
+
+			labels, err := s.Indexer.Db.Labels.SelectLabelsByPrefix(feed.Prefix())
+			if err != nil {
+				log.Printf("%+v\n", err)
+				writeXrpcError(w, 500, XrpcInternalServerError, "could not list feeds")
+				return
+			}
+			for _, label := range labels {
+				response.Feeds = append(response.Feeds, describeFeedGeneratorFeed{Uri: s.feeds.Uri(label.Name)})
+			}
 		}
 
 		b, err := json.Marshal(response)
 		if err != nil {
 			log.Printf("%+v\n", err)
-			ISE(w)
+			writeXrpcError(w, 500, XrpcInternalServerError, "could not list feeds")
 			return
 		}
 
@@ -1040,62 +1121,43 @@ func NewServer(ctx context.Context, indexer *indexer.Indexer) *Server {
 		w.Write(b)
 
 	})
-	mux.HandleFunc("/xrpc/app.bsky.feed.getFeedSkeleton", func(w http.ResponseWriter, r *http.Request) {
+	xrpc.procedure("app.bsky.feed.sendInteractions", s.sendInteractions)
+	xrpc.query("app.bsky.feed.getFeedSkeleton", func(w http.ResponseWriter, r *http.Request) {
 		query := r.URL.Query()
-		writeCorsHeaders(w, r)
 
-		did, err := getDidFromRequest(r)
+		did, err := s.viewerDid(r, "app.bsky.feed.getFeedSkeleton")
 		if err != nil {
 			log.Printf("jwt error: %+v\n", err)
 		}
-
-		start := time.Now().UTC()
-		defer func() {
-			delta := time.Now().UTC().Sub(start).Seconds()
-			if did != "" {
-				log.Printf("%s %s (%s) %vs\n", r.Method, r.URL.String(), did, delta)
-			} else {
-				log.Printf("%s %s %vs\n", r.Method, r.URL.String(), delta)
-			}
-		}()
-
-		feed := query.Get("feed")
-
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(200)
+		xrpcRequestFrom(r).Viewer = did
+		if !s.allowViewer(w, r, did) {
 			return
 		}
 
-		label := parseFeedAtUri(feed)
-		if (label == "newskies") || (label == "newsky") {
-			label = "newskie"
-		}
-		if label == "renewskies" {
-			label = "renewskie"
-		}
-
-		s.generateFeed(w, indexer, did, label, query.Get("cursor"), query.Get("limit"), pinnedPost)
-	})
-	mux.HandleFunc("/xrpc/app.bsky.unspecced.getPopular", func(w http.ResponseWriter, r *http.Request) {
-		query := r.URL.Query()
-		writeCorsHeaders(w, r)
-
-		log.Printf("%s %s\n", r.Method, r.URL.String())
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(200)
+		name, err := parseFeedUri(query.Get("feed"))
+		if err != nil {
+			writeXrpcErr(w, err)
 			return
 		}
 
-		did, err := getDidFromRequest(r)
+		s.serveFeed(w, r, indexer, did, name, pinnedPost)
+	})
+	xrpc.query("app.bsky.unspecced.getPopular", func(w http.ResponseWriter, r *http.Request) {
+		did, err := s.viewerDid(r, "app.bsky.unspecced.getPopular")
 		if err != nil {
 			log.Printf("jwt error: %+v\n", err)
 		}
+		xrpcRequestFrom(r).Viewer = did
+		if !s.allowViewer(w, r, did) {
+			return
+		}
 
-		s.generateFeed(w, indexer, did, query.Get("label"), query.Get("cursor"), query.Get("limit"), pinnedPost)
+		s.serveFeed(w, r, indexer, did, r.URL.Query().Get("label"), pinnedPost)
 	})
+	mux.Handle("/xrpc/", xrpc)
 
-	s.server = &http.Server{Addr: addr, Handler: mux}
-	return s
+	s.server = &http.Server{Addr: addr, Handler: s.rateLimit(mux)}
+	return s, nil
 }
 
 var ServerCmd = &cli.Command{
@@ -1115,7 +1177,10 @@ var ServerCmd = &cli.Command{
 			return err
 		}
 
-		server := NewServer(cmd.ToContext(cctx), indexer)
+		server, err := NewServer(cmd.ToContext(cctx), indexer)
+		if err != nil {
+			return err
+		}
 		go server.Serve()
 		defer server.Shutdown(context.Background())
 
@@ -1123,167 +1188,3 @@ var ServerCmd = &cli.Command{
 		return ctx.Err()
 	},
 }
-
-type QuotesHtmlParams struct {
-	Error string
-	Form  bool
-	Posts []string
-	Url   string
-}
-
-var QuotesHtmlTemplateText = `
-<!doctype html>
-<html lang="en">
-	<head>
-		<meta charset="utf-8" />
-		<meta name="viewport" content="width=device-width, initial-scale=1.0" />
-		<title>Bluesky quotes</title>
-		<style>
-			:root {
-				--background-primary: #fafafa;
-				--background-secondary: #e5e5e5;
-				--text-primary: #000000;
-				--text-link: #1d4ed8;
-				--divider: #c8c8c8;
-			}
-
-			@media (prefers-color-scheme: dark) {
-				:root {
-					--background-primary: #0a0a0a;
-					--background-secondary: #171717;
-					--text-primary: #ffffff;
-					--text-link: #60a5fa;
-					--divider: #404040;
-				}
-			}
-
-			html {
-				background: var(--background-primary);
-				color: var(--text-primary);
-				color-scheme: light dark;
-				font-size: 14px;
-				line-height: 1.25rem;
-				font-family:
-					system-ui,
-					-apple-system,
-					BlinkMacSystemFont,
-					'Segoe UI',
-					Roboto,
-					Oxygen,
-					Ubuntu,
-					Cantarell,
-					'Open Sans',
-					'Helvetica Neue',
-					sans-serif;
-			}
-
-			body {
-				margin: 24px auto;
-				padding: 0 16px;
-				max-width: 680px;
-			}
-
-			h1,
-			h2,
-			h3,
-			h4,
-			h5,
-			h6,
-			p {
-				margin-block-start: 1.1rem;
-				margin-block-end: 1.1rem;
-			}
-
-			h1 {
-				font-size: 1.25rem;
-			}
-			h2 {
-				font-size: 1.125rem;
-			}
-
-			a {
-				color: var(--text-link);
-			}
-
-			pre {
-				border-radius: 4px;
-				background: var(--background-secondary);
-				padding: 8px;
-				overflow-x: auto;
-				font-size: 12px;
-			}
-
-			bluesky-post {
-				--font-size: 16px;
-				margin: 16px auto;
-			}
-
-			.bluesky-post-fallback {
-				margin: 16px 0;
-				border-left: 3px solid var(--divider);
-				padding: 4px 8px;
-			}
-			.bluesky-post-fallback p {
-				margin: 0 0 8px 0;
-			}
-		</style>
-		<script type="module" src="https://esm.sh/bluesky-post-embed@~0.1.0"></script>
-		<script type="module">
-			const dark = matchMedia('(prefers-color-scheme: dark)');
-
-			const update_theme = () => {
-				const is_dark = dark.matches;
-
-				for (const node of document.querySelectorAll('bluesky-post')) {
-					node.setAttribute('theme', !is_dark ? 'light' : 'dark');
-				}
-			};
-
-			update_theme();
-			dark.addEventListener('change', update_theme);
-		</script>
-	</head>
-	<body>
-		{{ if .Form }}
-		<form method="post" id="quotes">
-			<label for="url">Bluesky Post URL:</label>
-			<input type="text" id="url" name="url">
-			<button type="submit">Lookup Quotes!</button>
-		</form>
-		<script>
-			const formElement = document.forms['quotes'];
-
-			function lookupQuotes (e) {
-				e.preventDefault();
-
-				const data = new FormData(e.target);
-				const url = data.get("url");
-
-				formElement.action = document.location.href + url
-				formElement.removeEventListener('submit', lookupQuotes);
-				formElement.submit();
-			}
-
-			formElement.addEventListener('submit', lookupQuotes);
-		</script>
-		{{ else }}
-		{{ if .Url }}
-		<h1>Quote Posts for {{.Url}}</h1>
-		{{ end }}
-		{{ if .Error }}
-		<div>
-			Error looking up quotes:
-			<pre>{{ .Error }}</pre>
-		</div>
-		{{ end }}
-		{{ if .Posts }}
-		{{ range .Posts }}
-		<bluesky-post src="{{ . }}"></bluesky-post>
-		{{ end }}
-		{{ else if not .Error }}
-		<div>No quotes found yet</div>
-		{{ end }}
-		{{ end }}
-	</body>
-</html>
-`
@@ -0,0 +1,115 @@
+package blueskybot
+
+import (
+	"context"
+	"fmt"
+	"os/signal"
+	"syscall"
+	"time"
+
+	indigocrypto "github.com/bluesky-social/indigo/atproto/crypto"
+	"github.com/flicknow/go-bluesky-bot/pkg/cmd"
+	"github.com/flicknow/go-bluesky-bot/pkg/dbx"
+	"github.com/flicknow/go-bluesky-bot/pkg/identity"
+	"github.com/flicknow/go-bluesky-bot/pkg/sleeper"
+	cli "github.com/urfave/cli/v2"
+)
+
+var VerifyLabelsCmd = &cli.Command{
+	Name:  "verify-labels",
+	Usage: "check custom label signatures against the published or retired key each was signed with",
+	Flags: cmd.CombineFlags(
+		cmd.WithDb,
+		&cli.IntFlag{
+			Name:  "chunk",
+			Usage: "chunk size",
+			Value: 500,
+		},
+		&cli.Int64Flag{
+			Name:  "pause",
+			Usage: "number of milliseconds to pause between chunks",
+			Value: 0,
+		},
+		&cli.StringFlag{
+			Name:  "key",
+			Usage: "did:key to verify against instead of the one in the labeler's did document",
+		},
+	),
+	Action: func(cctx *cli.Context) error {
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGQUIT, syscall.SIGTERM)
+		defer stop()
+
+		sleeper := sleeper.NewSleeper(ctx)
+		shutdown := false
+		go func() {
+			<-ctx.Done()
+			shutdown = true
+		}()
+
+		resolver := identity.NewResolver(identity.NewConfig(cmd.ToContext(cctx)))
+
+		var pub indigocrypto.PublicKey
+		var err error
+		if didKey := cctx.String("key"); didKey != "" {
+			pub, err = indigocrypto.ParsePublicDIDKey(didKey)
+		} else {
+			pub, err = labelerKeyLookup(resolver)(LabelerDid)
+		}
+		if err != nil {
+			return err
+		}
+
+		d := dbx.NewDBx(cmd.ToContext(cctx))
+		defer d.Close()
+
+		fmt.Printf("> verifying labels against %s and %d retired keys\n", pub.DIDKey(), len(d.SigningKeys.Retired))
+		if pub.DIDKey() != d.SigningKey.KeyId() {
+			fmt.Printf("> WARNING configured signing key %s does not match\n", d.SigningKey.KeyId())
+		}
+
+		chunk := cctx.Int("chunk")
+		pause := cctx.Int64("pause")
+		total := 0
+		bad := 0
+		undecodable := 0
+		var cursor int64 = 0
+
+	VERIFY:
+		for {
+			if shutdown {
+				break VERIFY
+			}
+
+			var checked int
+			var failures []*dbx.LabelVerificationFailure
+			cursor, checked, failures, err = d.VerifyLabels(pub, cursor, chunk)
+			if err != nil {
+				return err
+			}
+
+			total += checked
+			for _, failure := range failures {
+				if failure.Label == nil {
+					undecodable++
+					fmt.Printf("custom_label_id=%d key_id=%s %+v\n", failure.Row.CustomLabelId, failure.Row.KeyId, failure.Err)
+				} else {
+					bad++
+					fmt.Printf("custom_label_id=%d key_id=%s uri=%s val=%s %+v\n", failure.Row.CustomLabelId, failure.Row.KeyId, failure.Label.Uri, failure.Label.Val, failure.Err)
+				}
+			}
+
+			if checked < chunk {
+				break VERIFY
+			}
+
+			sleeper.Sleep(time.Duration(pause) * time.Millisecond)
+		}
+
+		fmt.Printf("> checked %d labels: %d bad signatures, %d undecodable\n", total, bad, undecodable)
+		if (bad + undecodable) > 0 {
+			return fmt.Errorf("found %d labels that failed verification", bad+undecodable)
+		}
+
+		return nil
+	},
+}
@@ -0,0 +1,213 @@
+package blueskybot
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	XrpcInvalidRequest       = "InvalidRequest"
+	XrpcAuthRequired         = "AuthRequired"
+	XrpcUnknownFeed          = "UnknownFeed"
+	XrpcMethodNotImplemented = "MethodNotImplemented"
+	XrpcInternalServerError  = "InternalServerError"
+	XrpcRateLimitExceeded    = "RateLimitExceeded"
+	XrpcServiceUnavailable   = "ServiceUnavailable"
+)
+
+var feedUriRegex = regexp.MustCompile(`^at://(did:[a-z]+:[a-zA-Z0-9._:%-]+)/app\.bsky\.feed\.generator/([a-zA-Z0-9._~:-]{1,512})$`)
+
+type xrpcErrorResponse struct {
+	Error   string `json:"error"`
+	Message string `json:"message,omitempty"`
+}
+
+type xrpcError struct {
+	Status  int
+	Name    string
+	Message string
+}
+
+func (e *xrpcError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Name, e.Message)
+}
+
+func errInvalidRequest(format string, args ...any) *xrpcError {
+	return &xrpcError{Status: 400, Name: XrpcInvalidRequest, Message: fmt.Sprintf(format, args...)}
+}
+
+func writeXrpcError(w http.ResponseWriter, status int, name string, message string) {
+	b, _ := json.Marshal(&xrpcErrorResponse{Error: name, Message: message})
+	w.Header().Add("content-type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(b)
+}
+
+func (e *xrpcError) write(w http.ResponseWriter) {
+	writeXrpcError(w, e.Status, e.Name, e.Message)
+}
+
+// xrpcRequest is attached to the context of requests dispatched by the
+// router, so handlers can note the verified viewer for the request log.
+type xrpcRequest struct {
+	Nsid   string
+	Viewer string
+}
+
+type xrpcRequestKey struct{}
+
+func xrpcRequestFrom(r *http.Request) *xrpcRequest {
+	req, ok := r.Context().Value(xrpcRequestKey{}).(*xrpcRequest)
+	if !ok {
+		return &xrpcRequest{}
+	}
+	return req
+}
+
+type xrpcRoute struct {
+	method string
+	cors   bool
+	handle http.HandlerFunc
+}
+
+// xrpcRouter dispatches /xrpc/ requests by NSID, answering preflights and
+// requests with the wrong http method itself.
+type xrpcRouter struct {
+	routes map[string]*xrpcRoute
+}
+
+func newXrpcRouter() *xrpcRouter {
+	return &xrpcRouter{routes: make(map[string]*xrpcRoute)}
+}
+
+func (x *xrpcRouter) query(nsid string, handle http.HandlerFunc) {
+	x.routes[nsid] = &xrpcRoute{method: "GET", cors: true, handle: handle}
+}
+
+func (x *xrpcRouter) procedure(nsid string, handle http.HandlerFunc) {
+	x.routes[nsid] = &xrpcRoute{method: "POST", cors: true, handle: handle}
+}
+
+func (x *xrpcRouter) subscription(nsid string, handle http.HandlerFunc) {
+	x.routes[nsid] = &xrpcRoute{method: "GET", handle: handle}
+}
+
+func (x *xrpcRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	nsid := strings.TrimPrefix(r.URL.Path, "/xrpc/")
+	req := &xrpcRequest{Nsid: nsid}
+	sw := &statusWriter{ResponseWriter: w}
+
+	start := time.Now()
+	defer func() {
+		viewer := ""
+		if req.Viewer != "" {
+			viewer = fmt.Sprintf(" (%s)", req.Viewer)
+		}
+		log.Printf("%s %s %d%s %vs\n", r.Method, r.URL.String(), sw.status, viewer, time.Since(start).Seconds())
+	}()
+
+	route := x.routes[nsid]
+	if route == nil {
+		writeXrpcError(sw, 501, XrpcMethodNotImplemented, fmt.Sprintf("%s is not implemented", nsid))
+		return
+	}
+
+	if route.cors {
+		sw.Header().Add("Access-Control-Allow-Origin", r.Header.Get("Origin"))
+		sw.Header().Add("Access-Control-Allow-Methods", route.method)
+		sw.Header().Add("Access-Control-Allow-Headers", "*")
+		if r.Method == "OPTIONS" {
+			sw.WriteHeader(200)
+			return
+		}
+	}
+
+	if (r.Method != route.method) && !((route.method == "GET") && (r.Method == "HEAD")) {
+		writeXrpcError(sw, 405, XrpcInvalidRequest, fmt.Sprintf("%s must be called with %s", nsid, route.method))
+		return
+	}
+
+	route.handle(sw, r.WithContext(context.WithValue(r.Context(), xrpcRequestKey{}, req)))
+}
+
+// statusWriter remembers the status written for the request log. It passes
+// hijacking through so subscriptions can still upgrade to websockets.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sw *statusWriter) WriteHeader(status int) {
+	if sw.status == 0 {
+		sw.status = status
+	}
+	sw.ResponseWriter.WriteHeader(status)
+}
+
+func (sw *statusWriter) Write(b []byte) (int, error) {
+	if sw.status == 0 {
+		sw.status = 200
+	}
+	return sw.ResponseWriter.Write(b)
+}
+
+func (sw *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := sw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer does not support hijacking")
+	}
+	sw.status = 101
+	return hijacker.Hijack()
+}
+
+// parseXrpcLimit reads the limit parameter, which must be between 1 and max
+// when given.
+func parseXrpcLimit(query url.Values, def int, max int) (int, error) {
+	limitStr := query.Get("limit")
+	if limitStr == "" {
+		return def, nil
+	}
+
+	limit, err := strconv.Atoi(limitStr)
+	if (err != nil) || (limit < 1) || (limit > max) {
+		return 0, errInvalidRequest("limit must be an integer between 1 and %d", max)
+	}
+	return limit, nil
+}
+
+// parseFeedUri checks a feed generator at-uri, returning the feed's name.
+func parseFeedUri(uri string) (string, error) {
+	if uri == "" {
+		return "", errInvalidRequest("feed is required")
+	}
+
+	match := feedUriRegex.FindStringSubmatch(uri)
+	if match == nil {
+		return "", errInvalidRequest("feed must be an app.bsky.feed.generator at-uri")
+	}
+	return match[2], nil
+}
+
+// writeXrpcErr writes err as an xrpc error, hiding anything unexpected
+// behind a generic InternalServerError.
+func writeXrpcErr(w http.ResponseWriter, err error) {
+	var xerr *xrpcError
+	if errors.As(err, &xerr) {
+		xerr.write(w)
+		return
+	}
+
+	log.Printf("%+v\n", err)
+	writeXrpcError(w, 500, XrpcInternalServerError, "internal error")
+}
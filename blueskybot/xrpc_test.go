@@ -0,0 +1,136 @@
+package blueskybot
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func decodeXrpcError(t *testing.T, w *httptest.ResponseRecorder) *xrpcErrorResponse {
+	assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("content-type"))
+
+	res := &xrpcErrorResponse{}
+	err := json.Unmarshal(w.Body.Bytes(), res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func TestXrpcRouter(t *testing.T) {
+	x := newXrpcRouter()
+	ok := func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "app.bsky.feed.getFeedSkeleton", xrpcRequestFrom(r).Nsid, r.Method)
+		w.WriteHeader(200)
+	}
+	x.query("app.bsky.feed.getFeedSkeleton", ok)
+	x.procedure("app.bsky.feed.sendInteractions", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	})
+
+	tests := []struct {
+		method string
+		nsid   string
+		status int
+		error  string
+	}{
+		{method: "GET", nsid: "app.bsky.feed.getFeedSkeleton", status: 200},
+		{method: "HEAD", nsid: "app.bsky.feed.getFeedSkeleton", status: 200},
+		{method: "POST", nsid: "app.bsky.feed.getFeedSkeleton", status: 405, error: XrpcInvalidRequest},
+		{method: "POST", nsid: "app.bsky.feed.sendInteractions", status: 200},
+		{method: "GET", nsid: "app.bsky.feed.sendInteractions", status: 405, error: XrpcInvalidRequest},
+		{method: "HEAD", nsid: "app.bsky.feed.sendInteractions", status: 405, error: XrpcInvalidRequest},
+		{method: "GET", nsid: "app.bsky.feed.getTimeline", status: 501, error: XrpcMethodNotImplemented},
+	}
+
+	for _, test := range tests {
+		name := fmt.Sprintf("%s %s", test.method, test.nsid)
+		w := httptest.NewRecorder()
+		x.ServeHTTP(w, httptest.NewRequest(test.method, "/xrpc/"+test.nsid, nil))
+		assert.Equal(t, test.status, w.Code, name)
+		if test.error != "" {
+			assert.Equal(t, test.error, decodeXrpcError(t, w).Error, name)
+		}
+	}
+}
+
+func TestXrpcRouterPreflight(t *testing.T) {
+	x := newXrpcRouter()
+	x.procedure("app.bsky.feed.sendInteractions", func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("preflights don't reach the handler")
+	})
+
+	r := httptest.NewRequest("OPTIONS", "/xrpc/app.bsky.feed.sendInteractions", nil)
+	r.Header.Set("Origin", "https://bsky.app")
+	w := httptest.NewRecorder()
+	x.ServeHTTP(w, r)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "https://bsky.app", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "POST", w.Header().Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Headers"))
+	assert.Empty(t, w.Body.String())
+}
+
+func TestParseXrpcLimit(t *testing.T) {
+	tests := []struct {
+		limit string
+		want  int
+		ok    bool
+	}{
+		{limit: "", want: 30, ok: true},
+		{limit: "1", want: 1, ok: true},
+		{limit: "100", want: 100, ok: true},
+		{limit: "0"},
+		{limit: "101"},
+		{limit: "-1"},
+		{limit: "ten"},
+	}
+
+	for _, test := range tests {
+		limit, err := parseXrpcLimit(url.Values{"limit": []string{test.limit}}, 30, 100)
+		if test.ok {
+			assert.Nil(t, err, test.limit)
+			assert.Equal(t, test.want, limit, test.limit)
+			continue
+		}
+
+		w := httptest.NewRecorder()
+		writeXrpcErr(w, err)
+		assert.Equal(t, 400, w.Code, test.limit)
+		assert.Equal(t, &xrpcErrorResponse{Error: XrpcInvalidRequest, Message: "limit must be an integer between 1 and 100"}, decodeXrpcError(t, w), test.limit)
+	}
+}
+
+func TestParseFeedUri(t *testing.T) {
+	tests := []struct {
+		uri     string
+		name    string
+		message string
+	}{
+		{uri: "at://did:web:flicknow.xyz/app.bsky.feed.generator/bangers", name: "bangers"},
+		{uri: "at://did:plc:jcce2sa3fgue4wiocvf7e7xj/app.bsky.feed.generator/f-lewds", name: "f-lewds"},
+		{uri: "", message: "feed is required"},
+		{uri: "at://did:web:flicknow.xyz/app.bsky.feed.post/bangers", message: "feed must be an app.bsky.feed.generator at-uri"},
+		{uri: "at://did:web:flicknow.xyz/app.bsky.feed.generator/", message: "feed must be an app.bsky.feed.generator at-uri"},
+		{uri: "bangers", message: "feed must be an app.bsky.feed.generator at-uri"},
+	}
+
+	for _, test := range tests {
+		name, err := parseFeedUri(test.uri)
+		if test.message == "" {
+			assert.Nil(t, err, test.uri)
+			assert.Equal(t, test.name, name, test.uri)
+			continue
+		}
+
+		w := httptest.NewRecorder()
+		writeXrpcErr(w, err)
+		assert.Equal(t, 400, w.Code, test.uri)
+		assert.Equal(t, &xrpcErrorResponse{Error: XrpcInvalidRequest, Message: test.message}, decodeXrpcError(t, w), test.uri)
+	}
+}
@@ -35,9 +35,14 @@ func main() {
 		blueskybot.MigrateCmd,
 		blueskybot.MigrateListCmd,
 		blueskybot.PruneCmd,
+		blueskybot.PublishLabelerCmd,
+		blueskybot.ReportsCmd,
 		blueskybot.RequeueCmd,
+		blueskybot.ResignLabelsCmd,
+		blueskybot.RulesCmd,
 		blueskybot.ServerCmd,
 		blueskybot.SubscribeLabelsCmd,
+		blueskybot.VerifyLabelsCmd,
 	}
 
 	go func() {
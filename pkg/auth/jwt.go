@@ -0,0 +1,262 @@
+package auth
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bluesky-social/indigo/atproto/crypto"
+	"github.com/flicknow/go-bluesky-bot/pkg/identity"
+)
+
+var ErrMissingToken = errors.New("missing bearer token")
+var ErrInvalidToken = errors.New("invalid token")
+
+type KeyResolver func(ctx context.Context, did string) (crypto.PublicKey, error)
+
+type Header struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ,omitempty"`
+}
+
+type Claims struct {
+	Iss string `json:"iss"`
+	Aud string `json:"aud"`
+	Exp int64  `json:"exp"`
+	Iat int64  `json:"iat,omitempty"`
+	Lxm string `json:"lxm,omitempty"`
+	Jti string `json:"jti,omitempty"`
+}
+
+// Did is the issuer without any service fragment, ie did:plc:xyz#atproto_labeler
+// becomes did:plc:xyz.
+func (c *Claims) Did() string {
+	did, _, _ := strings.Cut(c.Iss, "#")
+	return did
+}
+
+// RefreshInterval limits how often a forged or stale token can make us
+// refetch an issuer's key.
+var RefreshInterval = time.Minute
+
+type Verifier struct {
+	resolve     KeyResolver
+	refresh     KeyResolver
+	now         func() time.Time
+	refreshmu   sync.Mutex
+	refreshedAt map[string]time.Time
+}
+
+func NewVerifier(resolve KeyResolver) *Verifier {
+	return &Verifier{resolve: resolve, now: time.Now, refreshedAt: make(map[string]time.Time)}
+}
+
+// NewDirectoryVerifier resolves keys through the shared identity resolver,
+// and when a signature doesn't match a cached key, purges the issuer and
+// tries once more in case they rotated their key.
+func NewDirectoryVerifier(resolver *identity.Resolver) *Verifier {
+	v := NewVerifier(DirectoryKeyResolver(resolver))
+	v.refresh = func(ctx context.Context, did string) (crypto.PublicKey, error) {
+		resolver.Purge(did)
+		return v.resolve(ctx, did)
+	}
+	return v
+}
+
+// WithRefresh sets how keys are looked up again after a signature fails to
+// verify against the first resolved key.
+func (v *Verifier) WithRefresh(refresh KeyResolver) *Verifier {
+	v.refresh = refresh
+	return v
+}
+
+func BearerToken(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if len(header) < 7 || !strings.EqualFold(header[:7], "bearer ") {
+		return ""
+	}
+	return strings.TrimSpace(header[7:])
+}
+
+func decodeSegment(segment string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+func ParseUnverified(token string) (*Header, *Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, nil, fmt.Errorf("%w: expected 3 segments, found %d", ErrInvalidToken, len(parts))
+	}
+
+	header := &Header{}
+	err := decodeSegment(parts[0], header)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: could not decode header: %w", ErrInvalidToken, err)
+	}
+
+	claims := &Claims{}
+	err = decodeSegment(parts[1], claims)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: could not decode claims: %w", ErrInvalidToken, err)
+	}
+
+	return header, claims, nil
+}
+
+// Verify checks the token's signature against the issuer's atproto signing
+// key, that it was issued for aud and hasn't expired, and when lxm is set,
+// that the token is bound to that method. Tokens without an lxm are only
+// accepted when the caller doesn't ask for one.
+func (v *Verifier) Verify(ctx context.Context, token string, aud string, lxm string) (*Claims, error) {
+	if token == "" {
+		return nil, ErrMissingToken
+	}
+
+	header, claims, err := ParseUnverified(token)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.Iss == "" {
+		return nil, fmt.Errorf("%w: missing iss", ErrInvalidToken)
+	}
+	if (aud != "") && (claims.Aud != aud) && !strings.HasPrefix(claims.Aud, aud+"#") {
+		return nil, fmt.Errorf("%w: aud %s does not match %s", ErrInvalidToken, claims.Aud, aud)
+	}
+	if (lxm != "") && (claims.Lxm != lxm) {
+		return nil, fmt.Errorf("%w: lxm %s does not match %s", ErrInvalidToken, claims.Lxm, lxm)
+	}
+	if claims.Exp == 0 {
+		return nil, fmt.Errorf("%w: missing exp", ErrInvalidToken)
+	}
+	if v.now().Unix() >= claims.Exp {
+		return nil, fmt.Errorf("%w: token expired", ErrInvalidToken)
+	}
+
+	i := strings.LastIndex(token, ".")
+	sig, err := base64.RawURLEncoding.DecodeString(token[i+1:])
+	if err != nil {
+		return nil, fmt.Errorf("%w: could not decode signature: %w", ErrInvalidToken, err)
+	}
+
+	key, err := v.resolve(ctx, claims.Did())
+	if err != nil {
+		return nil, fmt.Errorf("could not resolve signing key for %s: %w", claims.Did(), err)
+	}
+
+	err = verifySignature(header, claims, key, []byte(token[:i]), sig)
+	if errors.Is(err, ErrInvalidToken) && v.shouldRefresh(claims.Did()) {
+		key, err = v.refresh(ctx, claims.Did())
+		if err != nil {
+			return nil, fmt.Errorf("could not refresh signing key for %s: %w", claims.Did(), err)
+		}
+		err = verifySignature(header, claims, key, []byte(token[:i]), sig)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+func (v *Verifier) shouldRefresh(did string) bool {
+	if v.refresh == nil {
+		return false
+	}
+
+	v.refreshmu.Lock()
+	defer v.refreshmu.Unlock()
+
+	now := v.now()
+	for d, at := range v.refreshedAt {
+		if now.Sub(at) >= RefreshInterval {
+			delete(v.refreshedAt, d)
+		}
+	}
+	if _, ok := v.refreshedAt[did]; ok {
+		return false
+	}
+	v.refreshedAt[did] = now
+
+	return true
+}
+
+func verifySignature(header *Header, claims *Claims, key crypto.PublicKey, signed []byte, sig []byte) error {
+	switch header.Alg {
+	case "ES256K":
+		if _, ok := key.(*crypto.PublicKeyK256); !ok {
+			return fmt.Errorf("%w: %s signing key is not a K-256 key", ErrInvalidToken, claims.Did())
+		}
+	case "ES256":
+		if _, ok := key.(*crypto.PublicKeyP256); !ok {
+			return fmt.Errorf("%w: %s signing key is not a P-256 key", ErrInvalidToken, claims.Did())
+		}
+	default:
+		return fmt.Errorf("%w: unsupported alg %q", ErrInvalidToken, header.Alg)
+	}
+
+	err := key.HashAndVerifyLenient(signed, sig)
+	if err != nil {
+		return fmt.Errorf("%w: bad signature: %w", ErrInvalidToken, err)
+	}
+
+	return nil
+}
+
+// Sign creates a service-auth token, mostly useful for tests and for
+// talking to our own admin api.
+func Sign(key crypto.PrivateKey, claims *Claims) (string, error) {
+	alg := ""
+	switch key.(type) {
+	case *crypto.PrivateKeyK256:
+		alg = "ES256K"
+	case *crypto.PrivateKeyP256:
+		alg = "ES256"
+	default:
+		return "", fmt.Errorf("unsupported private key type %T", key)
+	}
+
+	header, err := json.Marshal(&Header{Alg: alg, Typ: "JWT"})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	sig, err := key.HashAndSign([]byte(signed))
+	if err != nil {
+		return "", err
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// DirectoryKeyResolver resolves an issuer's #atproto signing key through the
+// identity resolver.
+func DirectoryKeyResolver(resolver *identity.Resolver) KeyResolver {
+	return func(ctx context.Context, did string) (crypto.PublicKey, error) {
+		doc, err := resolver.ResolveDid(ctx, did)
+		if err != nil {
+			return nil, err
+		}
+
+		method := doc.VerificationMethod("atproto")
+		if method == nil {
+			return nil, fmt.Errorf("could not find #atproto verification method for %s", did)
+		}
+		return crypto.ParsePublicMultibase(method.PublicKeyMultibase)
+	}
+}
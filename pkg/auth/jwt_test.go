@@ -0,0 +1,194 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bluesky-social/indigo/atproto/crypto"
+	"github.com/flicknow/go-bluesky-bot/pkg/identity"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestVerifier(t *testing.T) (*Verifier, crypto.PrivateKey) {
+	priv, err := crypto.GeneratePrivateKeyK256()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := priv.PublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return NewVerifier(func(ctx context.Context, did string) (crypto.PublicKey, error) {
+		if did != "did:plc:issuer" {
+			return nil, errors.New("unknown did")
+		}
+		return pub, nil
+	}), priv
+}
+
+func TestVerify(t *testing.T) {
+	v, priv := newTestVerifier(t)
+
+	token, err := Sign(priv, &Claims{Iss: "did:plc:issuer#atproto_labeler", Aud: "did:web:example.com", Exp: time.Now().Add(time.Minute).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := v.Verify(context.Background(), token, "did:web:example.com", "")
+	assert.Nil(t, err)
+	assert.Equal(t, "did:plc:issuer", claims.Did())
+
+	_, err = v.Verify(context.Background(), token, "did:web:other.com", "")
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	_, err = v.Verify(context.Background(), token, "did:web:example.com", "com.atproto.moderation.createReport")
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	token, err = Sign(priv, &Claims{Iss: "did:plc:issuer", Aud: "did:web:example.com#atproto_labeler", Exp: time.Now().Add(time.Minute).Unix(), Lxm: "com.atproto.moderation.createReport"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = v.Verify(context.Background(), token, "did:web:example.com", "com.atproto.moderation.createReport")
+	assert.Nil(t, err)
+
+	_, err = v.Verify(context.Background(), token, "did:web:example.com", "app.bsky.feed.getFeedSkeleton")
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	_, err = v.Verify(context.Background(), token[:len(token)-4]+"AAAA", "did:web:example.com", "")
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	_, err = v.Verify(context.Background(), "", "did:web:example.com", "")
+	assert.ErrorIs(t, err, ErrMissingToken)
+}
+
+func TestVerifyExpired(t *testing.T) {
+	v, priv := newTestVerifier(t)
+
+	token, err := Sign(priv, &Claims{Iss: "did:plc:issuer", Aud: "did:web:example.com", Exp: time.Now().Add(-time.Minute).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = v.Verify(context.Background(), token, "did:web:example.com", "")
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestVerifyWrongKey(t *testing.T) {
+	v, _ := newTestVerifier(t)
+
+	other, err := crypto.GeneratePrivateKeyP256()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := Sign(other, &Claims{Iss: "did:plc:issuer", Aud: "did:web:example.com", Exp: time.Now().Add(time.Minute).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = v.Verify(context.Background(), token, "did:web:example.com", "")
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestVerifyRefreshesRotatedKey(t *testing.T) {
+	old, err := crypto.GeneratePrivateKeyK256()
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldPub, err := old.PublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotated, err := crypto.GeneratePrivateKeyK256()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotatedPub, err := rotated.PublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	refreshes := 0
+	v := NewVerifier(func(ctx context.Context, did string) (crypto.PublicKey, error) {
+		return oldPub, nil
+	}).WithRefresh(func(ctx context.Context, did string) (crypto.PublicKey, error) {
+		refreshes++
+		return rotatedPub, nil
+	})
+
+	token, err := Sign(rotated, &Claims{Iss: "did:plc:issuer", Aud: "did:web:example.com", Exp: time.Now().Add(time.Minute).Unix(), Lxm: "app.bsky.feed.getFeedSkeleton"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = v.Verify(context.Background(), token, "did:web:example.com", "app.bsky.feed.getFeedSkeleton")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, refreshes)
+
+	forged, err := crypto.GeneratePrivateKeyK256()
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err = Sign(forged, &Claims{Iss: "did:plc:issuer", Aud: "did:web:example.com", Exp: time.Now().Add(time.Minute).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = v.Verify(context.Background(), token, "did:web:example.com", "")
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	assert.Equal(t, 1, refreshes)
+}
+
+func TestDirectoryVerifier(t *testing.T) {
+	dir, cleanup := identity.NewTestDirectory()
+	defer cleanup()
+
+	publish := func(priv crypto.PrivateKey) {
+		pub, err := priv.PublicKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		dir.AddDocument(&identity.Document{
+			Id: "did:plc:issuer",
+			VerificationMethods: []*identity.VerificationMethod{
+				{Id: "did:plc:issuer#atproto", Type: "Multikey", Controller: "did:plc:issuer", PublicKeyMultibase: pub.Multibase()},
+			},
+		})
+	}
+
+	old, err := crypto.GeneratePrivateKeyK256()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotated, err := crypto.GeneratePrivateKeyK256()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v := NewDirectoryVerifier(dir.Resolver)
+
+	publish(old)
+	token, err := Sign(old, &Claims{Iss: "did:plc:issuer", Aud: "did:web:example.com", Exp: time.Now().Add(time.Minute).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := v.Verify(context.Background(), token, "did:web:example.com", "")
+	assert.Nil(t, err)
+	assert.Equal(t, "did:plc:issuer", claims.Did())
+
+	publish(rotated)
+	token, err = Sign(rotated, &Claims{Iss: "did:plc:issuer", Aud: "did:web:example.com", Exp: time.Now().Add(time.Minute).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = v.Verify(context.Background(), token, "did:web:example.com", "")
+	assert.Nil(t, err)
+
+	_, err = v.Verify(context.Background(), token, "did:web:example.com", "")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), dir.Requests.Load())
+}
@@ -41,6 +41,7 @@ type Client interface {
 	GetPosts(uris []string) ([]appbsky.FeedDefs_PostView, error)
 	GetRecord(uri string, cid string) (*comatproto.RepoGetRecord_Output, error)
 	Like(ref *comatproto.RepoStrongRef) (*comatproto.RepoCreateRecord_Output, error)
+	PutRecord(collection string, rkey string, record *lexutil.LexiconTypeDecoder) (*comatproto.RepoPutRecord_Output, error)
 	Reply(text string, ref *comatproto.RepoStrongRef) (*comatproto.RepoCreateRecord_Output, error)
 }
 type defaultClient struct {
@@ -446,6 +447,42 @@ func (c *defaultClient) Like(ref *comatproto.RepoStrongRef) (*comatproto.RepoCre
 	})
 }
 
+func (c *defaultClient) PutRecord(collection string, rkey string, record *lexutil.LexiconTypeDecoder) (*comatproto.RepoPutRecord_Output, error) {
+	if c.dryrun {
+		log.Printf("DRY-RUN: would have put %s/%s", collection, rkey)
+	}
+
+	c.reqmu.Lock()
+	defer c.reqmu.Unlock()
+
+	if c.dryrun {
+		return &comatproto.RepoPutRecord_Output{}, nil
+	}
+
+	input := &comatproto.RepoPutRecord_Input{
+		Collection: collection,
+		Repo:       c.xrpcc.Auth.Did,
+		Rkey:       rkey,
+		Record:     record,
+	}
+
+	ctx := c.intrcptrContext()
+	output, err := comatproto.RepoPutRecord(ctx, c.xrpcc, input)
+	if err != nil {
+		c.Refresh()
+		output, err = comatproto.RepoPutRecord(ctx, c.xrpcc, input)
+	}
+	if err != nil {
+		res := intrcptrRes(ctx)
+		if res != nil {
+			fmt.Print(dumpInterceptor(ctx))
+		}
+		return nil, err
+	}
+
+	return output, nil
+}
+
 func (c *defaultClient) Reply(text string, ref *comatproto.RepoStrongRef) (*comatproto.RepoCreateRecord_Output, error) {
 	if c.dryrun {
 		log.Printf("DRY-RUN: would have replied to %s", ref.Uri)
@@ -5,6 +5,7 @@ import (
 
 	comatproto "github.com/bluesky-social/indigo/api/atproto"
 	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	lexutil "github.com/bluesky-social/indigo/lex/util"
 	"github.com/flicknow/go-bluesky-bot/pkg/utils"
 )
 
@@ -22,6 +23,7 @@ type mockClient struct {
 	MockGetPosts      func(uris []string) ([]appbsky.FeedDefs_PostView, error)
 	MockGetRecord     func(uri string, cid string) (*comatproto.RepoGetRecord_Output, error)
 	MockLike          func(ref *comatproto.RepoStrongRef) (*comatproto.RepoCreateRecord_Output, error)
+	MockPutRecord     func(collection string, rkey string, record *lexutil.LexiconTypeDecoder) (*comatproto.RepoPutRecord_Output, error)
 	MockReply         func(text string, ref *comatproto.RepoStrongRef) (*comatproto.RepoCreateRecord_Output, error)
 }
 
@@ -58,6 +60,9 @@ func (c *mockClient) defaultGetRecord(uri string, cid string) (*comatproto.RepoG
 func (c *mockClient) defaultLike(ref *comatproto.RepoStrongRef) (*comatproto.RepoCreateRecord_Output, error) {
 	return &comatproto.RepoCreateRecord_Output{}, nil
 }
+func (c *mockClient) defaultPutRecord(collection string, rkey string, record *lexutil.LexiconTypeDecoder) (*comatproto.RepoPutRecord_Output, error) {
+	return &comatproto.RepoPutRecord_Output{}, nil
+}
 func (c *mockClient) defaultReply(text string, ref *comatproto.RepoStrongRef) (*comatproto.RepoCreateRecord_Output, error) {
 	return &comatproto.RepoCreateRecord_Output{}, nil
 }
@@ -100,6 +105,9 @@ func (c *mockClient) GetRecord(uri string, cid string) (*comatproto.RepoGetRecor
 func (c *mockClient) Like(ref *comatproto.RepoStrongRef) (*comatproto.RepoCreateRecord_Output, error) {
 	return c.MockLike(ref)
 }
+func (c *mockClient) PutRecord(collection string, rkey string, record *lexutil.LexiconTypeDecoder) (*comatproto.RepoPutRecord_Output, error) {
+	return c.MockPutRecord(collection, rkey, record)
+}
 func (c *mockClient) Reply(text string, ref *comatproto.RepoStrongRef) (*comatproto.RepoCreateRecord_Output, error) {
 	return c.MockReply(text, ref)
 }
@@ -122,6 +130,7 @@ func NewMockClient(ctx context.Context) *mockClient {
 	c.MockGetPosts = c.defaultGetPosts
 	c.MockGetRecord = c.defaultGetRecord
 	c.MockLike = c.defaultLike
+	c.MockPutRecord = c.defaultPutRecord
 	c.MockReply = c.defaultReply
 
 	return c
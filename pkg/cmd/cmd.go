@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"time"
 
 	cli "github.com/urfave/cli/v2"
 )
@@ -32,6 +33,19 @@ var WithDebug = []cli.Flag{
 	},
 }
 
+func StringSliceValue(ctx context.Context, name string) []string {
+	switch val := ctx.Value(name).(type) {
+	case cli.StringSlice:
+		return val.Value()
+	case *cli.StringSlice:
+		return val.Value()
+	case []string:
+		return val
+	default:
+		return []string{}
+	}
+}
+
 func DebuggingEnabled(ctxRaw interface{}, pkg string) bool {
 	ctx, ok := ctxRaw.(context.Context)
 	if !ok {
@@ -92,6 +106,43 @@ var WithClient = CombineFlags(
 	WithDebug,
 )
 
+var WithIdentity = []cli.Flag{
+	&cli.StringFlag{
+		Name:    "plc-host",
+		Usage:   "method, hostname, and port of the PLC directory used to resolve dids",
+		Value:   "https://plc.directory",
+		EnvVars: []string{"GO_BLUESKY_PLC_HOST"},
+	},
+	&cli.DurationFlag{
+		Name:    "identity-timeout",
+		Usage:   "how long to wait on the PLC directory, dns, or a handle's host",
+		Value:   10 * time.Second,
+		EnvVars: []string{"GO_BLUESKY_IDENTITY_TIMEOUT"},
+	},
+	&cli.DurationFlag{
+		Name:    "identity-cache-ttl",
+		Usage:   "how long to remember resolved handles and did documents",
+		Value:   1 * time.Hour,
+		EnvVars: []string{"GO_BLUESKY_IDENTITY_CACHE_TTL"},
+	},
+	&cli.DurationFlag{
+		Name:    "identity-negative-ttl",
+		Usage:   "how long to remember handles and dids that failed to resolve",
+		Value:   1 * time.Minute,
+		EnvVars: []string{"GO_BLUESKY_IDENTITY_NEGATIVE_TTL"},
+	},
+}
+
+var WithLabeler = CombineFlags(
+	&cli.StringFlag{
+		Name:    "label-definitions",
+		Usage:   "path to label definitions file for labeler, eg config/labels.json; label values are not validated unless set",
+		Value:   "",
+		EnvVars: []string{"GO_BLUESKY_LABEL_DEFINITIONS"},
+	},
+	WithIdentity,
+)
+
 var WithDb = CombineFlags(
 	&cli.StringFlag{
 		Name:    "db-dir",
@@ -154,7 +205,13 @@ var WithDb = CombineFlags(
 		EnvVars:  []string{"GO_BLUESKY_SIGNING_KEY_HEX"},
 		Required: true,
 	},
+	&cli.StringSliceFlag{
+		Name:    "retired-signing-keys",
+		Usage:   "previous signing keys for labeler, still accepted for labels they signed",
+		EnvVars: []string{"GO_BLUESKY_RETIRED_SIGNING_KEYS_HEX"},
+	},
 	WithDebug,
+	WithLabeler,
 )
 
 var WithIndexer = CombineFlags(
@@ -206,11 +263,66 @@ var WithIndexer = CombineFlags(
 		Value:   1,
 		EnvVars: []string{"GO_BLUESKY_PRUNER_TICK_MINUTES"},
 	},
+	&cli.StringFlag{
+		Name:    "rules",
+		Usage:   "path to label rules file, uses the built-in rules if unset",
+		EnvVars: []string{"GO_BLUESKY_RULES"},
+	},
+	&cli.StringFlag{
+		Name:    "milestones",
+		Usage:   "path to account age milestone labels file, uses the birthday label if unset",
+		EnvVars: []string{"GO_BLUESKY_MILESTONES"},
+	},
 	WithDebug,
 	WithDb,
 	WithClient,
 )
 
+var adminTokenFlag = &cli.StringFlag{
+	Name:    "admin-token",
+	Usage:   "bearer token for the admin api",
+	EnvVars: []string{"GO_BLUESKY_ADMIN_TOKEN"},
+}
+
+var WithAdminClient = CombineFlags(
+	&cli.StringFlag{
+		Name:    "admin-url",
+		Usage:   "method, hostname, and port of the server's admin api",
+		Value:   "http://localhost:8080",
+		EnvVars: []string{"GO_BLUESKY_ADMIN_URL"},
+	},
+	adminTokenFlag,
+	WithIdentity,
+	WithDebug,
+)
+
+var WithHealth = []cli.Flag{
+	&cli.Float64Flag{
+		Name:    "health-min-disk-free",
+		Usage:   "percent of the db-dir disk that must be free to be ready",
+		Value:   5,
+		EnvVars: []string{"GO_BLUESKY_HEALTH_MIN_DISK_FREE"},
+	},
+	&cli.DurationFlag{
+		Name:    "health-max-firehose-lag",
+		Usage:   "how far behind the firehose the index can be and still be ready",
+		Value:   5 * time.Minute,
+		EnvVars: []string{"GO_BLUESKY_HEALTH_MAX_FIREHOSE_LAG"},
+	},
+	&cli.DurationFlag{
+		Name:    "health-max-labeler-silence",
+		Usage:   "how long the labeler stream can go without sending anything and still be ready",
+		Value:   5 * time.Minute,
+		EnvVars: []string{"GO_BLUESKY_HEALTH_MAX_LABELER_SILENCE"},
+	},
+	&cli.DurationFlag{
+		Name:    "health-max-loop-stall",
+		Usage:   "how long the run loop can go without turning over and still be live",
+		Value:   1 * time.Minute,
+		EnvVars: []string{"GO_BLUESKY_HEALTH_MAX_LOOP_STALL"},
+	},
+}
+
 var WithServer = CombineFlags(
 	&cli.StringFlag{
 		Name:    "listen",
@@ -224,18 +336,75 @@ var WithServer = CombineFlags(
 		Value:   int64(5),
 		EnvVars: []string{"GO_BLUESKY_MAX_WEB_CONNECTIONS"},
 	},
+	&cli.Int64Flag{
+		Name:    "max-web-queue",
+		Usage:   "max requests waiting for a db connection before the server answers 503",
+		Value:   int64(50),
+		EnvVars: []string{"GO_BLUESKY_MAX_WEB_QUEUE"},
+	},
+	&cli.DurationFlag{
+		Name:    "web-queue-timeout",
+		Usage:   "how long a request waits for a db connection before the server answers 503",
+		Value:   5 * time.Second,
+		EnvVars: []string{"GO_BLUESKY_WEB_QUEUE_TIMEOUT"},
+	},
+	&cli.StringFlag{
+		Name:    "rate-limits",
+		Usage:   "path to per route rate limits file, uses the built in limits if unset or none if \"off\"",
+		EnvVars: []string{"GO_BLUESKY_RATE_LIMITS"},
+	},
+	&cli.BoolFlag{
+		Name:    "trust-forwarded-for",
+		Usage:   "rate limit by the client ip in X-Forwarded-For, only safe behind a proxy like the bundled varnish",
+		Value:   false,
+		EnvVars: []string{"GO_BLUESKY_TRUST_FORWARDED_FOR"},
+	},
 	&cli.BoolFlag{
 		Name:    "enable-follow-lewds-feed",
-		Usage:   "enable follow lewds feed",
+		Usage:   "enable follow lewds feed in the built in feeds",
 		Value:   false,
 		EnvVars: []string{"GO_BLUESKY_ENABLE_FOLLOW_LEWDS_FEED"},
 	},
+	&cli.StringFlag{
+		Name:    "service-endpoint",
+		Usage:   "public url of this server for its did:web document, defaults to the feed did's host",
+		EnvVars: []string{"GO_BLUESKY_SERVICE_ENDPOINT"},
+	},
+	&cli.StringFlag{
+		Name:    "feeds",
+		Usage:   "path to feed registry file, uses the built in feeds if unset",
+		EnvVars: []string{"GO_BLUESKY_FEEDS"},
+	},
+	&cli.IntFlag{
+		Name:    "feed-cache-size",
+		Usage:   "max feed responses to cache in memory, 0 disables the cache",
+		Value:   10000,
+		EnvVars: []string{"GO_BLUESKY_FEED_CACHE_SIZE"},
+	},
+	&cli.StringFlag{
+		Name:    "cursor-secret",
+		Usage:   "secret for signing feed cursors, required by the server and shared by every server instance",
+		EnvVars: []string{"GO_BLUESKY_CURSOR_SECRET"},
+	},
+	&cli.BoolFlag{
+		Name:    "legacy-cursors",
+		Usage:   "accept the old unsigned feed cursors, which clients can forge",
+		Value:   true,
+		EnvVars: []string{"GO_BLUESKY_LEGACY_CURSORS"},
+	},
 	&cli.StringFlag{
 		Name:    "pinned-post",
 		Usage:   "pin a post to all feeds",
 		Value:   "",
 		EnvVars: []string{"GO_BLUESKY_PINNED_POST"},
 	},
+	adminTokenFlag,
+	&cli.StringSliceFlag{
+		Name:    "admin-dids",
+		Usage:   "dids allowed to use the admin api with a service auth token minted for the route's xyz.flicknow.admin.* lxm",
+		EnvVars: []string{"GO_BLUESKY_ADMIN_DIDS"},
+	},
+	WithHealth,
 	WithDebug,
 	WithClient,
 	WithIndexer,
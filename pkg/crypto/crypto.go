@@ -9,6 +9,7 @@ import (
 )
 
 type SigningKey struct {
+	keyId      string
 	signingKey *crypto.PrivateKeyK256
 }
 
@@ -25,7 +26,26 @@ func NewSigningKey(signingKeyHex string) (*SigningKey, error) {
 
 	}
 
-	return &SigningKey{signingKey: signingKey}, nil
+	return NewSigningKeyFromPrivateKey(signingKey)
+}
+
+func NewSigningKeyFromPrivateKey(signingKey *crypto.PrivateKeyK256) (*SigningKey, error) {
+	pub, err := signingKey.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+
+	return &SigningKey{keyId: pub.DIDKey(), signingKey: signingKey}, nil
+}
+
+// KeyId is the did:key form of the public key, which is what gets published
+// as the #atproto_label verification method in the labeler's DID document.
+func (s *SigningKey) KeyId() string {
+	return s.keyId
+}
+
+func (s *SigningKey) PublicKey() (crypto.PublicKey, error) {
+	return s.signingKey.PublicKey()
 }
 
 func (s *SigningKey) SignLabel(label *atproto.LabelDefs_Label) error {
@@ -60,3 +80,47 @@ func (s *SigningKey) SignLabelAndMarshalCBOR(label *atproto.LabelDefs_Label) ([]
 
 	return cborBuf.Bytes(), nil
 }
+
+func VerifyLabel(pub crypto.PublicKey, label *atproto.LabelDefs_Label) error {
+	sig := label.Sig
+	label.Sig = nil
+	defer func() { label.Sig = sig }()
+
+	sigBuf := new(bytes.Buffer)
+	err := label.MarshalCBOR(sigBuf)
+	if err != nil {
+		return err
+	}
+
+	return pub.HashAndVerify(sigBuf.Bytes(), sig)
+}
+
+// SignLabelsAndMarshalCBOR signs a batch of labels, reusing one buffer for
+// the unsigned encodings.
+func (s *SigningKey) SignLabelsAndMarshalCBOR(labels []*atproto.LabelDefs_Label) ([][]byte, error) {
+	cbors := make([][]byte, len(labels))
+	sigBuf := new(bytes.Buffer)
+	for i, label := range labels {
+		label.Sig = nil
+
+		sigBuf.Reset()
+		err := label.MarshalCBOR(sigBuf)
+		if err != nil {
+			return nil, err
+		}
+
+		label.Sig, err = s.signingKey.HashAndSign(sigBuf.Bytes())
+		if err != nil {
+			return nil, err
+		}
+
+		cborBuf := new(bytes.Buffer)
+		err = label.MarshalCBOR(cborBuf)
+		if err != nil {
+			return nil, err
+		}
+		cbors[i] = cborBuf.Bytes()
+	}
+
+	return cbors, nil
+}
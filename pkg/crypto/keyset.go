@@ -0,0 +1,65 @@
+package crypto
+
+import (
+	"fmt"
+)
+
+type KeySet struct {
+	Active  *SigningKey
+	Retired []*SigningKey
+	byKeyId map[string]*SigningKey
+}
+
+func NewKeySet(activeHex string, retiredHex ...string) (*KeySet, error) {
+	active, err := NewSigningKey(activeHex)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing active signing key: %w", err)
+	}
+
+	keys := &KeySet{
+		Active:  active,
+		Retired: make([]*SigningKey, 0, len(retiredHex)),
+		byKeyId: map[string]*SigningKey{active.KeyId(): active},
+	}
+
+	for i, keyHex := range retiredHex {
+		if keyHex == "" {
+			continue
+		}
+
+		key, err := NewSigningKey(keyHex)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing retired signing key %d: %w", i, err)
+		}
+		if keys.byKeyId[key.KeyId()] != nil {
+			continue
+		}
+
+		keys.Retired = append(keys.Retired, key)
+		keys.byKeyId[key.KeyId()] = key
+	}
+
+	return keys, nil
+}
+
+func (k *KeySet) Find(keyId string) *SigningKey {
+	return k.byKeyId[keyId]
+}
+
+func (k *KeySet) IsRetired(keyId string) bool {
+	key := k.byKeyId[keyId]
+	return (key != nil) && (key != k.Active)
+}
+
+// RetiredCandidates returns the retired keys a label recorded under keyId
+// may have been signed with. Labels from before key ids were recorded have
+// an empty keyId and could have come from any retired key.
+func (k *KeySet) RetiredCandidates(keyId string) []*SigningKey {
+	if keyId == "" {
+		return k.Retired
+	}
+	if !k.IsRetired(keyId) {
+		return nil
+	}
+	return []*SigningKey{k.byKeyId[keyId]}
+}
@@ -0,0 +1,98 @@
+package dbx
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type BlockRow struct {
+	BlockId   int64  `db:"block_id"`
+	Rkey      string `db:"rkey"`
+	ActorId   int64  `db:"actor_id"`
+	SubjectId int64  `db:"subject_id"`
+	CreatedAt int64  `db:"created_at"`
+}
+
+type DBxTableBlocks struct {
+	*sqlx.DB `dbx-table:"blocks" dbx-pk:"block_id"`
+	path     string
+}
+
+var BlockSchema = `
+CREATE TABLE IF NOT EXISTS blocks (
+	block_id INTEGER PRIMARY KEY,
+	rkey TEXT NOT NULL,
+	actor_id INTEGER NOT NULL,
+	subject_id INTEGER NOT NULL,
+	created_at INTEGER NOT NULL,
+	UNIQUE(actor_id, rkey) ON CONFLICT IGNORE
+);
+CREATE INDEX IF NOT EXISTS idx_blocks_actor_id
+ON blocks(actor_id);
+CREATE INDEX IF NOT EXISTS idx_blocks_subject_id
+ON blocks(subject_id);
+`
+
+func NewBlocksTable(dir string) *DBxTableBlocks {
+	path := filepath.Join(dir, "blocks.db")
+	return &DBxTableBlocks{
+		SQLxMustOpen(path, BlockSchema),
+		path,
+	}
+}
+
+func (d *DBxTableBlocks) InsertBlock(row *BlockRow) (*BlockRow, error) {
+	res, err := d.NamedExec("INSERT OR IGNORE INTO blocks (rkey, actor_id, subject_id, created_at) VALUES (:rkey, :actor_id, :subject_id, :created_at)", row)
+	if err != nil {
+		return nil, err
+	}
+
+	row.BlockId, err = res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	return row, nil
+}
+
+func (d *DBxTableBlocks) FindByRkey(actorid int64, rkey string) (*BlockRow, error) {
+	block := &BlockRow{}
+	err := d.Get(block, "SELECT * FROM blocks WHERE actor_id = $1 AND rkey = $2", actorid, rkey)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return block, nil
+}
+
+func (d *DBxTableBlocks) DeleteBlock(actorid int64, rkey string) error {
+	_, err := d.Exec("DELETE FROM blocks WHERE actor_id = $1 AND rkey = $2", actorid, rkey)
+	if (err != nil) && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	return nil
+}
+
+// SelectBlockedActorIds finds everyone the actor blocks or is blocked by.
+func (d *DBxTableBlocks) SelectBlockedActorIds(actorid int64) (map[int64]bool, error) {
+	ids := make([]int64, 0)
+	err := d.Select(
+		&ids,
+		"SELECT subject_id FROM blocks WHERE actor_id = $1 UNION SELECT actor_id FROM blocks WHERE subject_id = $1",
+		actorid,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	blocked := make(map[int64]bool)
+	for _, id := range ids {
+		blocked[id] = true
+	}
+	return blocked, nil
+}
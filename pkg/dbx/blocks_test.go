@@ -0,0 +1,109 @@
+package dbx
+
+import (
+	"testing"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/flicknow/go-bluesky-bot/pkg/firehose"
+	"github.com/flicknow/go-bluesky-bot/pkg/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func (d *testDBx) CreateBlock(actor *ActorRow, subject *ActorRow) string {
+	uri := NewTestUri("app.bsky.graph.block", actor.Did)
+	err := d.InsertBlock(&firehose.BlockRef{Subject: subject.Did, Ref: &comatproto.RepoStrongRef{Uri: uri}})
+	if err != nil {
+		panic(err)
+	}
+	return uri
+}
+
+func TestDBxFilterForViewerBlocks(t *testing.T) {
+	d, cleanup := NewTestDBx()
+	defer cleanup()
+
+	viewer := d.CreateActor()
+	blocked := d.CreateActor()
+	blocker := d.CreateActor()
+	friend := d.CreateActor()
+
+	blockedPost := d.CreatePost(&TestPostRefInput{Actor: blocked.Did})
+	blockerPost := d.CreatePost(&TestPostRefInput{Actor: blocker.Did})
+	friendPost := d.CreatePost(&TestPostRefInput{Actor: friend.Did})
+	repostedByBlocked := d.CreatePost(&TestPostRefInput{Actor: friend.Did})
+	repostedByBlocked.RepostUri = d.CreateRepost(blocked, repostedByBlocked).Uri
+	posts := []*PostRow{repostedByBlocked, friendPost, blockerPost, blockedPost}
+
+	_, err := d.FollowsIndexed.FindOrCreateByActorId(viewer.ActorId)
+	if err != nil {
+		panic(err)
+	}
+
+	blockUri := d.CreateBlock(viewer, blocked)
+	d.CreateBlock(blocker, viewer)
+
+	filtered, err := d.FilterForViewer(viewer.Did, posts)
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(t, []*PostRow{friendPost}, filtered, "blocks apply in both directions")
+
+	filtered, err = d.FilterForViewer(friend.Did, posts)
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(t, posts, filtered)
+
+	err = d.DeleteBlock(blockUri)
+	if err != nil {
+		panic(err)
+	}
+
+	filtered, err = d.FilterForViewer(viewer.Did, posts)
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(t, []*PostRow{repostedByBlocked, friendPost, blockedPost}, filtered)
+}
+
+func TestDBxInsertBlockKnownActors(t *testing.T) {
+	d, cleanup := NewTestDBx()
+	defer cleanup()
+
+	actor := d.CreateActor()
+	other := d.CreateActor()
+
+	d.CreateBlock(actor, other)
+	blocked, err := d.Blocks.SelectBlockedActorIds(other.ActorId)
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(t, map[int64]bool{actor.ActorId: true}, blocked, "either end may become a viewer")
+
+	unknown := utils.NewTestDid()
+	err = d.InsertBlock(&firehose.BlockRef{Subject: unknown, Ref: &comatproto.RepoStrongRef{Uri: NewTestUri("app.bsky.graph.block", actor.Did)}})
+	if err != nil {
+		panic(err)
+	}
+	subject, err := d.Actors.FindActor(unknown)
+	if err != nil {
+		panic(err)
+	}
+	assert.NotNil(t, subject, "the unknown end is created")
+	blocked, err = d.Blocks.SelectBlockedActorIds(actor.ActorId)
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(t, map[int64]bool{other.ActorId: true, subject.ActorId: true}, blocked)
+
+	stranger := utils.NewTestDid()
+	err = d.InsertBlock(&firehose.BlockRef{Subject: utils.NewTestDid(), Ref: &comatproto.RepoStrongRef{Uri: NewTestUri("app.bsky.graph.block", stranger)}})
+	if err != nil {
+		panic(err)
+	}
+	row, err := d.Actors.FindActor(stranger)
+	if err != nil {
+		panic(err)
+	}
+	assert.Nil(t, row, "blocks between unknown actors are dropped")
+}
@@ -1,6 +1,7 @@
 package dbx
 
 import (
+	"database/sql"
 	"path/filepath"
 
 	"github.com/jmoiron/sqlx"
@@ -17,11 +18,13 @@ type CustomLabel struct {
 	LabelId       int64  `db:"label_id"`
 	Neg           int64  `db:"neg"`
 	Cbor          []byte `db:"cbor"`
+	KeyId         string `db:"key_id"`
 }
 
 type DBxTableCustomLabels struct {
 	*sqlx.DB `dbx-table:"custom_labels" dbx-pk:"custom_label_id"`
 	path     string
+	Hub      *LabelHub
 }
 
 var CustomLabelSchema = `
@@ -33,6 +36,7 @@ CREATE TABLE IF NOT EXISTS custom_labels (
 	label_id INTEGER,
 	neg INTEGER DEFAULT 0,
 	cbor BLOB,
+	key_id TEXT DEFAULT '',
 	UNIQUE(label_id, subject_type, subject_id, neg) ON CONFLICT IGNORE
 );
 CREATE INDEX IF NOT EXISTS idx_custom_label_created_at
@@ -41,8 +45,39 @@ CREATE INDEX IF NOT EXISTS idx_custom_label_label_id_created_at
 ON custom_labels(label_id, created_at);
 CREATE INDEX IF NOT EXISTS idx_custom_label_label_id_neg
 ON custom_labels(label_id, neg);
+CREATE INDEX IF NOT EXISTS idx_custom_label_key_id
+ON custom_labels(key_id);
 `
 
+func insertLabels(tx *sqlx.Tx, rows []*CustomLabel) ([]*CustomLabel, error) {
+	inserted := make([]*CustomLabel, 0, len(rows))
+	for _, row := range rows {
+		res, err := tx.NamedExec(
+			"INSERT OR IGNORE INTO custom_labels (label_id, created_at, neg, subject_type, subject_id, cbor, key_id) VALUES (:label_id, :created_at, :neg, :subject_type, :subject_id, :cbor, :key_id)",
+			row,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return nil, err
+		} else if affected == 0 {
+			continue
+		}
+
+		id, err := res.LastInsertId()
+		if err != nil {
+			return nil, err
+		}
+		row.CustomLabelId = id
+		inserted = append(inserted, row)
+	}
+
+	return inserted, nil
+}
+
 func (d *DBxTableCustomLabels) InsertLabels(rows []*CustomLabel) error {
 	tx, err := d.Beginx()
 	if err != nil {
@@ -50,17 +85,36 @@ func (d *DBxTableCustomLabels) InsertLabels(rows []*CustomLabel) error {
 	}
 	defer tx.Rollback()
 
-	for _, row := range rows {
-		_, err := tx.NamedExec(
-			"INSERT OR IGNORE INTO custom_labels (label_id, created_at, neg, subject_type, subject_id, cbor) VALUES (:label_id, :created_at, :neg, :subject_type, :subject_id, :cbor)",
-			row,
-		)
-		if err != nil {
-			return err
-		}
+	inserted, err := insertLabels(tx, rows)
+	if err != nil {
+		return err
 	}
 
-	return tx.Commit()
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	d.Hub.Publish(inserted)
+	return nil
+}
+
+func (d *DBxTableCustomLabels) SelectLastLabelId() (int64, error) {
+	var lastid sql.NullInt64
+	err := d.QueryRowx("SELECT MAX(custom_label_id) FROM custom_labels").Scan(&lastid)
+	if err != nil {
+		return 0, err
+	}
+	return lastid.Int64, nil
+}
+
+func (d *DBxTableCustomLabels) SelectFirstLabelId() (int64, error) {
+	var firstid sql.NullInt64
+	err := d.QueryRowx("SELECT MIN(custom_label_id) FROM custom_labels").Scan(&firstid)
+	if err != nil {
+		return 0, err
+	}
+	return firstid.Int64, nil
 }
 
 func (d *DBxTableCustomLabels) SelectLabels(since int64, limit int) ([]*CustomLabel, error) {
@@ -117,6 +171,160 @@ func (d *DBxTableCustomLabels) SelectLabelsByLabelId(labelId int64, since int64,
 	return labels, nil
 }
 
+func (d *DBxTableCustomLabels) SelectLabelsNotSignedBy(keyId string, since int64, limit int) ([]*CustomLabel, error) {
+	labels := make([]*CustomLabel, 0)
+	err := d.Select(
+		&labels,
+		"SELECT * FROM custom_labels WHERE key_id != $1 AND custom_label_id > $2 ORDER BY custom_label_id ASC LIMIT $3",
+		keyId,
+		since,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return labels, nil
+}
+
+// ReplaceLabels swaps each old label for its replacement in one transaction.
+// Replacements get ids past the current max, even if the old rows were the
+// newest, so label subscribers pick them up again.
+func (d *DBxTableCustomLabels) ReplaceLabels(old []*CustomLabel, rows []*CustomLabel) error {
+	tx, err := d.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var lastid sql.NullInt64
+	err = tx.QueryRowx("SELECT MAX(custom_label_id) FROM custom_labels").Scan(&lastid)
+	if err != nil {
+		return err
+	}
+
+	for _, row := range old {
+		_, err := tx.Exec("DELETE FROM custom_labels WHERE custom_label_id = $1", row.CustomLabelId)
+		if err != nil {
+			return err
+		}
+	}
+
+	for i, row := range rows {
+		row.CustomLabelId = lastid.Int64 + int64(i) + 1
+		_, err := tx.NamedExec(
+			"INSERT OR IGNORE INTO custom_labels (custom_label_id, label_id, created_at, neg, subject_type, subject_id, cbor, key_id) VALUES (:custom_label_id, :label_id, :created_at, :neg, :subject_type, :subject_id, :cbor, :key_id)",
+			row,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	d.Hub.Publish(rows)
+	return nil
+}
+
+// SupersedeLabels inserts rows, first deleting any earlier apply or negate
+// of the same label on the same subject so only the latest one is kept.
+func (d *DBxTableCustomLabels) SupersedeLabels(rows []*CustomLabel) error {
+	tx, err := d.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var lastid sql.NullInt64
+	err = tx.QueryRowx("SELECT MAX(custom_label_id) FROM custom_labels").Scan(&lastid)
+	if err != nil {
+		return err
+	}
+
+	for i, row := range rows {
+		_, err := tx.Exec(
+			"DELETE FROM custom_labels WHERE label_id = $1 AND subject_type = $2 AND subject_id = $3",
+			row.LabelId,
+			row.SubjectType,
+			row.SubjectId,
+		)
+		if err != nil {
+			return err
+		}
+
+		row.CustomLabelId = lastid.Int64 + int64(i) + 1
+		_, err = tx.NamedExec(
+			"INSERT INTO custom_labels (custom_label_id, label_id, created_at, neg, subject_type, subject_id, cbor, key_id) VALUES (:custom_label_id, :label_id, :created_at, :neg, :subject_type, :subject_id, :cbor, :key_id)",
+			row,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	d.Hub.Publish(rows)
+	return nil
+}
+
+func (d *DBxTableCustomLabels) SelectLabelsBySubject(subjectType int64, subjectId int64) ([]*CustomLabel, error) {
+	labels := make([]*CustomLabel, 0)
+	err := d.Select(
+		&labels,
+		"SELECT * FROM custom_labels WHERE subject_type = $1 AND subject_id = $2 ORDER BY custom_label_id ASC",
+		subjectType,
+		subjectId,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return labels, nil
+}
+
+// FindLabel returns the latest apply or negate of a label on a subject.
+func (d *DBxTableCustomLabels) FindLabel(labelId int64, subjectType int64, subjectId int64) (*CustomLabel, error) {
+	labels := make([]*CustomLabel, 0, 1)
+	err := d.Select(
+		&labels,
+		"SELECT * FROM custom_labels WHERE label_id = $1 AND subject_type = $2 AND subject_id = $3 ORDER BY custom_label_id DESC LIMIT 1",
+		labelId,
+		subjectType,
+		subjectId,
+	)
+	if err != nil {
+		return nil, err
+	} else if len(labels) == 0 {
+		return nil, nil
+	}
+
+	return labels[0], nil
+}
+
+func (d *DBxTableCustomLabels) HasLabel(labelId int64, subjectType int64, subjectId int64) (bool, error) {
+	var count int64
+	row := d.QueryRowx(
+		"SELECT COUNT(*) FROM custom_labels WHERE label_id = $1 AND subject_type = $2 AND subject_id = $3 AND neg = 0",
+		labelId,
+		subjectType,
+		subjectId,
+	)
+	err := row.Scan(&count)
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
 func (d *DBxTableCustomLabels) DeleteLabelByPostId(labelId int64, postId int64) error {
 	_, err := d.DB.Exec(
 		"DELETE FROM custom_labels WHERE label_id = $1 AND subject_id = $2 AND subject_type = $3",
@@ -129,8 +337,15 @@ func (d *DBxTableCustomLabels) DeleteLabelByPostId(labelId int64, postId int64)
 
 func NewCustomLabelTable(dir string) *DBxTableCustomLabels {
 	path := filepath.Join(dir, "custom-labels.db")
-	return &DBxTableCustomLabels{
-		SQLxMustOpen(path, CustomLabelSchema),
-		path,
+	db := SQLxMustOpen(path, CustomLabelSchema)
+	SQLxMustAddColumn(db, "custom_labels", "key_id", "TEXT DEFAULT ''")
+	db.MustExec("CREATE INDEX IF NOT EXISTS idx_custom_label_key_id ON custom_labels(key_id)")
+
+	d := &DBxTableCustomLabels{
+		DB:   db,
+		path: path,
 	}
+	d.Hub = NewLabelHub(d.SelectLabels, d.SelectLastLabelId)
+
+	return d
 }
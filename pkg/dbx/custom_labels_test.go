@@ -1,11 +1,19 @@
 package dbx
 
 import (
+	"bytes"
 	"context"
+	"encoding/hex"
+	"path/filepath"
 	"testing"
 	"time"
 
+	"github.com/bluesky-social/indigo/api/atproto"
+	indigocrypto "github.com/bluesky-social/indigo/atproto/crypto"
 	"github.com/flicknow/go-bluesky-bot/pkg/clock"
+	"github.com/flicknow/go-bluesky-bot/pkg/crypto"
+	"github.com/flicknow/go-bluesky-bot/pkg/labeler"
+	"github.com/flicknow/go-bluesky-bot/pkg/rules"
 	"github.com/flicknow/go-bluesky-bot/pkg/utils"
 	"github.com/stretchr/testify/assert"
 )
@@ -243,3 +251,427 @@ func TestDBxSelectBirthdaysFollowed(t *testing.T) {
 		CollectPostIds(found),
 	)
 }
+
+func TestDBxResignLabels(t *testing.T) {
+	dir := t.TempDir()
+
+	oldKey, err := indigocrypto.GeneratePrivateKeyK256()
+	if err != nil {
+		panic(err)
+	}
+	newKey, err := indigocrypto.GeneratePrivateKeyK256()
+	if err != nil {
+		panic(err)
+	}
+
+	ctx := context.WithValue(context.Background(), "db-dir", dir)
+	ctx = context.WithValue(ctx, "signing-key", hex.EncodeToString(oldKey.Bytes()))
+	d := NewDBx(ctx)
+
+	actor, err := d.Actors.FindOrCreateActor(utils.NewTestDid())
+	if err != nil {
+		panic(err)
+	}
+	err = d.InsertAccountLabels(actor, "artist")
+	if err != nil {
+		panic(err)
+	}
+	oldKeyId := d.SigningKey.KeyId()
+	d.Close()
+
+	ctx = context.WithValue(ctx, "signing-key", hex.EncodeToString(newKey.Bytes()))
+	ctx = context.WithValue(ctx, "retired-signing-keys", []string{hex.EncodeToString(oldKey.Bytes())})
+	d = NewDBx(ctx)
+	defer d.Close()
+
+	assert.True(t, d.SigningKeys.IsRetired(oldKeyId))
+	assert.NotEqual(t, oldKeyId, d.SigningKey.KeyId())
+
+	cursor, resigned, skipped, err := d.ResignLabels(0, 10)
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(t, 1, resigned)
+	assert.Equal(t, 0, skipped)
+
+	_, resigned, _, err = d.ResignLabels(cursor, 10)
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(t, 0, resigned)
+
+	labels, err := d.SelectCustomLabels(0, 10)
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(t, 1, len(labels))
+	assert.Equal(t, d.SigningKey.KeyId(), labels[0].KeyId)
+
+	label := &atproto.LabelDefs_Label{}
+	err = label.UnmarshalCBOR(bytes.NewReader(labels[0].Cbor))
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(t, "artist", label.Val)
+	assert.Equal(t, actor.Did, label.Uri)
+
+	pub, err := newKey.PublicKey()
+	if err != nil {
+		panic(err)
+	}
+	assert.Nil(t, crypto.VerifyLabel(pub, label))
+}
+
+func TestDBxResignLabelsSkipsUnverified(t *testing.T) {
+	dir := t.TempDir()
+
+	oldKey, err := indigocrypto.GeneratePrivateKeyK256()
+	if err != nil {
+		panic(err)
+	}
+	newKey, err := indigocrypto.GeneratePrivateKeyK256()
+	if err != nil {
+		panic(err)
+	}
+	foreignKey, err := indigocrypto.GeneratePrivateKeyK256()
+	if err != nil {
+		panic(err)
+	}
+	foreign, err := crypto.NewSigningKeyFromPrivateKey(foreignKey)
+	if err != nil {
+		panic(err)
+	}
+
+	ctx := context.WithValue(context.Background(), "db-dir", dir)
+	ctx = context.WithValue(ctx, "signing-key", hex.EncodeToString(oldKey.Bytes()))
+	d := NewDBx(ctx)
+
+	actor, err := d.Actors.FindOrCreateActor(utils.NewTestDid())
+	if err != nil {
+		panic(err)
+	}
+	err = d.InsertAccountLabels(actor, "artist")
+	if err != nil {
+		panic(err)
+	}
+	oldKeyId := d.SigningKey.KeyId()
+
+	ver := int64(1)
+	expired := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	labels := []*atproto.LabelDefs_Label{
+		{Cts: time.Now().UTC().Format(time.RFC3339), Src: LabelerDid, Uri: utils.NewTestDid(), Val: "artist", Ver: &ver},
+		{Cts: time.Now().UTC().Format(time.RFC3339), Src: LabelerDid, Uri: utils.NewTestDid(), Val: "artist", Ver: &ver, Neg: &[]bool{true}[0]},
+		{Cts: time.Now().UTC().Format(time.RFC3339), Src: LabelerDid, Uri: utils.NewTestDid(), Val: "artist", Ver: &ver, Exp: &expired},
+	}
+	forged, err := foreign.SignLabelAndMarshalCBOR(labels[0])
+	if err != nil {
+		panic(err)
+	}
+	negated, err := d.SigningKey.SignLabelAndMarshalCBOR(labels[1])
+	if err != nil {
+		panic(err)
+	}
+	lapsed, err := d.SigningKey.SignLabelAndMarshalCBOR(labels[2])
+	if err != nil {
+		panic(err)
+	}
+	err = d.CustomLabels.InsertLabels([]*CustomLabel{
+		{SubjectType: AccountLabelType, SubjectId: 100, LabelId: 1, Cbor: forged, KeyId: oldKeyId},
+		{SubjectType: AccountLabelType, SubjectId: 101, LabelId: 1, Neg: 1, Cbor: negated, KeyId: oldKeyId},
+		{SubjectType: AccountLabelType, SubjectId: 102, LabelId: 1, Cbor: lapsed, KeyId: oldKeyId},
+	})
+	if err != nil {
+		panic(err)
+	}
+	d.Close()
+
+	ctx = context.WithValue(ctx, "signing-key", hex.EncodeToString(newKey.Bytes()))
+	ctx = context.WithValue(ctx, "retired-signing-keys", []string{hex.EncodeToString(oldKey.Bytes())})
+	d = NewDBx(ctx)
+	defer d.Close()
+
+	_, resigned, skipped, err := d.ResignLabels(0, 10)
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(t, 2, resigned)
+	assert.Equal(t, 2, skipped)
+
+	rows, err := d.CustomLabels.SelectLabels(0, 10)
+	if err != nil {
+		panic(err)
+	}
+	keyIds := make(map[int64]string)
+	for _, row := range rows {
+		keyIds[row.SubjectId] = row.KeyId
+	}
+	assert.Equal(t, d.SigningKey.KeyId(), keyIds[actor.ActorId])
+	assert.Equal(t, oldKeyId, keyIds[100])
+	assert.Equal(t, d.SigningKey.KeyId(), keyIds[101], "negations are re-signed too")
+	assert.Equal(t, oldKeyId, keyIds[102])
+}
+
+func TestCustomLabelTableAddsKeyIdColumn(t *testing.T) {
+	dir := t.TempDir()
+
+	legacy := SQLxMustOpen(filepath.Join(dir, "custom-labels.db"), `
+CREATE TABLE IF NOT EXISTS custom_labels (
+	custom_label_id INTEGER PRIMARY KEY,
+	subject_type INTEGER,
+	subject_id INTEGER,
+	created_at INTEGER,
+	label_id INTEGER,
+	neg INTEGER DEFAULT 0,
+	cbor BLOB,
+	UNIQUE(label_id, subject_type, subject_id, neg) ON CONFLICT IGNORE
+);
+INSERT INTO custom_labels (subject_type, subject_id, created_at, label_id) VALUES (0, 1, 1, 1);
+`)
+	legacy.Close()
+
+	table := NewCustomLabelTable(dir)
+	defer table.Close()
+
+	labels, err := table.SelectLabels(0, 10)
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(t, 1, len(labels))
+	assert.Equal(t, "", labels[0].KeyId)
+}
+
+func TestDBxIssueLabels(t *testing.T) {
+	d, cleanup := NewTestDBx()
+	defer cleanup()
+
+	actor := d.CreateActor()
+	post := d.CreatePost(&TestPostRefInput{Actor: actor.Did})
+
+	labels, err := d.IssueLabels("admin", []string{actor.Did, post.Uri}, "artist", false)
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(t, 2, len(labels))
+
+	active, err := d.SelectActiveLabels(post.Uri)
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(t, 1, len(active))
+	assert.Equal(t, post.Uri, active[0].Uri)
+
+	_, err = d.IssueLabels("admin", []string{actor.Did}, "artist", true)
+	if err != nil {
+		panic(err)
+	}
+
+	active, err = d.SelectActiveLabels(actor.Did)
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(t, 0, len(active))
+
+	rows, err := d.CustomLabels.SelectLabels(0, 10)
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(t, 2, len(rows))
+	assert.Equal(t, int64(1), rows[1].Neg)
+	assert.Equal(t, int64(3), rows[1].CustomLabelId)
+
+	audits, err := d.LabelAudits.SelectAuditsBySubject(actor.Did, SQLiteMaxInt, 10)
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(t, []string{LabelAuditNegate, LabelAuditApply}, []string{audits[0].Action, audits[1].Action})
+	assert.Equal(t, rows[1].CustomLabelId, audits[0].CustomLabelId)
+
+	_, err = d.IssueLabels("admin", []string{NewTestPostUri(actor.Did)}, "artist", false)
+	assert.ErrorIs(t, err, ErrUnknownLabelSubject)
+}
+
+func TestDBxVerifyLabels(t *testing.T) {
+	retiredKey, err := indigocrypto.GeneratePrivateKeyK256()
+	if err != nil {
+		panic(err)
+	}
+	retired, err := crypto.NewSigningKeyFromPrivateKey(retiredKey)
+	if err != nil {
+		panic(err)
+	}
+	activeKey, err := indigocrypto.GeneratePrivateKeyK256()
+	if err != nil {
+		panic(err)
+	}
+	otherKey, err := indigocrypto.GeneratePrivateKeyK256()
+	if err != nil {
+		panic(err)
+	}
+	other, err := crypto.NewSigningKeyFromPrivateKey(otherKey)
+	if err != nil {
+		panic(err)
+	}
+
+	ctx := context.WithValue(context.Background(), "db-dir", t.TempDir())
+	ctx = context.WithValue(ctx, "signing-key", hex.EncodeToString(activeKey.Bytes()))
+	ctx = context.WithValue(ctx, "retired-signing-keys", []string{hex.EncodeToString(retiredKey.Bytes())})
+	d := NewDBx(ctx)
+	defer d.Close()
+
+	good, err := d.Actors.FindOrCreateActor(utils.NewTestDid())
+	if err != nil {
+		panic(err)
+	}
+	err = d.InsertAccountLabels(good, "artist")
+	if err != nil {
+		panic(err)
+	}
+
+	ver := int64(1)
+	newLabel := func() *atproto.LabelDefs_Label {
+		return &atproto.LabelDefs_Label{Cts: time.Now().UTC().Format(time.RFC3339), Src: LabelerDid, Uri: utils.NewTestDid(), Val: "artist", Ver: &ver}
+	}
+	sign := func(key *crypto.SigningKey, label *atproto.LabelDefs_Label) []byte {
+		cbor, err := key.SignLabelAndMarshalCBOR(label)
+		if err != nil {
+			panic(err)
+		}
+		return cbor
+	}
+
+	forged := newLabel()
+	tampered := newLabel()
+	err = d.CustomLabels.InsertLabels([]*CustomLabel{
+		{SubjectType: AccountLabelType, SubjectId: 100, LabelId: 1, Cbor: sign(retired, newLabel()), KeyId: retired.KeyId()},
+		{SubjectType: AccountLabelType, SubjectId: 101, LabelId: 1, Cbor: sign(other, forged), KeyId: other.KeyId()},
+		{SubjectType: AccountLabelType, SubjectId: 102, LabelId: 1, Cbor: sign(other, tampered), KeyId: d.SigningKey.KeyId()},
+		{SubjectType: AccountLabelType, SubjectId: 103, LabelId: 1, Cbor: sign(retired, newLabel())},
+		{SubjectType: AccountLabelType, SubjectId: 104, LabelId: 1, Cbor: []byte("garbage")},
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	pub, err := d.SigningKey.PublicKey()
+	if err != nil {
+		panic(err)
+	}
+
+	cursor, checked, failures, err := d.VerifyLabels(pub, 0, 10)
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(t, int64(6), cursor)
+	assert.Equal(t, 6, checked)
+	assert.Equal(t, 3, len(failures), "labels signed by retired keys verify")
+	assert.ErrorIs(t, failures[0].Err, ErrUnknownLabelKey)
+	assert.Equal(t, forged.Uri, failures[0].Label.Uri)
+	assert.ErrorIs(t, failures[1].Err, ErrBadLabelSignature)
+	assert.Equal(t, tampered.Uri, failures[1].Label.Uri)
+	assert.ErrorIs(t, failures[2].Err, ErrUndecodableLabel)
+
+	_, checked, _, err = d.VerifyLabels(pub, cursor, 10)
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(t, 0, checked)
+}
+
+func TestDBxIssueTargetLabels(t *testing.T) {
+	d, cleanup := NewTestDBx()
+	defer cleanup()
+
+	actor := d.CreateActor()
+	postRef := NewTestPostRef(&TestPostRefInput{Actor: actor.Did})
+	postRef.Ref.Cid = "bafyreie5737gdxlw5i64vzichcalba3z2v5n6icifvx5xytvske7mr3hpm"
+	post, err := d.InsertPost(postRef, actor)
+	if err != nil {
+		panic(err)
+	}
+
+	target, err := d.ResolveLabelTarget(post.Uri, false)
+	if err != nil {
+		panic(err)
+	}
+
+	labels, err := d.IssueTargetLabels("", []*LabelTarget{target, target}, "artist", false)
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(t, 1, len(labels))
+	assert.Equal(t, postRef.Ref.Cid, *labels[0].Cid)
+
+	labels, err = d.IssueTargetLabels("", []*LabelTarget{target}, "artist", false)
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(t, 0, len(labels))
+
+	audits, err := d.LabelAudits.SelectAudits(SQLiteMaxInt, 10)
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(t, 0, len(audits))
+
+	pub, err := d.SigningKey.PublicKey()
+	if err != nil {
+		panic(err)
+	}
+	_, checked, failures, err := d.VerifyLabels(pub, 0, 10)
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(t, 1, checked)
+	assert.Equal(t, 0, len(failures))
+}
+
+func TestDBxRecordMilestoneLabels(t *testing.T) {
+	clock := clock.NewMockClock()
+
+	ctx := context.WithValue(context.Background(), "clock", clock)
+
+	d, cleanup := NewTestDBxContext(ctx)
+	defer cleanup()
+
+	now := time.Unix(clock.NowUnix(), 0)
+	actor := d.CreateActor()
+	_, err := d.Actors.InitializeBirthday(actor.Did, now.AddDate(0, 0, -100).Add(-5*time.Minute).Unix())
+	if err != nil {
+		panic(err)
+	}
+
+	milestone := &labeler.Milestone{Label: "hundred-days", Days: 100, Duration: rules.Duration{Duration: 2 * 24 * time.Hour}}
+	err = d.RecordMilestoneLabels(clock, milestone)
+	if err != nil {
+		panic(err)
+	}
+
+	active, err := d.SelectActiveLabels(actor.Did)
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(t, 1, len(active))
+	assert.Equal(t, "hundred-days", active[0].Val)
+
+	clock.SetNow(now.Add(24 * time.Hour).Unix())
+	err = d.RecordMilestoneLabels(clock, milestone)
+	if err != nil {
+		panic(err)
+	}
+	active, _ = d.SelectActiveLabels(actor.Did)
+	assert.Equal(t, 1, len(active))
+
+	clock.SetNow(now.Add(2 * 24 * time.Hour).Unix())
+	err = d.RecordMilestoneLabels(clock, milestone)
+	if err != nil {
+		panic(err)
+	}
+	active, _ = d.SelectActiveLabels(actor.Did)
+	assert.Equal(t, 0, len(active))
+
+	posts, err := d.SelectMilestone("hundred-days", SQLiteMaxInt, 10)
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(t, 0, len(posts))
+}
@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"context"
 	"database/sql"
-	"encoding/hex"
 	"errors"
 	"fmt"
 	"log"
@@ -15,10 +14,12 @@ import (
 	"time"
 
 	"github.com/bluesky-social/indigo/api/atproto"
-	"github.com/bluesky-social/indigo/atproto/crypto"
+	indigocrypto "github.com/bluesky-social/indigo/atproto/crypto"
 	"github.com/flicknow/go-bluesky-bot/pkg/clock"
 	"github.com/flicknow/go-bluesky-bot/pkg/cmd"
+	"github.com/flicknow/go-bluesky-bot/pkg/crypto"
 	"github.com/flicknow/go-bluesky-bot/pkg/firehose"
+	"github.com/flicknow/go-bluesky-bot/pkg/labeler"
 	"github.com/flicknow/go-bluesky-bot/pkg/metrics"
 	"github.com/flicknow/go-bluesky-bot/pkg/utils"
 	"github.com/jmoiron/sqlx"
@@ -38,7 +39,6 @@ var SKYTAN = "did:plc:ikvaup2d6nlir7xfm5vgzvra"
 var SQLiteMaxInt int64 = 9223372036854775807
 var PinnedFollowPostUrl = "at://did:plc:wzsilnxf24ehtmmc3gssy5bu/app.bsky.feed.post/3kexw5q5mix22"
 var PinnedFollowPost *PostRow = nil
-var Collector *metrics.Collector = metrics.NewCollector(len(os.Getenv("GO_BLUESKY_METRICS")) > 0)
 var SlowQueryThresholdMs int64 = 1000
 var SQLiteDriver = "sqlite3_default"
 var SQLiteMMapSize = 0
@@ -49,23 +49,33 @@ var BangerRegex = regexp.MustCompile(`^\W*banger\b`)
 
 type DBx struct {
 	Actors           *DBxTableActors
+	Blocks           *DBxTableBlocks
 	CustomLabels     *DBxTableCustomLabels
 	Dms              *DBxTableDms
 	Follows          *DBxTableFollows
 	FollowsIndexed   *DBxTableFollowsIndexed
+	Interactions     *DBxTableInteractions
 	Labels           *DBxTableLabels
+	LabelAudits      *DBxTableLabelAudits
 	Likes            *DBxTableLikes
 	Mentions         *DBxTableMentions
 	Posts            *DBxTablePosts
 	PostLabels       *DBxTablePostLabels
 	Quotes           *DBxTableQuotes
 	Replies          *DBxTableReplies
+	Reports          *DBxTableReports
 	Reposts          *DBxTableReposts
 	ThreadMentions   *DBxTableThreadMentions
 	clock            clock.Clock
 	debug            bool
 	extendedIndexing bool
-	SigningKey       *crypto.PrivateKeyK256
+	LabelDefinitions *labeler.Definitions
+	SigningKey       *crypto.SigningKey
+	SigningKeys      *crypto.KeySet
+}
+
+func (d *DBx) ValidateLabels(vals ...string) error {
+	return d.LabelDefinitions.Validate(vals...)
 }
 
 func (d *DBx) Block(did string) error {
@@ -142,6 +152,7 @@ func RetryDbIsLocked(f func() error) func() error {
 				return err
 			}
 			fmt.Printf("> RETRY %d: %+v\n", i+1, err)
+			metrics.DbLockRetries.Inc()
 		}
 		fmt.Printf("> OUT OF RETRIES RETURNING ERR: %+v\n", err)
 		return err
@@ -149,6 +160,8 @@ func RetryDbIsLocked(f func() error) func() error {
 }
 
 func (d *DBx) InsertLike(likeRef *firehose.LikeRef) error {
+	defer metrics.TimeIndex("likes", "insert")()
+
 	uri := likeRef.Ref.Uri
 	did := utils.ParseDid(uri)
 	isMark := did == MARK
@@ -231,50 +244,13 @@ func (d *DBx) InsertLike(likeRef *firehose.LikeRef) error {
 				return nil
 			}
 
-			banger, err := d.Labels.FindOrCreateLabel("banger")
-			if err != nil {
-				log.Printf("ERROR retrieving banger label: %+v\n", err)
+			_, err := d.IssueTargetLabels("", []*LabelTarget{PostLabelTarget(post)}, "banger", false)
+			if errors.Is(err, labeler.ErrUnknownLabel) {
+				log.Printf("ERROR issuing banger label: %+v\n", err)
 				return nil
 			}
 
-			now := d.clock.NowUnix()
-			ver := int64(1)
-			label := &atproto.LabelDefs_Label{
-				Cts: time.Unix(now, 0).UTC().Format(time.RFC3339),
-				Src: LabelerDid,
-				Uri: utils.HydrateUri(post.DehydratedUri, "app.bsky.feed.post"),
-				Val: "banger",
-				Ver: &ver,
-			}
-
-			sigBuf := new(bytes.Buffer)
-			err = label.MarshalCBOR(sigBuf)
-			if err != nil {
-				return err
-			}
-
-			sigBytes, err := d.SigningKey.HashAndSign(sigBuf.Bytes())
-			if err != nil {
-				return err
-			}
-			label.Sig = sigBytes
-
-			cborBuf := new(bytes.Buffer)
-			err = label.MarshalCBOR(cborBuf)
-			if err != nil {
-				return err
-			}
-
-			row := &CustomLabel{
-				SubjectType: PostLabelType,
-				SubjectId:   post.PostId,
-				CreatedAt:   now,
-				LabelId:     banger.LabelId,
-				Neg:         0,
-				Cbor:        cborBuf.Bytes(),
-			}
-
-			return d.CustomLabels.InsertLabels([]*CustomLabel{row})
+			return err
 		},
 	)
 	if len(errs) > 0 {
@@ -290,6 +266,8 @@ func (d *DBx) InsertLike(likeRef *firehose.LikeRef) error {
 }
 
 func (d *DBx) InsertRepost(repostRef *firehose.RepostRef) error {
+	defer metrics.TimeIndex("reposts", "insert")()
+
 	if !d.extendedIndexing {
 		return nil
 	}
@@ -373,15 +351,7 @@ func (d *DBx) InsertRepost(repostRef *firehose.RepostRef) error {
 }
 
 func (d *DBx) InsertPost(postRef *firehose.PostRef, actorRow *ActorRow, labels ...string) (*PostRow, error) {
-	/*
-		clock := d.clock
-		startMethod := clock.NowUnixMilli()
-		metric := metrics.NewInsertPost()
-		defer func() {
-			metric.Val = clock.NowUnixMilli() - startMethod
-			Collector.InsertPost(metric)
-		}()
-	*/
+	defer metrics.TimeIndex("posts", "insert")()
 
 	post := postRef.Post
 	quote := postRef.Quotes
@@ -408,18 +378,25 @@ func (d *DBx) InsertPost(postRef *firehose.PostRef, actorRow *ActorRow, labels .
 
 	parentDid := ""
 	parentUri := ""
+	rootUri := ""
 	ignorePinReply := false
 	if (post.Reply != nil) && (post.Reply.Parent != nil) {
 		parentUri = post.Reply.Parent.Uri
 		parentDid = utils.ParseDid(parentUri)
 		ignorePinReply = (post.Text == "📌") && (parentDid == SKYTAN)
+
+		rootUri = parentUri
+		if (post.Reply.Root != nil) && (post.Reply.Root.Uri != "") {
+			rootUri = post.Reply.Root.Uri
+		}
 	}
 
 	deferredPostid := NewDeferredInt64()
 	deferredParent := NewDeferredPost()
 	deferredQuoted := NewDeferredPost()
-	//deferredRoot := NewDeferredPost()
+	deferredRoot := NewDeferredPost()
 	deferredParentActor := NewDeferredInt64()
+	deferredRootActor := NewDeferredInt64()
 	deferredQuotedActor := NewDeferredInt64()
 	deferredMentionedActors := NewDeferredInt64s()
 
@@ -435,6 +412,7 @@ func (d *DBx) InsertPost(postRef *firehose.PostRef, actorRow *ActorRow, labels .
 				ActorId:       actorRow.ActorId,
 				CreatedAt:     now,
 				Labeled:       0,
+				Cid:           postRef.Ref.Cid,
 			}
 			if !postRef.HasMedia() {
 				postRow.Labeled = 1
@@ -457,22 +435,15 @@ func (d *DBx) InsertPost(postRef *firehose.PostRef, actorRow *ActorRow, labels .
 				//metric.FindPosts = clock.NowUnixMilli() - startMethod
 				deferredParent.Cancel()
 				deferredQuoted.Cancel()
-				//deferredRoot.Cancel()
+				deferredRoot.Cancel()
 			}()
 
-			//rootUri := ""
-
 			uris := make([]string, 0, 3)
-			if post.Reply != nil {
-				if post.Reply.Parent != nil {
-					uris = append(uris, parentUri)
-				}
-				/*
-					if post.Reply.Root != nil {
-						rootUri = post.Reply.Root.Uri
-						uris = append(uris, rootUri)
-					}
-				*/
+			if parentUri != "" {
+				uris = append(uris, parentUri)
+			}
+			if (rootUri != "") && (rootUri != parentUri) {
+				uris = append(uris, rootUri)
 			}
 
 			if quote != "" {
@@ -492,11 +463,9 @@ func (d *DBx) InsertPost(postRef *firehose.PostRef, actorRow *ActorRow, labels .
 				if parentUri == uri {
 					deferredParent.Done(post)
 				}
-				/*
-					if rootUri == uri {
-						deferredRoot.Done(post)
-					}
-				*/
+				if rootUri == uri {
+					deferredRoot.Done(post)
+				}
 				if quote == uri {
 					deferredQuoted.Done(post)
 				}
@@ -532,12 +501,10 @@ func (d *DBx) InsertPost(postRef *firehose.PostRef, actorRow *ActorRow, labels .
 				}
 			}
 
-			/*
-				rootRow := deferredRoot.Get()
-				if rootRow == nil {
-					rootRow = &PostRow{}
-				}
-			*/
+			rootRow := deferredRoot.Get()
+			if rootRow == nil {
+				rootRow = &PostRow{ActorId: deferredRootActor.Get()}
+			}
 
 			postid := deferredPostid.Get()
 			if postid == 0 {
@@ -550,8 +517,8 @@ func (d *DBx) InsertPost(postRef *firehose.PostRef, actorRow *ActorRow, labels .
 				ActorId:       actorRow.ActorId,
 				ParentId:      parentRow.PostId,
 				ParentActorId: parentRow.ActorId,
-				//RootId:        rootRow.PostId,
-				//RootActorId:   rootRow.ActorId,
+				RootId:        rootRow.PostId,
+				RootActorId:   rootRow.ActorId,
 			}
 
 			e := d.Replies.InsertReply(replyRow)
@@ -568,9 +535,10 @@ func (d *DBx) InsertPost(postRef *firehose.PostRef, actorRow *ActorRow, labels .
 				deferredParentActor.Cancel()
 				deferredQuotedActor.Cancel()
 				deferredMentionedActors.Cancel()
+				deferredRootActor.Cancel()
 			}()
 
-			dids := make([]string, 0, len(postRef.Mentions)+1)
+			dids := make([]string, 0, len(postRef.Mentions)+2)
 
 			parentDid := ""
 			if parentUri != "" {
@@ -578,6 +546,12 @@ func (d *DBx) InsertPost(postRef *firehose.PostRef, actorRow *ActorRow, labels .
 				dids = append(dids, parentDid)
 			}
 
+			rootDid := ""
+			if rootUri != "" {
+				rootDid = utils.ParseDid(rootUri)
+				dids = append(dids, rootDid)
+			}
+
 			quotedDid := ""
 			if quote != "" {
 				quotedDid = utils.ParseDid(quote)
@@ -607,6 +581,9 @@ func (d *DBx) InsertPost(postRef *firehose.PostRef, actorRow *ActorRow, labels .
 				if parentDid == did {
 					deferredParentActor.Done(id)
 				}
+				if rootDid == did {
+					deferredRootActor.Done(id)
+				}
 				if quotedDid == did {
 					deferredQuotedActor.Done(id)
 				}
@@ -909,6 +886,32 @@ func SQLxMustOpen(path string, initsql string) *sqlx.DB {
 	return db
 }
 
+func SQLxMustAddColumn(db *sqlx.DB, table string, column string, definition string) {
+	columns := make([]struct {
+		Cid        int64          `db:"cid"`
+		Name       string         `db:"name"`
+		Type       string         `db:"type"`
+		NotNull    int64          `db:"notnull"`
+		Default    sql.NullString `db:"dflt_value"`
+		PrimaryKey int64          `db:"pk"`
+	}, 0)
+	err := db.Select(&columns, fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		panic(err)
+	}
+
+	for _, col := range columns {
+		if col.Name == column {
+			return
+		}
+	}
+
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	if err != nil {
+		panic(fmt.Errorf("cannot add column %s to %s: %w", column, table, err))
+	}
+}
+
 func SQLxOpen(path string, initsql string) (*sqlx.DB, error) {
 	exists, err := DbExists(path)
 	if err != nil {
@@ -977,15 +980,7 @@ func sortByPostIdDesc(posts []*PostRow) []*PostRow {
 }
 
 func (d *DBx) DeletePost(uri string) error {
-	/*
-		clock := d.clock
-		startMethod := clock.NowUnixMilli()
-		metric := metrics.NewDeletePost()
-		defer func() {
-			metric.Val = clock.NowUnixMilli() - startMethod
-			Collector.DeletePost(metric)
-		}()
-	*/
+	defer metrics.TimeIndex("posts", "delete")()
 
 	postrow, err := d.Posts.FindByUri(uri)
 	if err != nil {
@@ -1229,6 +1224,8 @@ func (d *DBx) DeletePost(uri string) error {
 }
 
 func (d *DBx) DeleteLike(uri string) error {
+	defer metrics.TimeIndex("likes", "delete")()
+
 	did := utils.ParseDid(uri)
 	isMark := did == MARK
 
@@ -1258,12 +1255,6 @@ func (d *DBx) DeleteLike(uri string) error {
 				return nil
 			}
 
-			banger, err := d.Labels.FindOrCreateLabel("banger")
-			if err != nil {
-				log.Printf("ERROR retrieving banger label: %+v\n", err)
-				return nil
-			}
-
 			posts, err := d.Posts.SelectPostsById([]int64{likerow.SubjectId})
 			if err != nil {
 				log.Printf("ERROR retrieving banger post %d: %+v\n", likerow.SubjectId, err)
@@ -1273,47 +1264,13 @@ func (d *DBx) DeleteLike(uri string) error {
 				return nil
 			}
 
-			post := posts[0]
-			now := d.clock.NowUnix()
-			neg := true
-			ver := int64(1)
-			label := &atproto.LabelDefs_Label{
-				Cts: time.Unix(now, 0).UTC().Format(time.RFC3339),
-				Src: LabelerDid,
-				Uri: utils.HydrateUri(post.DehydratedUri, "app.bsky.feed.post"),
-				Val: "banger",
-				Neg: &neg,
-				Ver: &ver,
-			}
-
-			sigBuf := new(bytes.Buffer)
-			err = label.MarshalCBOR(sigBuf)
-			if err != nil {
-				return err
-			}
-
-			sigBytes, err := d.SigningKey.HashAndSign(sigBuf.Bytes())
-			if err != nil {
-				return err
-			}
-			label.Sig = sigBytes
-
-			cborBuf := new(bytes.Buffer)
-			err = label.MarshalCBOR(cborBuf)
-			if err != nil {
-				return err
-			}
-
-			row := &CustomLabel{
-				SubjectType: PostLabelType,
-				SubjectId:   likerow.SubjectId,
-				CreatedAt:   now,
-				LabelId:     banger.LabelId,
-				Neg:         1,
-				Cbor:        cborBuf.Bytes(),
+			_, err = d.IssueTargetLabels("", []*LabelTarget{PostLabelTarget(posts[0])}, "banger", true)
+			if errors.Is(err, labeler.ErrUnknownLabel) {
+				log.Printf("ERROR negating banger label: %+v\n", err)
+				return nil
 			}
 
-			return d.CustomLabels.InsertLabels([]*CustomLabel{row})
+			return err
 		},
 	)
 	if len(errs) > 0 {
@@ -1329,6 +1286,8 @@ func (d *DBx) DeleteLike(uri string) error {
 }
 
 func (d *DBx) DeleteRepost(uri string) error {
+	defer metrics.TimeIndex("reposts", "delete")()
+
 	if !d.extendedIndexing {
 		return nil
 	}
@@ -1364,15 +1323,7 @@ func (d *DBx) DeleteRepost(uri string) error {
 }
 
 func (d *DBx) InsertFollow(followRef *firehose.FollowRef) error {
-	/*
-		clock := d.clock
-		startMethod := clock.NowUnixMilli()
-		metric := metrics.NewInsertFollow()
-		defer func() {
-			metric.Val = clock.NowUnixMilli() - startMethod
-			Collector.InsertFollow(metric)
-		}()
-	*/
+	defer metrics.TimeIndex("follows", "insert")()
 
 	uri := followRef.Ref.Uri
 	deferredActorId := NewDeferredInt64()
@@ -1484,16 +1435,77 @@ func (d *DBx) InsertFollow(followRef *firehose.FollowRef) error {
 
 	return nil
 }
+
+// InsertBlock keeps every block with at least one end we've already seen,
+// since any known actor may become a viewer later, and creates the actor at
+// the other end if needed. Blocks between two unknown actors are dropped.
+func (d *DBx) InsertBlock(blockRef *firehose.BlockRef) error {
+	defer metrics.TimeIndex("blocks", "insert")()
+
+	uri := blockRef.Ref.Uri
+	author := utils.ParseDid(uri)
+	rkey := utils.ParseRkey(uri)
+	if (author == "") || (rkey == "") || (author == blockRef.Subject) {
+		return nil
+	}
+
+	actors, err := d.Actors.FindActors([]string{author, blockRef.Subject})
+	if err != nil {
+		return err
+	} else if len(actors) == 0 {
+		return nil
+	}
+
+	row := &BlockRow{Rkey: rkey, CreatedAt: d.clock.NowUnix()}
+	for _, actor := range actors {
+		if actor.Did == author {
+			row.ActorId = actor.ActorId
+		}
+		if actor.Did == blockRef.Subject {
+			row.SubjectId = actor.ActorId
+		}
+	}
+
+	if row.ActorId == 0 {
+		actor, err := d.Actors.FindOrCreateActor(author)
+		if err != nil {
+			return err
+		}
+		row.ActorId = actor.ActorId
+	}
+	if row.SubjectId == 0 {
+		subject, err := d.Actors.FindOrCreateActor(blockRef.Subject)
+		if err != nil {
+			return err
+		}
+		row.SubjectId = subject.ActorId
+	}
+
+	_, err = d.Blocks.InsertBlock(row)
+	return err
+}
+
+func (d *DBx) DeleteBlock(uri string) error {
+	defer metrics.TimeIndex("blocks", "delete")()
+
+	did := utils.ParseDid(uri)
+	rkey := utils.ParseRkey(uri)
+	if (did == "") || (rkey == "") {
+		return nil
+	}
+
+	actorrow, err := d.Actors.FindActor(did)
+	if err != nil {
+		return err
+	} else if actorrow == nil {
+		return nil
+	}
+
+	return d.Blocks.DeleteBlock(actorrow.ActorId, rkey)
+}
+
 func (d *DBx) DeleteFollow(uri string) error {
-	/*
-		clock := d.clock
-		startMethod := clock.NowUnixMilli()
-		metric := metrics.NewDeleteFollow()
-		defer func() {
-			metric.Val = clock.NowUnixMilli() - startMethod
-			Collector.DeleteFollow(metric)
-		}()
-	*/
+	defer metrics.TimeIndex("follows", "delete")()
 
 	did := utils.ParseDid(uri)
 	if did == "" {
@@ -1540,9 +1552,24 @@ func queryHasResults(d queryable, q string, args ...interface{}) (bool, error) {
 	return hit != 0, nil
 }
 
+// CheckWritable takes and releases the posts db's write lock, which fails
+// if the db is read only or another writer has held it too long.
+func (d *DBx) CheckWritable(ctx context.Context) error {
+	tx, err := d.Posts.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	return tx.Rollback()
+}
+
 func (d *DBx) Prune(since int64, limit int) (int, error) {
+	err := d.Interactions.PruneInteractions(since)
+	if err != nil {
+		return 0, err
+	}
+
 	postrows := make([]*PostRow, 0, limit)
-	err := d.Posts.Select(&postrows, "SELECT post_id FROM posts WHERE created_at < $1 ORDER BY created_at ASC, post_id ASC LIMIT $2", since, limit)
+	err = d.Posts.Select(&postrows, "SELECT post_id FROM posts WHERE created_at < $1 ORDER BY created_at ASC, post_id ASC LIMIT $2", since, limit)
 	if errors.Is(err, sql.ErrNoRows) || (len(postrows) == 0) {
 		return 0, nil
 	} else if err != nil {
@@ -1724,12 +1751,26 @@ func (d *DBx) selectMentions(before int64, limit int, actorid int64) ([]*PostRow
 		return nil, false, errors.New(msg)
 	}
 
+	sources := make(map[int64]string)
+	for _, id := range replies {
+		sources[id] = PostSourceReply
+	}
+	for _, id := range quotes {
+		sources[id] = PostSourceQuote
+	}
+	for _, id := range mentions {
+		sources[id] = PostSourceMention
+	}
+
 	postids := uniqueInt64s(concatInt64s(mentions, quotes, replies))
 	posts, err := d.Posts.SelectPostsById(postids)
 	if err != nil {
 		return nil, false, err
 	}
 
+	for _, post := range posts {
+		post.Source = sources[post.PostId]
+	}
 	sortByPostIdDesc(posts)
 
 	if len(posts) <= limit {
@@ -1777,36 +1818,60 @@ func (d *DBx) SelectMentions(before int64, limit int, did string) ([]*PostRow, e
 	return mentions, nil
 }
 
-func (d *DBx) SelectQuotesForUri(uri string) ([]*PostRow, error) {
+// SelectQuotesForUri returns the post at uri, or nil if it isn't indexed,
+// and a page of the posts quoting it, newest first.
+func (d *DBx) SelectQuotesForUri(uri string, before int64, limit int) (*PostRow, []*PostRow, error) {
 	post, err := d.Posts.FindByUri(uri)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	if (post == nil) || (post.PostId == 0) {
-		return nil, nil
+		return nil, nil, nil
 	}
 
-	last := SQLiteMaxInt
-	quotes := make([]int64, 0)
-	chunk := 100
-	for {
-		ids, err := d.Quotes.SelectQuotesBySubjectId(post.PostId, last, chunk)
-		if err != nil {
-			return nil, err
-		}
-		if ids == nil {
-			break
-		}
+	quotes, err := d.SelectQuotesForPost(post, before, limit)
+	if err != nil {
+		return nil, nil, err
+	}
 
-		quotes = append(quotes, ids...)
-		if len(quotes) < chunk {
-			break
-		}
+	return post, quotes, nil
+}
+
+func (d *DBx) SelectQuotesForPost(post *PostRow, before int64, limit int) ([]*PostRow, error) {
+	if before == 0 {
+		before = SQLiteMaxInt
+	}
+
+	ids, err := d.Quotes.SelectQuotesBySubjectId(post.PostId, before, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	quotes, err := d.Posts.SelectPostsById(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	return sortByPostIdDesc(quotes), nil
+}
+
+// CountQuotes sets Quotes on each post to the number of indexed posts
+// quoting it.
+func (d *DBx) CountQuotes(posts ...*PostRow) error {
+	ids := make([]int64, len(posts))
+	for i, post := range posts {
+		ids[i] = post.PostId
+	}
 
-		last = quotes[len(quotes)-1]
+	counts, err := d.Quotes.CountQuotesBySubjectIds(uniqueInt64s(ids))
+	if err != nil {
+		return err
 	}
 
-	return d.Posts.SelectPostsById(quotes)
+	for _, post := range posts {
+		post.Quotes = counts[post.PostId]
+	}
+	return nil
 }
 
 func (d *DBx) SelectQuotes(before int64, limit int, did string) ([]*PostRow, error) {
@@ -1830,6 +1895,9 @@ func (d *DBx) SelectQuotes(before int64, limit int, did string) ([]*PostRow, err
 		return nil, err
 	}
 
+	for _, post := range posts {
+		post.Source = PostSourceQuote
+	}
 	sortByPostIdDesc(posts)
 
 	if len(posts) <= limit {
@@ -1839,6 +1907,153 @@ func (d *DBx) SelectQuotes(before int64, limit int, did string) ([]*PostRow, err
 	return posts[:limit], nil
 }
 
+func (d *DBx) selectRepliesPage(postids []int64) ([]*PostRow, error) {
+	posts, err := d.Posts.SelectPostsById(uniqueInt64s(postids))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, post := range posts {
+		post.Source = PostSourceReply
+	}
+	return sortByPostIdDesc(posts), nil
+}
+
+// SelectReplies finds replies by others to the actor's posts.
+func (d *DBx) SelectReplies(before int64, limit int, did string) ([]*PostRow, error) {
+	actor, err := d.Actors.FindOrCreateActor(did)
+	if err != nil {
+		return nil, err
+	} else if (actor == nil) || (actor.ActorId == 0) {
+		fmt.Printf("no actor found for %s\n", did)
+		return nil, nil
+	}
+
+	postids, err := d.Replies.SelectRepliesToActorId(actor.ActorId, before, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.selectRepliesPage(postids)
+}
+
+// SelectConversations finds replies by others anywhere in threads the actor
+// started.
+func (d *DBx) SelectConversations(before int64, limit int, did string) ([]*PostRow, error) {
+	actor, err := d.Actors.FindOrCreateActor(did)
+	if err != nil {
+		return nil, err
+	} else if (actor == nil) || (actor.ActorId == 0) {
+		fmt.Printf("no actor found for %s\n", did)
+		return nil, nil
+	}
+
+	postids, err := d.Replies.SelectRepliesToRootActorId(actor.ActorId, before, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.selectRepliesPage(postids)
+}
+
+// SelectThreadRepliesFollowed finds replies from the actor's follows in
+// threads the actor started or has replied in.
+func (d *DBx) SelectThreadRepliesFollowed(before int64, limit int, did string) ([]*PostRow, error) {
+	deferredFollows := NewDeferredInt64s()
+
+	actor, err := d.Actors.FindOrCreateActor(did)
+	if err != nil {
+		return nil, err
+	}
+	if actor.Blocked {
+		return nil, nil
+	}
+	actorid := actor.ActorId
+
+	isIndexed := false
+	postids := make([]int64, 0, limit)
+	errs := ParallelizeFuncsWithRetries(
+		func() error {
+			defer deferredFollows.Cancel()
+
+			if actorid == 0 {
+				return nil
+			}
+
+			follows, indexed, err := d.selectFollows(actorid)
+			if err != nil {
+				return err
+			}
+
+			isIndexed = indexed
+			deferredFollows.Done(follows)
+
+			return nil
+		},
+		func() error {
+			if actorid == 0 {
+				return nil
+			}
+
+			var isFollow map[int64]bool = nil
+
+			for {
+				replies, err := d.Replies.SelectRepliesInThreadsOfActorId(actorid, before, limit)
+				if err != nil {
+					return err
+				}
+
+				if isFollow == nil {
+					follows := deferredFollows.Get()
+					if (follows == nil) || (len(follows) == 0) {
+						return nil
+					}
+
+					isFollow = make(map[int64]bool)
+					for _, follow := range follows {
+						isFollow[follow] = true
+					}
+				}
+
+				for _, reply := range replies {
+					if isFollow[reply.ActorId] {
+						postids = append(postids, reply.PostId)
+					}
+				}
+
+				if (len(replies) < limit) || (len(postids) >= limit) {
+					return nil
+				}
+
+				before = replies[len(replies)-1].PostId
+			}
+		},
+	)
+	if len(errs) > 0 {
+		msg := fmt.Sprintf("Error selecting followed thread replies for %s:", did)
+		for _, e := range errs {
+			msg = fmt.Sprintf("%s\n%s", msg, e)
+		}
+		log.Print(msg)
+		return nil, errors.New(msg)
+	}
+
+	if len(postids) > limit {
+		postids = postids[:limit]
+	}
+
+	posts, err := d.selectRepliesPage(postids)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isIndexed && (PinnedFollowPost != nil) {
+		posts = append([]*PostRow{PinnedFollowPost}, posts...)
+	}
+
+	return posts, nil
+}
+
 func (d *DBx) selectFollows(actorid int64) ([]int64, bool, error) {
 	f := d.Follows
 
@@ -1889,13 +2104,13 @@ func (d *DBx) selectFollows(actorid int64) ([]int64, bool, error) {
 	return follows, indexed, nil
 }
 
-func (d *DBx) selectActorsWithBirthdays(actorids []int64) ([]int64, error) {
+func (d *DBx) selectActorsWithLabel(val string, actorids []int64) ([]int64, error) {
 	if (actorids == nil) || (len(actorids) == 0) {
 		return []int64{}, nil
 	}
 
 	birthdayboys := make([]int64, 0, len(actorids))
-	birthday, err := d.Labels.FindOrCreateLabel("birthday")
+	birthday, err := d.Labels.FindOrCreateLabel(val)
 	if err != nil {
 		return nil, err
 	}
@@ -1930,8 +2145,8 @@ func (d *DBx) selectActorsWithBirthdays(actorids []int64) ([]int64, error) {
 	return birthdayboys, nil
 }
 
-func (d *DBx) selectAllBirthdays() ([]int64, error) {
-	label, err := d.Labels.FindOrCreateLabel("birthday")
+func (d *DBx) selectAllActorsWithLabel(val string) ([]int64, error) {
+	label, err := d.Labels.FindOrCreateLabel(val)
 	if err != nil {
 		return nil, err
 	}
@@ -2008,8 +2223,8 @@ func (d *DBx) SelectBangers(before int64, limit int) ([]*PostRow, error) {
 		if post == nil {
 			continue
 		}
-		// set postid to customlabelid to use customlabelid as cursor
-		post.PostId = label.CustomLabelId
+		// bangers page by when the label was issued, not when the post was made
+		post.Position = label.CustomLabelId
 		sortedPosts = append(sortedPosts, post)
 	}
 
@@ -2017,7 +2232,13 @@ func (d *DBx) SelectBangers(before int64, limit int) ([]*PostRow, error) {
 }
 
 func (d *DBx) SelectBirthdays(before int64, limit int) ([]*PostRow, error) {
-	birthdayboys, err := d.selectAllBirthdays()
+	return d.SelectMilestone("birthday", before, limit)
+}
+
+// SelectMilestone selects recent posts by actors currently carrying the
+// milestone account label val.
+func (d *DBx) SelectMilestone(val string, before int64, limit int) ([]*PostRow, error) {
+	birthdayboys, err := d.selectAllActorsWithLabel(val)
 	if err != nil {
 		return nil, err
 	}
@@ -2047,6 +2268,10 @@ func (d *DBx) SelectBirthdays(before int64, limit int) ([]*PostRow, error) {
 }
 
 func (d *DBx) SelectBirthdaysFollowed(before int64, limit int, did string) ([]*PostRow, error) {
+	return d.SelectMilestoneFollowed("birthday", before, limit, did)
+}
+
+func (d *DBx) SelectMilestoneFollowed(val string, before int64, limit int, did string) ([]*PostRow, error) {
 	actor, err := d.Actors.FindOrCreateActor(did)
 	if err != nil {
 		return nil, err
@@ -2064,7 +2289,7 @@ func (d *DBx) SelectBirthdaysFollowed(before int64, limit int, did string) ([]*P
 		return nil, err
 	}
 
-	birthdayboys, err := d.selectActorsWithBirthdays(follows)
+	birthdayboys, err := d.selectActorsWithLabel(val, follows)
 	if err != nil {
 		return nil, err
 	}
@@ -2312,6 +2537,9 @@ func (d *DBx) SelectAllMentions(before int64, limit int, did string) ([]*PostRow
 		return nil, err
 	}
 
+	for _, post := range posts {
+		post.Source = PostSourceThreadMention
+	}
 	return sortByPostIdDesc(posts), nil
 }
 
@@ -2334,6 +2562,9 @@ func (d *DBx) SelectDms(before int64, limit int, did string) ([]*PostRow, error)
 		return nil, err
 	}
 
+	for _, post := range posts {
+		post.Source = PostSourceDm
+	}
 	return sortByPostIdDesc(posts), nil
 }
 
@@ -2378,6 +2609,38 @@ func (d *DBx) SelectPostsByLabels(before int64, limit int, labelNames ...string)
 	return posts[:limit], nil
 }
 
+// selectRepostsByFollows finds the latest repost by a follow of each post
+// that wasn't written by a follow.
+func (d *DBx) selectRepostsByFollows(posts []*PostRow, isFollow map[int64]bool) (map[int64]*RepostRow, error) {
+	subjectids := make([]int64, 0, len(posts))
+	for _, post := range posts {
+		if !isFollow[post.ActorId] {
+			subjectids = append(subjectids, post.PostId)
+		}
+	}
+
+	if len(subjectids) == 0 {
+		return map[int64]*RepostRow{}, nil
+	}
+
+	follows := make([]int64, 0, len(isFollow))
+	for follow := range isFollow {
+		follows = append(follows, follow)
+	}
+
+	rows, err := d.Reposts.SelectLatestRepostsBySubjectIds(subjectids, follows)
+	if err != nil {
+		return nil, err
+	}
+
+	reposts := make(map[int64]*RepostRow)
+	for _, repost := range rows {
+		reposts[repost.SubjectId] = repost
+	}
+
+	return reposts, nil
+}
+
 func (d *DBx) SelectPostsByLabelsFollowed(before int64, limit int, did string, labelNames ...string) ([]*PostRow, error) {
 	deferredFollows := NewDeferredInt64s()
 
@@ -2432,9 +2695,18 @@ func (d *DBx) SelectPostsByLabelsFollowed(before int64, limit int, did string, l
 					}
 				}
 
+				reposts, err := d.selectRepostsByFollows(posts, isFollow)
+				if err != nil {
+					return err
+				}
+
 				for _, post := range posts {
 					if isFollow[post.ActorId] {
 						results = append(results, post)
+					} else if repost := reposts[post.PostId]; repost != nil {
+						post.Source = PostSourceRepost
+						post.RepostUri = repost.Uri
+						results = append(results, post)
 					}
 				}
 
@@ -2738,155 +3010,312 @@ func (d *DBx) SelectPostLabels(since int64, limit int) ([]*LabelDef, error) {
 
 	return labelDefs, nil
 }
-func (d *DBx) RecordBirthdayLabels(t clock.Clock, yearsAgo int) error {
-	now := time.Unix(t.NowUnix(), 0)
-	endWindow := now.AddDate(-1*yearsAgo, 0, 0)
+
+// selectActorsReaching finds actors who turned the given age within the
+// ten minutes before at.
+func (d *DBx) selectActorsReaching(at time.Time, years int, days int) ([]*ActorRow, error) {
+	endWindow := at.AddDate(-1*years, 0, -1*days)
 	startWindow := endWindow.Add(-10 * time.Minute)
 
-	actors, err := d.Actors.SelectActorsWithirthdaysBetween(startWindow.Unix(), endWindow.Unix())
+	return d.Actors.SelectActorsWithirthdaysBetween(startWindow.Unix(), endWindow.Unix())
+}
+
+func (d *DBx) applyMilestoneLabels(at time.Time, val string, years int, days int) error {
+	actors, err := d.selectActorsReaching(at, years, days)
 	if err != nil {
 		return err
 	}
 
-	bday, err := d.Labels.FindOrCreateLabel("birthday")
+	targets := make([]*LabelTarget, len(actors))
+	for i, actor := range actors {
+		targets[i] = AccountLabelTarget(actor)
+	}
+
+	_, err = d.IssueTargetLabels("", targets, val, false)
+	return err
+}
+
+func (d *DBx) negateMilestoneLabels(at time.Time, val string, years int, days int) error {
+	actors, err := d.selectActorsReaching(at, years, days)
 	if err != nil {
 		return err
 	}
 
-	labels := make([]*CustomLabel, len(actors))
-	for i, actor := range actors {
-		ver := int64(1)
-		label := &atproto.LabelDefs_Label{
-			Cts: now.UTC().Format(time.RFC3339),
-			Src: LabelerDid,
-			Uri: actor.Did,
-			Val: "birthday",
-			Ver: &ver,
+	targets := make([]*LabelTarget, 0, len(actors))
+	for _, actor := range actors {
+		did := actor.Did
+		if (val == "birthday") && ((did == REM) || (did == AMELIA_BUT_ALSO_ITS_REM)) {
+			// it is always rem's birthday
+			continue
 		}
 
-		sigBuf := new(bytes.Buffer)
-		err := label.MarshalCBOR(sigBuf)
-		if err != nil {
-			return err
-		}
+		targets = append(targets, AccountLabelTarget(actor))
+	}
 
-		sigBytes, err := d.SigningKey.HashAndSign(sigBuf.Bytes())
+	_, err = d.IssueTargetLabels("", targets, val, true)
+	return err
+}
+
+// RecordMilestoneLabels applies the milestone's label to actors who just
+// reached it and negates it on actors who reached it Duration ago.
+func (d *DBx) RecordMilestoneLabels(t clock.Clock, m *labeler.Milestone) error {
+	now := time.Unix(t.NowUnix(), 0)
+	for _, age := range m.Ages(now) {
+		err := d.applyMilestoneLabels(now, m.Label, age[0], age[1])
 		if err != nil {
 			return err
 		}
-		label.Sig = sigBytes
 
-		cborBuf := new(bytes.Buffer)
-		err = label.MarshalCBOR(cborBuf)
+		err = d.negateMilestoneLabels(now.Add(-1*m.Duration.Duration), m.Label, age[0], age[1])
 		if err != nil {
 			return err
 		}
-
-		labels[i] = &CustomLabel{
-			SubjectType: AccountLabelType,
-			SubjectId:   actor.ActorId,
-			CreatedAt:   now.Unix(),
-			LabelId:     bday.LabelId,
-			Neg:         0,
-			Cbor:        cborBuf.Bytes(),
-		}
 	}
 
-	return d.CustomLabels.InsertLabels(labels)
+	return nil
+}
+
+func (d *DBx) RecordBirthdayLabels(t clock.Clock, yearsAgo int) error {
+	return d.applyMilestoneLabels(time.Unix(t.NowUnix(), 0), "birthday", yearsAgo, 0)
 }
 
 func (d *DBx) RecordUnbirthdayLabels(t clock.Clock, yearsAgo int) error {
-	now := time.Unix(t.NowUnix(), 0)
-	endWindow := now.AddDate(-1*yearsAgo, 0, -1)
-	startWindow := endWindow.Add(-10 * time.Minute)
+	return d.negateMilestoneLabels(time.Unix(t.NowUnix(), 0), "birthday", yearsAgo, 1)
+}
 
-	actors, err := d.Actors.SelectActorsWithirthdaysBetween(startWindow.Unix(), endWindow.Unix())
+func (d *DBx) InsertAccountLabels(actor *ActorRow, vals ...string) error {
+	err := d.ValidateLabels(vals...)
 	if err != nil {
 		return err
 	}
 
-	actoridStrings := make([]string, len(actors))
-	for i, actor := range actors {
-		actoridStrings[i] = fmt.Sprintf("%d", actor.ActorId)
+	target := AccountLabelTarget(actor)
+	for _, val := range vals {
+		_, err := d.IssueTargetLabels("", []*LabelTarget{target}, val, false)
+		if err != nil {
+			return err
+		}
 	}
 
-	bday, err := d.Labels.FindOrCreateLabel("birthday")
+	return nil
+}
+
+// ResignLabels re-signs up to limit labels past since that weren't signed by
+// the active key. Each label must verify against the retired key it was
+// recorded under first, so rows signed by a foreign key or tampered with in
+// the db are never laundered into valid signatures. Negations are re-signed
+// too, since consumers drop labels signed by a key that is no longer current
+// and the label they negate would come back. Only expired labels are left
+// alone. It returns the new cursor along with how many rows were re-signed
+// and how many were skipped.
+func (d *DBx) ResignLabels(since int64, limit int) (int64, int, int, error) {
+	old, err := d.CustomLabels.SelectLabelsNotSignedBy(d.SigningKey.KeyId(), since, limit)
 	if err != nil {
-		return err
+		return since, 0, 0, err
+	}
+	if len(old) == 0 {
+		return since, 0, 0, nil
 	}
 
-	labels := make([]*CustomLabel, 0, len(actors))
-	for _, actor := range actors {
-		did := actor.Did
-		if (did == REM) || (did == AMELIA_BUT_ALSO_ITS_REM) {
-			// it is always rem's birthday
-			continue
+	now := d.clock.NowUnix()
+	stale := make([]*CustomLabel, 0, len(old))
+	rows := make([]*CustomLabel, 0, len(old))
+	for _, row := range old {
+		label := &atproto.LabelDefs_Label{}
+		err := label.UnmarshalCBOR(bytes.NewReader(row.Cbor))
+		if err != nil {
+			return since, 0, 0, fmt.Errorf("error decoding custom label %d: %w", row.CustomLabelId, err)
+		}
+
+		if label.Exp != nil {
+			exp, err := time.Parse(time.RFC3339, *label.Exp)
+			if (err == nil) && (exp.Unix() <= now) {
+				continue
+			}
 		}
 
-		neg := true
-		ver := int64(1)
-		label := &atproto.LabelDefs_Label{
-			Cts: now.UTC().Format(time.RFC3339),
-			Src: LabelerDid,
-			Uri: did,
-			Val: "birthday",
-			Neg: &neg,
-			Ver: &ver,
+		if !verifyRetiredLabel(d.SigningKeys.RetiredCandidates(row.KeyId), label) {
+			log.Printf("WARN not re-signing custom label %d: signature does not verify against retired key %q\n", row.CustomLabelId, row.KeyId)
+			continue
 		}
 
-		sigBuf := new(bytes.Buffer)
-		err := label.MarshalCBOR(sigBuf)
+		cbor, err := d.SigningKey.SignLabelAndMarshalCBOR(label)
 		if err != nil {
-			return err
+			return since, 0, 0, err
 		}
 
-		sigBytes, err := d.SigningKey.HashAndSign(sigBuf.Bytes())
+		stale = append(stale, row)
+		rows = append(
+			rows,
+			&CustomLabel{
+				SubjectType: row.SubjectType,
+				SubjectId:   row.SubjectId,
+				CreatedAt:   row.CreatedAt,
+				LabelId:     row.LabelId,
+				Neg:         row.Neg,
+				Cbor:        cbor,
+				KeyId:       d.SigningKey.KeyId(),
+			})
+	}
+
+	cursor := old[len(old)-1].CustomLabelId
+	skipped := len(old) - len(rows)
+	if len(rows) == 0 {
+		return cursor, 0, skipped, nil
+	}
+
+	err = d.CustomLabels.ReplaceLabels(stale, rows)
+	if err != nil {
+		return since, 0, 0, err
+	}
+
+	return cursor, len(rows), skipped, nil
+}
+
+func verifyRetiredLabel(keys []*crypto.SigningKey, label *atproto.LabelDefs_Label) bool {
+	for _, key := range keys {
+		pub, err := key.PublicKey()
 		if err != nil {
-			return err
+			continue
+		}
+		if crypto.VerifyLabel(pub, label) == nil {
+			return true
 		}
-		label.Sig = sigBytes
+	}
+	return false
+}
+
+// InsertReport records a report created now, by the db's clock.
+func (d *DBx) InsertReport(row *ReportRow) (*ReportRow, bool, error) {
+	row.CreatedAt = d.clock.NowUnix()
+	return d.Reports.InsertReport(row)
+}
+
+// ResolveReports closes the given reports. If val is set, the label is
+// applied to (or negated on) every reported subject first.
+func (d *DBx) ResolveReports(issuer string, ids []int64, val string, neg bool) ([]*ReportRow, error) {
+	reports, err := d.Reports.FindReports(ids)
+	if err != nil {
+		return nil, err
+	}
 
-		cborBuf := new(bytes.Buffer)
-		err = label.MarshalCBOR(cborBuf)
+	resolution := "dismissed"
+	if val != "" {
+		subjects := make([]string, len(reports))
+		for i, report := range reports {
+			subjects[i] = report.Subject
+		}
+
+		_, err := d.IssueLabels(issuer, subjects, val, neg)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
-		labels = append(
-			labels,
-			&CustomLabel{
-				SubjectType: AccountLabelType,
-				SubjectId:   actor.ActorId,
-				CreatedAt:   now.Unix(),
-				LabelId:     bday.LabelId,
-				Neg:         1,
-				Cbor:        cborBuf.Bytes(),
-			})
+		resolution = fmt.Sprintf("%s:%s", LabelAuditApply, val)
+		if neg {
+			resolution = fmt.Sprintf("%s:%s", LabelAuditNegate, val)
+		}
 	}
 
-	err = d.CustomLabels.InsertLabels(labels)
+	now := d.clock.NowUnix()
+	err = d.Reports.ResolveReports(ids, issuer, now, resolution)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	_, err = d.CustomLabels.Exec(
-		fmt.Sprintf(
-			`
-			DELETE FROM
-			custom_labels
-		  WHERE
-			label_id = $1
-			AND neg = 0
-			AND subject_type = $2
-			AND subject_id IN (%s)
-			`,
-			strings.Join(actoridStrings, ","),
-		),
-		bday.LabelId,
-		AccountLabelType,
-	)
+	for _, report := range reports {
+		report.Status = ReportStatusResolved
+		report.ResolvedBy = issuer
+		report.ResolvedAt = now
+		report.Resolution = resolution
+	}
 
-	return err
+	return reports, nil
+}
+
+var ErrUndecodableLabel = errors.New("undecodable label")
+var ErrBadLabelSignature = errors.New("bad label signature")
+var ErrUnknownLabelKey = errors.New("label signed by an unknown key")
+
+type LabelVerificationFailure struct {
+	Row   *CustomLabel
+	Label *atproto.LabelDefs_Label
+	Err   error
+}
+
+// VerifyLabels checks the signatures of up to limit custom labels after
+// since, each against the key named by its key id: pub, the published key,
+// or one of our active and retired keys. Labels recorded under a key we
+// don't have fail, as do labels that don't verify against their own key.
+// It returns the cursor for the next chunk, the number of labels checked,
+// and the ones that failed.
+func (d *DBx) VerifyLabels(pub indigocrypto.PublicKey, since int64, limit int) (int64, int, []*LabelVerificationFailure, error) {
+	rows, err := d.CustomLabels.SelectLabels(since, limit)
+	if err != nil {
+		return since, 0, nil, err
+	}
+	if len(rows) == 0 {
+		return since, 0, nil, nil
+	}
+
+	failures := make([]*LabelVerificationFailure, 0)
+	for _, row := range rows {
+		label := &atproto.LabelDefs_Label{}
+		err := label.UnmarshalCBOR(bytes.NewReader(row.Cbor))
+		if err != nil {
+			failures = append(failures, &LabelVerificationFailure{Row: row, Err: fmt.Errorf("%w: %w", ErrUndecodableLabel, err)})
+			continue
+		}
+
+		keys := d.labelVerificationKeys(pub, row.KeyId)
+		if len(keys) == 0 {
+			failures = append(failures, &LabelVerificationFailure{Row: row, Label: label, Err: fmt.Errorf("%w: %q", ErrUnknownLabelKey, row.KeyId)})
+			continue
+		}
+
+		for _, key := range keys {
+			err = crypto.VerifyLabel(key, label)
+			if err == nil {
+				break
+			}
+		}
+		if err != nil {
+			failures = append(failures, &LabelVerificationFailure{Row: row, Label: label, Err: fmt.Errorf("%w: %w", ErrBadLabelSignature, err)})
+		}
+	}
+
+	return rows[len(rows)-1].CustomLabelId, len(rows), failures, nil
+}
+
+// labelVerificationKeys returns the keys a label recorded under keyId can be
+// verified with. Labels from before key ids were recorded could have been
+// signed by any of them.
+func (d *DBx) labelVerificationKeys(pub indigocrypto.PublicKey, keyId string) []indigocrypto.PublicKey {
+	if keyId == pub.DIDKey() {
+		return []indigocrypto.PublicKey{pub}
+	}
+
+	candidates := append([]*crypto.SigningKey{d.SigningKeys.Active}, d.SigningKeys.Retired...)
+	if keyId != "" {
+		key := d.SigningKeys.Find(keyId)
+		if key == nil {
+			return nil
+		}
+		candidates = []*crypto.SigningKey{key}
+	}
+
+	keys := make([]indigocrypto.PublicKey, 0, len(candidates)+1)
+	if keyId == "" {
+		keys = append(keys, pub)
+	}
+	for _, key := range candidates {
+		k, err := key.PublicKey()
+		if err != nil {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	return keys
 }
 
 func (d *DBx) PruneCustomLabels(t clock.Clock) error {
@@ -2991,11 +3420,15 @@ func (d *DBx) Close() error {
 		func() error { return d.Follows.Close() },
 		func() error { return d.FollowsIndexed.Close() },
 		func() error { return d.Labels.Close() },
+		func() error { return d.LabelAudits.Close() },
 		func() error { return d.Mentions.Close() },
 		func() error { return d.PostLabels.Close() },
 		func() error { return d.Posts.Close() },
 		func() error { return d.Quotes.Close() },
 		func() error { return d.Replies.Close() },
+		func() error { return d.Reports.Close() },
+		func() error { return d.Interactions.Close() },
+		func() error { return d.Blocks.Close() },
 		func() error { return d.ThreadMentions.Close() },
 	)
 	if len(errs) > 0 {
@@ -3063,38 +3496,46 @@ func NewDBx(ctx context.Context) *DBx {
 		SlowQueryThresholdMs = threshold
 	}
 
-	signingKeyHex := []byte(ctx.Value("signing-key").(string))
-
-	signingKeyBytes := make([]byte, hex.DecodedLen(len(signingKeyHex)))
-	_, err = hex.Decode(signingKeyBytes, signingKeyHex)
+	signingKeyHex, _ := ctx.Value("signing-key").(string)
+	signingKeys, err := crypto.NewKeySet(signingKeyHex, cmd.StringSliceValue(ctx, "retired-signing-keys")...)
 	if err != nil {
 		panic(err)
 	}
 
-	signingKey, err := crypto.ParsePrivateBytesK256(signingKeyBytes)
-	if err != nil {
-		panic(err)
+	var labelDefinitions *labeler.Definitions = nil
+	labelDefinitionsPath, _ := ctx.Value("label-definitions").(string)
+	if labelDefinitionsPath != "" {
+		labelDefinitions, err = labeler.LoadDefinitions(labelDefinitionsPath)
+		if err != nil {
+			panic(err)
+		}
 	}
 
 	d := &DBx{
 		Actors:           NewActorTable(dir, actorCacheSize),
+		Blocks:           NewBlocksTable(dir),
 		CustomLabels:     NewCustomLabelTable(dir),
 		Dms:              NewDmTable(dir),
 		Follows:          NewFollowsTable(dir, followCacheSize),
 		FollowsIndexed:   NewFollowsIndexedTable(dir),
+		Interactions:     NewInteractionTable(dir),
 		Labels:           NewLabelTable(dir, labelCacheSize),
+		LabelAudits:      NewLabelAuditTable(dir),
 		Likes:            NewLikesTable(dir),
 		Mentions:         NewMentionTable(dir),
 		Posts:            NewPostTable(dir),
 		PostLabels:       NewPostLabelTable(dir),
 		Quotes:           NewQuoteTable(dir),
 		Replies:          NewReplyTable(dir),
+		Reports:          NewReportTable(dir),
 		Reposts:          NewRepostsTable(dir),
 		ThreadMentions:   NewThreadMentionTable(dir),
 		clock:            clk,
 		debug:            cmd.DebuggingEnabled(ctx, "db"),
 		extendedIndexing: extendedIndexing,
-		SigningKey:       signingKey,
+		LabelDefinitions: labelDefinitions,
+		SigningKey:       signingKeys.Active,
+		SigningKeys:      signingKeys,
 	}
 
 	if PinnedFollowPost == nil {
@@ -3113,3 +3554,92 @@ func init() {
 		},
 	)
 }
+
+// RecordInteractions stores the requestLess and requestMore interactions a
+// viewer sent for our feed items, ignoring every other event.
+func (d *DBx) RecordInteractions(viewer string, interactions []*InteractionRow) (int, error) {
+	actor, err := d.Actors.FindOrCreateActor(viewer)
+	if err != nil {
+		return 0, err
+	} else if (actor == nil) || (actor.ActorId == 0) {
+		return 0, fmt.Errorf("could not find actor for %s", viewer)
+	}
+
+	now := d.clock.NowUnix()
+	rows := make([]*InteractionRow, 0, len(interactions))
+	for _, row := range interactions {
+		if (row.Event != InteractionRequestLess) && (row.Event != InteractionRequestMore) {
+			continue
+		}
+
+		did := utils.ParseDid(row.Item)
+		if did == "" {
+			continue
+		}
+		// items by authors we've never indexed can't be in any of our feeds
+		author, err := d.Actors.FindActor(did)
+		if err != nil {
+			return 0, err
+		} else if (author == nil) || (author.ActorId == 0) {
+			continue
+		}
+
+		row.ViewerId = actor.ActorId
+		row.AuthorId = author.ActorId
+		row.CreatedAt = now
+		rows = append(rows, row)
+	}
+
+	return len(rows), d.Interactions.InsertInteractions(rows)
+}
+
+// FilterForViewer drops posts by authors, or reposted by actors, that the
+// viewer blocks or is blocked by, and posts by authors the viewer has
+// repeatedly asked to see less of.
+func (d *DBx) FilterForViewer(viewer string, posts []*PostRow) ([]*PostRow, error) {
+	if (viewer == "") || (len(posts) == 0) {
+		return posts, nil
+	}
+
+	actor, err := d.Actors.FindOrCreateActor(viewer)
+	if err != nil {
+		return nil, err
+	} else if (actor == nil) || (actor.ActorId == 0) {
+		return posts, nil
+	}
+
+	blocked, err := d.Blocks.SelectBlockedActorIds(actor.ActorId)
+	if err != nil {
+		return nil, err
+	}
+
+	lessWanted, err := d.Interactions.SelectLessWantedAuthors(actor.ActorId)
+	if err != nil {
+		return nil, err
+	}
+
+	if (len(blocked) == 0) && (len(lessWanted) == 0) {
+		return posts, nil
+	}
+
+	filtered := make([]*PostRow, 0, len(posts))
+	for _, post := range posts {
+		if blocked[post.ActorId] || lessWanted[post.ActorId] {
+			continue
+		}
+
+		if (post.RepostUri != "") && (len(blocked) > 0) {
+			reposter, err := d.Actors.FindOrCreateActor(utils.ParseDid(post.RepostUri))
+			if err != nil {
+				return nil, err
+			}
+			if (reposter != nil) && blocked[reposter.ActorId] {
+				continue
+			}
+		}
+
+		filtered = append(filtered, post)
+	}
+
+	return filtered, nil
+}
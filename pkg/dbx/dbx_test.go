@@ -64,6 +64,7 @@ func TestDBxInsertIgnorePinReply(t *testing.T) {
 	if err != nil {
 		panic(err)
 	}
+	reply.Source = PostSourceReply
 	assert.Equal(
 		t,
 		[]*PostRow{reply},
@@ -96,6 +97,46 @@ func TestDBxInsertQuote(t *testing.T) {
 	assert.True(t, errors.Is(err, sql.ErrNoRows))
 }
 
+func TestDBxSelectQuotesForUri(t *testing.T) {
+	d, cleanup := NewTestDBx()
+	defer cleanup()
+
+	actor := d.CreateActor()
+	op := d.CreatePost(&TestPostRefInput{Actor: actor.Did})
+
+	quoteGuy := d.CreateActor()
+	first := d.CreatePost(&TestPostRefInput{Actor: quoteGuy.Did, Quote: op.Uri})
+	second := d.CreatePost(&TestPostRefInput{Actor: quoteGuy.Did, Quote: op.Uri})
+	third := d.CreatePost(&TestPostRefInput{Actor: quoteGuy.Did, Quote: op.Uri})
+	d.CreatePost(&TestPostRefInput{Actor: actor.Did, Quote: second.Uri})
+
+	subject, quotes, err := d.SelectQuotesForUri(op.Uri, 0, 2)
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(t, op.PostId, subject.PostId)
+	assert.Equal(t, []int64{third.PostId, second.PostId}, []int64{quotes[0].PostId, quotes[1].PostId})
+
+	_, quotes, err = d.SelectQuotesForUri(op.Uri, second.PostId, 2)
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(t, 1, len(quotes))
+	assert.Equal(t, first.PostId, quotes[0].PostId)
+
+	posts := []*PostRow{subject, first, second}
+	err = d.CountQuotes(posts...)
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(t, []int64{3, 0, 1}, []int64{posts[0].Quotes, posts[1].Quotes, posts[2].Quotes})
+
+	subject, quotes, err = d.SelectQuotesForUri(NewTestPostUri(actor.Did), 0, 2)
+	assert.NoError(t, err)
+	assert.Nil(t, subject)
+	assert.Nil(t, quotes)
+}
+
 func TestDBxInsertMentions(t *testing.T) {
 	d, cleanup := NewTestDBx()
 	defer cleanup()
@@ -366,6 +407,7 @@ func TestDBxSelectMentions(t *testing.T) {
 	if err != nil {
 		panic(err)
 	}
+	reply.Source = PostSourceReply
 	assert.Equal(
 		t,
 		[]*PostRow{reply},
@@ -387,6 +429,7 @@ func TestDBxSelectMentions(t *testing.T) {
 	if err != nil {
 		panic(err)
 	}
+	reply.Source = PostSourceMention
 	assert.Equal(
 		t,
 		[]*PostRow{reply},
@@ -824,6 +867,45 @@ func TestDBxSelectPostLabels(t *testing.T) {
 	)
 }
 
+func TestDBxSelectLabelIdsSince(t *testing.T) {
+	d, cleanup := NewTestDBx()
+	defer cleanup()
+
+	actor := d.CreateActor()
+	d.CreatePost(&TestPostRefInput{Actor: actor.Did}, "a")
+
+	last, err := d.PostLabels.SelectLastPostLabelId()
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(t, int64(1), last)
+
+	d.CreatePost(&TestPostRefInput{Actor: actor.Did}, "a")
+	d.CreatePost(&TestPostRefInput{Actor: actor.Did}, "b")
+
+	a, err := d.Labels.FindLabel("a")
+	if err != nil {
+		panic(err)
+	}
+	b, err := d.Labels.FindLabel("b")
+	if err != nil {
+		panic(err)
+	}
+
+	rows, err := d.PostLabels.SelectLabelIdsSince(last)
+	if err != nil {
+		panic(err)
+	}
+	assert.ElementsMatch(
+		t,
+		[]*PostLabelRow{
+			{PostLabelId: 2, LabelId: a.LabelId},
+			{PostLabelId: 3, LabelId: b.LabelId},
+		},
+		rows,
+	)
+}
+
 /*
 func TestDBxDeleteLike(t *testing.T) {
 	d, cleanup := NewTestDBx()
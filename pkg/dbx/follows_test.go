@@ -146,3 +146,32 @@ func TestDBxSelectPostsByLabelsFollowed(t *testing.T) {
 		CollectPostIds(found),
 	)
 }
+
+func TestDBxSelectPostsByLabelsFollowedReposts(t *testing.T) {
+	d, cleanup := NewTestDBx()
+	defer cleanup()
+
+	actor := d.CreateActor()
+	followed := d.CreateActor()
+	unfollowed := d.CreateActor()
+	follow := d.CreateFollow(actor, followed)
+	err := d.FollowsIndexed.SetLastFollow(actor.ActorId, follow.FollowId)
+	if err != nil {
+		panic(err)
+	}
+
+	reposted := d.CreatePost(&TestPostRefInput{Actor: unfollowed.Did}, "a")
+	d.CreatePost(&TestPostRefInput{Actor: unfollowed.Did}, "a")
+	d.CreateRepost(unfollowed, reposted)
+	d.CreateRepost(followed, reposted)
+	repost := d.CreateRepost(followed, reposted)
+	d.CreateRepost(unfollowed, reposted)
+
+	found, err := d.SelectPostsByLabelsFollowed(SQLiteMaxInt-1, 10, actor.Did, "a")
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(t, []int64{reposted.PostId}, CollectPostIds(found))
+	assert.Equal(t, PostSourceRepost, found[0].Source)
+	assert.Equal(t, repost.Uri, found[0].RepostUri)
+}
@@ -0,0 +1,131 @@
+package dbx
+
+import (
+	"path/filepath"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const InteractionRequestLess = "app.bsky.feed.defs#requestLess"
+const InteractionRequestMore = "app.bsky.feed.defs#requestMore"
+
+// InteractionLessThreshold is how many more times a viewer has to ask for
+// less than more of an author before their posts are dropped from the
+// viewer's personalized feeds.
+var InteractionLessThreshold int64 = 2
+
+type InteractionRow struct {
+	InteractionId int64  `db:"interaction_id"`
+	ViewerId      int64  `db:"viewer_id"`
+	AuthorId      int64  `db:"author_id"`
+	Item          string `db:"item"`
+	Event         string `db:"event"`
+	FeedContext   string `db:"feed_context"`
+	CreatedAt     int64  `db:"created_at"`
+}
+
+type DBxTableInteractions struct {
+	*sqlx.DB `dbx-table:"interactions" dbx-pk:"interaction_id"`
+	path     string
+}
+
+var InteractionSchema = `
+CREATE TABLE IF NOT EXISTS interactions (
+	interaction_id INTEGER PRIMARY KEY,
+	viewer_id INTEGER NOT NULL,
+	author_id INTEGER NOT NULL,
+	item TEXT NOT NULL,
+	event TEXT NOT NULL,
+	feed_context TEXT DEFAULT '',
+	created_at INTEGER NOT NULL,
+	UNIQUE(viewer_id, item, event)
+);
+CREATE INDEX IF NOT EXISTS idx_interactions_viewer_author
+ON interactions(viewer_id, author_id);
+CREATE INDEX IF NOT EXISTS idx_interactions_created_at
+ON interactions(created_at);
+`
+
+func NewInteractionTable(dir string) *DBxTableInteractions {
+	path := filepath.Join(dir, "interactions.db")
+	return &DBxTableInteractions{
+		SQLxMustOpen(path, InteractionSchema),
+		path,
+	}
+}
+
+// InsertInteractions records interactions, keeping only the latest of each
+// event a viewer sends for an item.
+func (d *DBxTableInteractions) InsertInteractions(rows []*InteractionRow) error {
+	if len(rows) == 0 {
+		return nil
+	}
+
+	tx, err := d.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, row := range rows {
+		_, err = tx.NamedExec(
+			`INSERT INTO interactions (viewer_id, author_id, item, event, feed_context, created_at)
+			VALUES (:viewer_id, :author_id, :item, :event, :feed_context, :created_at)
+			ON CONFLICT(viewer_id, item, event) DO UPDATE SET feed_context = excluded.feed_context, created_at = excluded.created_at`,
+			row,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// SelectLessWantedAuthors finds the authors a viewer has asked to see less
+// of at least InteractionLessThreshold more times than they asked for more.
+func (d *DBxTableInteractions) SelectLessWantedAuthors(viewerid int64) (map[int64]bool, error) {
+	authorids := make([]int64, 0)
+	err := d.Select(
+		&authorids,
+		`SELECT author_id FROM interactions
+		WHERE viewer_id = ? AND event IN (?, ?)
+		GROUP BY author_id
+		HAVING SUM(CASE WHEN event = ? THEN 1 ELSE -1 END) >= ?`,
+		viewerid,
+		InteractionRequestLess,
+		InteractionRequestMore,
+		InteractionRequestLess,
+		InteractionLessThreshold,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	authors := make(map[int64]bool)
+	for _, authorid := range authorids {
+		authors[authorid] = true
+	}
+	return authors, nil
+}
+
+func (d *DBxTableInteractions) SelectInteractionsByViewer(viewerid int64) ([]*InteractionRow, error) {
+	rows := make([]*InteractionRow, 0)
+	err := d.Select(&rows, "SELECT * FROM interactions WHERE viewer_id = ? ORDER BY interaction_id ASC", viewerid)
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+func (d *DBxTableInteractions) PruneInteractions(since int64) error {
+	exists, err := queryHasResults(d, "SELECT 1 FROM interactions WHERE created_at < $1", since)
+	if err != nil {
+		return err
+	} else if !exists {
+		return nil
+	}
+
+	_, err = d.Exec("DELETE FROM interactions WHERE created_at < $1", since)
+	return err
+}
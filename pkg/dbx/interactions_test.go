@@ -0,0 +1,85 @@
+package dbx
+
+import (
+	"testing"
+
+	"github.com/flicknow/go-bluesky-bot/pkg/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDBxFilterLessWanted(t *testing.T) {
+	d, cleanup := NewTestDBx()
+	defer cleanup()
+
+	viewer := d.CreateActor()
+	noisy := d.CreateActor()
+	quiet := d.CreateActor()
+
+	noisyPost := d.CreatePost(&TestPostRefInput{Actor: noisy.Did})
+	otherNoisyPost := d.CreatePost(&TestPostRefInput{Actor: noisy.Did})
+	quietPost := d.CreatePost(&TestPostRefInput{Actor: quiet.Did})
+	posts := []*PostRow{quietPost, otherNoisyPost, noisyPost}
+	stranger := utils.NewTestDid()
+
+	recorded, err := d.RecordInteractions(viewer.Did, []*InteractionRow{
+		{Item: noisyPost.Uri, Event: InteractionRequestLess, FeedContext: "mentions:reply"},
+		{Item: noisyPost.Uri, Event: "app.bsky.feed.defs#interactionSeen"},
+		{Item: NewTestUri("app.bsky.feed.post", stranger), Event: InteractionRequestLess},
+	})
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(t, 1, recorded)
+
+	actor, err := d.Actors.FindActor(stranger)
+	if err != nil {
+		panic(err)
+	}
+	assert.Nil(t, actor, "interactions don't create actors for unindexed authors")
+
+	filtered, err := d.FilterForViewer(viewer.Did, posts)
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(t, posts, filtered, "one request is not enough")
+
+	_, err = d.RecordInteractions(viewer.Did, []*InteractionRow{
+		{Item: noisyPost.Uri, Event: InteractionRequestLess},
+		{Item: otherNoisyPost.Uri, Event: InteractionRequestLess},
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	filtered, err = d.FilterForViewer(viewer.Did, posts)
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(t, []*PostRow{quietPost}, filtered)
+
+	filtered, err = d.FilterForViewer(quiet.Did, posts)
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(t, posts, filtered, "other viewers are unaffected")
+
+	_, err = d.RecordInteractions(viewer.Did, []*InteractionRow{{Item: quietPost.Uri, Event: InteractionRequestMore}, {Item: noisyPost.Uri, Event: InteractionRequestMore}})
+	if err != nil {
+		panic(err)
+	}
+	filtered, err = d.FilterForViewer(viewer.Did, posts)
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(t, posts, filtered, "asking for more cancels out asking for less")
+
+	err = d.Interactions.PruneInteractions(d.clock.NowUnix() + 1)
+	if err != nil {
+		panic(err)
+	}
+	rows, err := d.Interactions.SelectInteractionsByViewer(viewer.ActorId)
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(t, 0, len(rows))
+}
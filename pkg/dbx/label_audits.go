@@ -0,0 +1,108 @@
+package dbx
+
+import (
+	"path/filepath"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const LabelAuditApply = "apply"
+const LabelAuditNegate = "negate"
+
+type LabelAuditRow struct {
+	LabelAuditId  int64  `db:"label_audit_id" json:"id"`
+	CreatedAt     int64  `db:"created_at" json:"createdAt"`
+	Issuer        string `db:"issuer" json:"issuer"`
+	Action        string `db:"action" json:"action"`
+	Subject       string `db:"subject" json:"subject"`
+	Label         string `db:"label" json:"label"`
+	CustomLabelId int64  `db:"custom_label_id" json:"customLabelId"`
+}
+
+type DBxTableLabelAudits struct {
+	*sqlx.DB `dbx-table:"label_audits" dbx-pk:"label_audit_id"`
+	path     string
+}
+
+var LabelAuditSchema = `
+CREATE TABLE IF NOT EXISTS label_audits (
+	label_audit_id INTEGER PRIMARY KEY,
+	created_at INTEGER NOT NULL,
+	issuer TEXT NOT NULL,
+	action TEXT NOT NULL,
+	subject TEXT NOT NULL,
+	label TEXT NOT NULL,
+	custom_label_id INTEGER DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS idx_label_audit_subject
+ON label_audits(subject, label_audit_id);
+`
+
+func NewLabelAuditTable(dir string) *DBxTableLabelAudits {
+	path := filepath.Join(dir, "label-audits.db")
+	return &DBxTableLabelAudits{
+		SQLxMustOpen(path, LabelAuditSchema),
+		path,
+	}
+}
+
+func (d *DBxTableLabelAudits) InsertAudits(rows []*LabelAuditRow) error {
+	if len(rows) == 0 {
+		return nil
+	}
+
+	tx, err := d.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, row := range rows {
+		res, err := tx.NamedExec(
+			"INSERT INTO label_audits (created_at, issuer, action, subject, label, custom_label_id) VALUES (:created_at, :issuer, :action, :subject, :label, :custom_label_id)",
+			row,
+		)
+		if err != nil {
+			return err
+		}
+
+		id, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		row.LabelAuditId = id
+	}
+
+	return tx.Commit()
+}
+
+func (d *DBxTableLabelAudits) SelectAudits(before int64, limit int) ([]*LabelAuditRow, error) {
+	rows := make([]*LabelAuditRow, 0)
+	err := d.Select(
+		&rows,
+		"SELECT * FROM label_audits WHERE label_audit_id < $1 ORDER BY label_audit_id DESC LIMIT $2",
+		before,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return rows, nil
+}
+
+func (d *DBxTableLabelAudits) SelectAuditsBySubject(subject string, before int64, limit int) ([]*LabelAuditRow, error) {
+	rows := make([]*LabelAuditRow, 0)
+	err := d.Select(
+		&rows,
+		"SELECT * FROM label_audits WHERE subject = $1 AND label_audit_id < $2 ORDER BY label_audit_id DESC LIMIT $3",
+		subject,
+		before,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return rows, nil
+}
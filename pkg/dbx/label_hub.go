@@ -0,0 +1,191 @@
+package dbx
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+var LabelHubPollInterval = 2 * time.Second
+var LabelHubPollLimit = 500
+var LabelHubBufferSize = 64
+
+type LabelSubscription struct {
+	C   chan []*CustomLabel
+	hub *LabelHub
+}
+
+func (s *LabelSubscription) Close() {
+	s.hub.unsubscribe(s)
+}
+
+// LabelHub fans newly inserted custom labels out to label subscribers in
+// custom_label_id order. Labels inserted by this process are published as
+// soon as they commit, and a single shared poller picks up labels inserted
+// by other processes.
+type LabelHub struct {
+	mu          sync.Mutex
+	subscribers map[*LabelSubscription]bool
+	pollCursor  int64
+	poller      *time.Ticker
+	nudge       chan struct{}
+	selectSince func(since int64, limit int) ([]*CustomLabel, error)
+	selectLast  func() (int64, error)
+}
+
+func NewLabelHub(selectSince func(since int64, limit int) ([]*CustomLabel, error), selectLast func() (int64, error)) *LabelHub {
+	return &LabelHub{
+		subscribers: make(map[*LabelSubscription]bool),
+		selectSince: selectSince,
+		selectLast:  selectLast,
+	}
+}
+
+func (h *LabelHub) Subscribe() *LabelSubscription {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	sub := &LabelSubscription{
+		C:   make(chan []*CustomLabel, LabelHubBufferSize),
+		hub: h,
+	}
+	h.subscribers[sub] = true
+
+	if (h.poller == nil) && (h.selectSince != nil) && (LabelHubPollInterval > 0) {
+		h.pollCursor = 0
+		if h.selectLast != nil {
+			lastId, err := h.selectLast()
+			if err == nil {
+				h.pollCursor = lastId
+			}
+		}
+		h.poller = time.NewTicker(LabelHubPollInterval)
+		h.nudge = make(chan struct{}, 1)
+		go h.poll(h.poller, h.nudge)
+	}
+
+	return sub
+}
+
+func (h *LabelHub) unsubscribe(sub *LabelSubscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.removeLocked(sub)
+}
+
+func (h *LabelHub) removeLocked(sub *LabelSubscription) {
+	if !h.subscribers[sub] {
+		return
+	}
+
+	delete(h.subscribers, sub)
+	close(sub.C)
+
+	if (len(h.subscribers) == 0) && (h.poller != nil) {
+		h.poller.Stop()
+		h.poller = nil
+		close(h.nudge)
+		h.nudge = nil
+	}
+}
+
+func (h *LabelHub) Subscribers() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return len(h.subscribers)
+}
+
+// Publish sends freshly committed rows to every subscriber. If the rows
+// don't directly follow what was already delivered, another process has
+// inserted labels in between, so the poller catches up from the db instead.
+func (h *LabelHub) Publish(rows []*CustomLabel) {
+	if len(rows) == 0 {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.poller == nil {
+		return
+	}
+
+	if rows[0].CustomLabelId != (h.pollCursor + 1) {
+		select {
+		case h.nudge <- struct{}{}:
+		default:
+		}
+		return
+	}
+
+	h.pollCursor = rows[len(rows)-1].CustomLabelId
+	h.publishLocked(rows)
+}
+
+func (h *LabelHub) publishLocked(rows []*CustomLabel) {
+	for sub := range h.subscribers {
+		select {
+		case sub.C <- rows:
+		default:
+			log.Printf("WARNING dropping lagging label subscriber\n")
+			h.removeLocked(sub)
+		}
+	}
+}
+
+func (h *LabelHub) pollOnce() (int, error) {
+	h.mu.Lock()
+	since := h.pollCursor
+	h.mu.Unlock()
+
+	rows, err := h.selectSince(since, LabelHubPollLimit)
+	if err != nil {
+		return 0, err
+	}
+	if len(rows) == 0 {
+		return 0, nil
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	fresh := make([]*CustomLabel, 0, len(rows))
+	for _, row := range rows {
+		if row.CustomLabelId > h.pollCursor {
+			fresh = append(fresh, row)
+		}
+	}
+	if len(fresh) == 0 {
+		return len(rows), nil
+	}
+
+	h.pollCursor = fresh[len(fresh)-1].CustomLabelId
+	h.publishLocked(fresh)
+
+	return len(rows), nil
+}
+
+func (h *LabelHub) poll(t *time.Ticker, nudge chan struct{}) {
+	for {
+		select {
+		case <-t.C:
+		case _, ok := <-nudge:
+			if !ok {
+				return
+			}
+		}
+
+		for {
+			n, err := h.pollOnce()
+			if err != nil {
+				log.Printf("error polling custom labels: %+v\n", err)
+				break
+			}
+			if n < LabelHubPollLimit {
+				break
+			}
+		}
+	}
+}
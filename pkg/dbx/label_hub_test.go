@@ -0,0 +1,100 @@
+package dbx
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func receiveLabels(t *testing.T, sub *LabelSubscription) []int64 {
+	select {
+	case labels, ok := <-sub.C:
+		if !ok {
+			return nil
+		}
+		ids := make([]int64, 0, len(labels))
+		for _, label := range labels {
+			ids = append(ids, label.CustomLabelId)
+		}
+		return ids
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for labels")
+		return nil
+	}
+}
+
+func TestLabelHubPublishesInsertedLabels(t *testing.T) {
+	dir := t.TempDir()
+	table := NewCustomLabelTable(dir)
+	defer table.Close()
+
+	sub := table.Hub.Subscribe()
+	defer sub.Close()
+
+	rows := []*CustomLabel{
+		{SubjectType: AccountLabelType, SubjectId: 1, LabelId: 1},
+		{SubjectType: AccountLabelType, SubjectId: 2, LabelId: 1},
+	}
+	err := table.InsertLabels(rows)
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(t, []int64{1, 2}, receiveLabels(t, sub))
+
+	// duplicates are ignored by the db and shouldn't be published again
+	err = table.InsertLabels([]*CustomLabel{{SubjectType: AccountLabelType, SubjectId: 1, LabelId: 1}, {SubjectType: AccountLabelType, SubjectId: 3, LabelId: 1}})
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(t, []int64{3}, receiveLabels(t, sub))
+}
+
+func TestLabelHubPollsLabelsFromOtherWriters(t *testing.T) {
+	interval := LabelHubPollInterval
+	LabelHubPollInterval = 10 * time.Millisecond
+	defer func() { LabelHubPollInterval = interval }()
+
+	dir := t.TempDir()
+	table := NewCustomLabelTable(dir)
+	defer table.Close()
+
+	other := NewCustomLabelTable(dir)
+	defer other.Close()
+
+	err := other.InsertLabels([]*CustomLabel{{SubjectType: AccountLabelType, SubjectId: 1, LabelId: 1}})
+	if err != nil {
+		panic(err)
+	}
+
+	sub := table.Hub.Subscribe()
+	defer sub.Close()
+
+	err = other.InsertLabels([]*CustomLabel{{SubjectType: AccountLabelType, SubjectId: 2, LabelId: 1}})
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(t, []int64{2}, receiveLabels(t, sub))
+
+	err = table.InsertLabels([]*CustomLabel{{SubjectType: AccountLabelType, SubjectId: 3, LabelId: 1}})
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(t, []int64{3}, receiveLabels(t, sub))
+}
+
+func TestLabelHubDropsLaggingSubscribers(t *testing.T) {
+	hub := NewLabelHub(nil, nil)
+	sub := hub.Subscribe()
+
+	for i := 0; i <= LabelHubBufferSize; i++ {
+		hub.publishLocked([]*CustomLabel{{CustomLabelId: int64(i + 1)}})
+	}
+	assert.Equal(t, 0, hub.Subscribers())
+
+	count := 0
+	for range sub.C {
+		count++
+	}
+	assert.Equal(t, LabelHubBufferSize, count)
+}
@@ -0,0 +1,238 @@
+package dbx
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bluesky-social/indigo/api/atproto"
+	"github.com/flicknow/go-bluesky-bot/pkg/utils"
+)
+
+var ErrUnknownLabelSubject = errors.New("unknown label subject")
+
+// LabelTarget is an account or post that custom labels can be issued on.
+type LabelTarget struct {
+	Uri         string
+	Cid         string
+	SubjectType int64
+	SubjectId   int64
+}
+
+func AccountLabelTarget(actor *ActorRow) *LabelTarget {
+	return &LabelTarget{
+		Uri:         actor.Did,
+		SubjectType: AccountLabelType,
+		SubjectId:   actor.ActorId,
+	}
+}
+
+func PostLabelTarget(post *PostRow) *LabelTarget {
+	uri := post.Uri
+	if uri == "" {
+		uri = utils.HydrateUri(post.DehydratedUri, "app.bsky.feed.post")
+	}
+
+	return &LabelTarget{
+		Uri:         uri,
+		Cid:         post.Cid,
+		SubjectType: PostLabelType,
+		SubjectId:   post.PostId,
+	}
+}
+
+// ResolveLabelTarget looks up an account did or post at:// uri. Posts have
+// to be indexed already, while accounts are created if create is set.
+func (d *DBx) ResolveLabelTarget(subject string, create bool) (*LabelTarget, error) {
+	if strings.HasPrefix(subject, "did:") {
+		var actor *ActorRow
+		var err error
+		if create {
+			actor, err = d.Actors.FindOrCreateActor(subject)
+		} else {
+			actor, err = d.Actors.FindActor(subject)
+		}
+		if err != nil {
+			return nil, err
+		} else if actor == nil {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownLabelSubject, subject)
+		}
+		return AccountLabelTarget(actor), nil
+	}
+
+	if strings.HasPrefix(subject, "at://") {
+		post, err := d.Posts.FindByUri(subject)
+		if err != nil {
+			return nil, err
+		} else if post == nil {
+			return nil, fmt.Errorf("%w: %s is not indexed", ErrUnknownLabelSubject, subject)
+		}
+		return PostLabelTarget(post), nil
+	}
+
+	return nil, fmt.Errorf("%w: %s is not a did or at:// uri", ErrUnknownLabelSubject, subject)
+}
+
+// IssueLabels applies or negates val on each subject, which may be an
+// account did or a post at:// uri, and records who issued it.
+func (d *DBx) IssueLabels(issuer string, subjects []string, val string, neg bool) ([]*atproto.LabelDefs_Label, error) {
+	targets := make([]*LabelTarget, 0, len(subjects))
+	for _, subject := range uniqueStrings(subjects) {
+		target, err := d.ResolveLabelTarget(subject, true)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, target)
+	}
+
+	return d.IssueTargetLabels(issuer, targets, val, neg)
+}
+
+// IssueTargetLabels is the one place custom labels get signed and stored.
+// Targets already carrying val in the same state are skipped, any earlier
+// apply or negate is superseded, and the rest are signed as a batch. When
+// issuer is set, an audit row is recorded for every label issued.
+func (d *DBx) IssueTargetLabels(issuer string, targets []*LabelTarget, val string, neg bool) ([]*atproto.LabelDefs_Label, error) {
+	if len(targets) == 0 {
+		return []*atproto.LabelDefs_Label{}, nil
+	}
+
+	err := d.ValidateLabels(val)
+	if err != nil {
+		return nil, err
+	}
+
+	labelRow, err := d.Labels.FindOrCreateLabel(val)
+	if err != nil {
+		return nil, err
+	}
+
+	var negInt int64 = 0
+	if neg {
+		negInt = 1
+	}
+
+	now := time.Unix(d.clock.NowUnix(), 0)
+	cts := now.UTC().Format(time.RFC3339)
+	seen := make(map[string]bool)
+	labels := make([]*atproto.LabelDefs_Label, 0, len(targets))
+	pending := make([]*LabelTarget, 0, len(targets))
+	for _, target := range targets {
+		key := fmt.Sprintf("%d:%d", target.SubjectType, target.SubjectId)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		existing, err := d.CustomLabels.FindLabel(labelRow.LabelId, target.SubjectType, target.SubjectId)
+		if err != nil {
+			return nil, err
+		}
+		if (existing != nil) && (existing.Neg == negInt) {
+			continue
+		}
+
+		ver := int64(1)
+		label := &atproto.LabelDefs_Label{
+			Cts: cts,
+			Src: LabelerDid,
+			Uri: target.Uri,
+			Val: val,
+			Ver: &ver,
+		}
+		if target.Cid != "" {
+			cid := target.Cid
+			label.Cid = &cid
+		}
+		if neg {
+			label.Neg = &neg
+		}
+
+		labels = append(labels, label)
+		pending = append(pending, target)
+	}
+	if len(labels) == 0 {
+		return labels, nil
+	}
+
+	cbors, err := d.SigningKey.SignLabelsAndMarshalCBOR(labels)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make([]*CustomLabel, len(labels))
+	for i, target := range pending {
+		rows[i] = &CustomLabel{
+			SubjectType: target.SubjectType,
+			SubjectId:   target.SubjectId,
+			CreatedAt:   now.Unix(),
+			LabelId:     labelRow.LabelId,
+			Neg:         negInt,
+			Cbor:        cbors[i],
+			KeyId:       d.SigningKey.KeyId(),
+		}
+	}
+
+	err = d.CustomLabels.SupersedeLabels(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if issuer == "" {
+		return labels, nil
+	}
+
+	action := LabelAuditApply
+	if neg {
+		action = LabelAuditNegate
+	}
+
+	audits := make([]*LabelAuditRow, len(rows))
+	for i, row := range rows {
+		audits[i] = &LabelAuditRow{
+			CreatedAt:     now.Unix(),
+			Issuer:        issuer,
+			Action:        action,
+			Subject:       pending[i].Uri,
+			Label:         val,
+			CustomLabelId: row.CustomLabelId,
+		}
+	}
+
+	err = d.LabelAudits.InsertAudits(audits)
+	if err != nil {
+		return nil, err
+	}
+
+	return labels, nil
+}
+
+func (d *DBx) SelectActiveLabels(subject string) ([]*atproto.LabelDefs_Label, error) {
+	target, err := d.ResolveLabelTarget(subject, false)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := d.CustomLabels.SelectLabelsBySubject(target.SubjectType, target.SubjectId)
+	if err != nil {
+		return nil, err
+	}
+
+	labels := make([]*atproto.LabelDefs_Label, 0, len(rows))
+	for _, row := range rows {
+		if row.Neg != 0 {
+			continue
+		}
+
+		label := &atproto.LabelDefs_Label{}
+		err := label.UnmarshalCBOR(bytes.NewReader(row.Cbor))
+		if err != nil {
+			return nil, fmt.Errorf("error decoding custom label %d: %w", row.CustomLabelId, err)
+		}
+		labels = append(labels, label)
+	}
+
+	return labels, nil
+}
@@ -113,10 +113,16 @@ func (d *DBxTableLabels) FindOrCreateLabel(name string) (*LabelRow, error) {
 }
 
 func (d *DBxTableLabels) SelectNewskieLabels() ([]*LabelRow, error) {
+	return d.SelectLabelsByPrefix("newskie-")
+}
+
+func (d *DBxTableLabels) SelectLabelsByPrefix(prefix string) ([]*LabelRow, error) {
 	labels := make([]*LabelRow, 0)
 	err := d.Select(
 		&labels,
-		`SELECT * FROM labels WHERE name LIKE "newskie-%" ORDER BY name ASC`,
+		`SELECT * FROM labels WHERE substr(name, 1, length(?)) = ? ORDER BY name ASC`,
+		prefix,
+		prefix,
 	)
 	if err != nil {
 		return nil, err
@@ -97,3 +97,24 @@ func (d *DBxTablePostLabels) DeletePostLabelsByPostId(postid int64) error {
 	_, err := d.Exec("DELETE FROM post_labels WHERE post_id = $1", postid)
 	return err
 }
+
+func (d *DBxTablePostLabels) SelectLastPostLabelId() (int64, error) {
+	var last int64
+	err := d.Get(&last, "SELECT COALESCE(MAX(post_label_id), 0) FROM post_labels")
+	return last, err
+}
+
+// SelectLabelIdsSince finds the labels that have been applied to posts since
+// the given post_label_id, with the last post_label_id seen for each.
+func (d *DBxTablePostLabels) SelectLabelIdsSince(since int64) ([]*PostLabelRow, error) {
+	rows := make([]*PostLabelRow, 0)
+	err := d.Select(
+		&rows,
+		"SELECT label_id, MAX(post_label_id) AS post_label_id FROM post_labels WHERE post_label_id > $1 GROUP BY label_id",
+		since,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
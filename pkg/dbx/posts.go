@@ -22,8 +22,32 @@ type PostRow struct {
 	Quotes        int64 `db:"quotes"`
 	Replies       int64 `db:"replies"`
 	Reposts       int64 `db:"reposts"`
+	Cid           string `db:"cid"`
+	Source        string `db:"-"`
+	RepostUri     string `db:"-"`
+	Position      int64  `db:"-"`
 }
 
+// FeedPosition is what a feed pages by after this post. Most feeds page by
+// post id, but some, ie bangers, page by another id recorded in Position.
+func (p *PostRow) FeedPosition() int64 {
+	if p.Position != 0 {
+		return p.Position
+	}
+	return p.PostId
+}
+
+// sources recorded on PostRow.Source for the feeds that merge several
+// queries, so the feed can say why a post showed up
+const (
+	PostSourceMention       = "mention"
+	PostSourceQuote         = "quote"
+	PostSourceReply         = "reply"
+	PostSourceThreadMention = "thread"
+	PostSourceDm            = "dm"
+	PostSourceRepost        = "repost"
+)
+
 type DBxTablePosts struct {
 	*sqlx.DB        `dbx-table:"posts" dbx-pk:"post_id"`
 	Path            string
@@ -41,7 +65,8 @@ CREATE TABLE IF NOT EXISTS posts (
 	likes INTEGER DEFAULT 0,
 	quotes INTEGER DEFAULT 0,
 	replies INTEGER DEFAULT 0,
-	reposts INTEGER DEFAULT 0
+	reposts INTEGER DEFAULT 0,
+	cid TEXT DEFAULT ''
 );
 CREATE INDEX IF NOT EXISTS idx_post_created_at
 ON posts(created_at DESC);
@@ -51,8 +76,11 @@ ON posts(labeled, post_id DESC);
 
 func NewPostTable(dir string) *DBxTablePosts {
 	path := filepath.Join(dir, "posts.db")
+	db := SQLxMustOpen(path, PostSchema)
+	SQLxMustAddColumn(db, "posts", "cid", "TEXT DEFAULT ''")
+
 	table := &DBxTablePosts{
-		SQLxMustOpen(path, PostSchema),
+		db,
 		path,
 		make(map[string]*sqlx.NamedStmt),
 		make(map[string]*sqlx.Stmt),
@@ -294,7 +322,7 @@ func (d *DBxTablePosts) MarkLabeled(postid int64) error {
 }
 
 func (d *DBxTablePosts) InsertPost(p *PostRow) (*PostRow, error) {
-	stmt, err := d.findOrPrepareNamedStmt("INSERT INTO posts (uri, actor_id, created_at, labeled) VALUES (:uri, :actor_id, :created_at, :labeled)")
+	stmt, err := d.findOrPrepareNamedStmt("INSERT INTO posts (uri, actor_id, created_at, labeled, cid) VALUES (:uri, :actor_id, :created_at, :labeled, :cid)")
 	if err != nil {
 		return nil, err
 	}
@@ -322,3 +350,12 @@ func (d *DBxTablePosts) DeletePost(postid int64) error {
 	_, err = stmt.Exec(postid)
 	return err
 }
+
+// SelectLatestCreatedAt is the newest created_at among the last posts
+// indexed, ignoring any claiming to be from after now. Looking at several
+// keeps one backdated post from making the index look stale.
+func (d *DBxTablePosts) SelectLatestCreatedAt(now int64) (int64, error) {
+	var latest int64
+	err := d.Get(&latest, "SELECT COALESCE(MAX(created_at), 0) FROM (SELECT created_at FROM posts ORDER BY post_id DESC LIMIT 100) WHERE created_at <= $1", now)
+	return latest, err
+}
@@ -45,3 +45,29 @@ func TestDBxSelectPostsByActorIds(t *testing.T) {
 		CollectPostIds(only),
 	)
 }
+
+func TestDBxPostsSelectLatestCreatedAt(t *testing.T) {
+	d, cleanup := NewTestDBx()
+	defer cleanup()
+
+	latest, err := d.Posts.SelectLatestCreatedAt(SQLiteMaxInt)
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(t, int64(0), latest)
+
+	actor := d.CreateActor()
+	post := d.CreatePost(&TestPostRefInput{Actor: actor.Did})
+
+	latest, err = d.Posts.SelectLatestCreatedAt(SQLiteMaxInt)
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(t, post.CreatedAt, latest)
+
+	latest, err = d.Posts.SelectLatestCreatedAt(post.CreatedAt - 1)
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(t, int64(0), latest)
+}
@@ -3,6 +3,7 @@ package dbx
 import (
 	"fmt"
 	"path/filepath"
+	"strings"
 
 	"github.com/jmoiron/sqlx"
 )
@@ -177,3 +178,35 @@ func (d *DBxTableQuotes) DeleteQuote(quoteid int64) error {
 	_, err := d.Exec("DELETE FROM quotes WHERE quote_id = $1", quoteid)
 	return err
 }
+
+func (d *DBxTableQuotes) CountQuotesBySubjectIds(subjectids []int64) (map[int64]int64, error) {
+	counts := make(map[int64]int64, len(subjectids))
+	if len(subjectids) == 0 {
+		return counts, nil
+	}
+
+	params := make([]any, len(subjectids))
+	plcs := make([]string, len(subjectids))
+	for i, id := range subjectids {
+		params[i] = id
+		plcs[i] = "?"
+	}
+	q := fmt.Sprintf("SELECT subject_id, COUNT(*) FROM quotes WHERE subject_id IN (%s) GROUP BY subject_id", strings.Join(plcs, ", "))
+
+	rows, err := d.Query(q, params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var subjectid, count int64
+		err = rows.Scan(&subjectid, &count)
+		if err != nil {
+			return nil, err
+		}
+		counts[subjectid] = count
+	}
+
+	return counts, rows.Err()
+}
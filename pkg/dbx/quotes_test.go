@@ -21,6 +21,7 @@ func TestDBxSelectQuotes(t *testing.T) {
 	if err != nil {
 		panic(err)
 	}
+	quote.Source = PostSourceQuote
 	assert.Equal(
 		t,
 		[]*PostRow{quote},
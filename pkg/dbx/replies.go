@@ -46,8 +46,19 @@ ON replies(actor_id, post_id DESC);
 
 func NewReplyTable(dir string) *DBxTableReplies {
 	path := filepath.Join(dir, "replies.db")
+	db := SQLxMustOpen(path, ReplySchema)
+
+	// rows indexed before root tracking was wired up keep a zero root_id
+	// and root_actor_id. the roots live in posts.db so they can't be
+	// backfilled here; the thread queries skip them and they age out with
+	// the normal prune.
+	SQLxMustAddColumn(db, "replies", "root_id", "INTEGER NOT NULL DEFAULT 0")
+	SQLxMustAddColumn(db, "replies", "root_actor_id", "INTEGER NOT NULL DEFAULT 0")
+	db.MustExec("CREATE INDEX IF NOT EXISTS idx_replies_root_actor_id ON replies(root_actor_id, post_id DESC)")
+	db.MustExec("CREATE INDEX IF NOT EXISTS idx_replies_root_id ON replies(root_id, post_id DESC)")
+
 	return &DBxTableReplies{
-		SQLxMustOpen(path, ReplySchema),
+		db,
 		path,
 		make(map[string]*sqlx.NamedStmt),
 		make(map[string]*sqlx.Stmt),
@@ -185,6 +196,65 @@ LIMIT
 	return mentions, nil
 }
 
+func (d *DBxTableReplies) SelectRepliesToRootActorId(actorid int64, before int64, limit int) ([]int64, error) {
+	q := `
+SELECT
+	post_id
+FROM
+	replies
+WHERE
+	root_actor_id = $1
+	AND actor_id != $1
+	AND post_id < $2
+ORDER BY
+	post_id DESC
+LIMIT
+	$3
+`
+
+	replies := make([]int64, 0, limit)
+	err := d.Select(&replies, q, actorid, before, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return replies, nil
+}
+
+// SelectRepliesInThreadsOfActorId finds replies by others in threads the
+// actor started or has replied in. replies whose root was never indexed
+// have a zero root_id and can't be placed in a thread, so they're skipped.
+func (d *DBxTableReplies) SelectRepliesInThreadsOfActorId(actorid int64, before int64, limit int) ([]*ReplyRow, error) {
+	q := `
+SELECT
+	*
+FROM
+	replies
+WHERE
+	(
+		root_actor_id = $1
+		OR (
+			root_id != 0
+			AND root_id IN (SELECT root_id FROM replies WHERE actor_id = $1 AND root_id != 0)
+		)
+	)
+	AND actor_id != $1
+	AND post_id < $2
+ORDER BY
+	post_id DESC
+LIMIT
+	$3
+`
+
+	replies := make([]*ReplyRow, 0, limit)
+	err := d.Select(&replies, q, actorid, before, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return replies, nil
+}
+
 func (d *DBxTableReplies) InsertReply(r *ReplyRow) error {
 	stmt, err := d.findOrPrepareNamedStmt("INSERT INTO replies (post_id, actor_id, parent_id, parent_actor_id, root_id, root_actor_id) VALUES (:post_id, :actor_id, :parent_id, :parent_actor_id, :root_id, :root_actor_id)")
 	if err != nil {
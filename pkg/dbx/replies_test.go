@@ -46,3 +46,111 @@ func TestDBxSelectRepliesFromActorIds(t *testing.T) {
 		only,
 	)
 }
+
+func TestDBxSelectReplies(t *testing.T) {
+	d, cleanup := NewTestDBx()
+	defer cleanup()
+
+	actor := d.CreateActor()
+	other := d.CreateActor()
+	third := d.CreateActor()
+
+	op := d.CreatePost(&TestPostRefInput{Actor: actor.Did})
+	reply := d.CreatePost(&TestPostRefInput{Actor: other.Did, Reply: op.Uri})
+	self := d.CreatePost(&TestPostRefInput{Actor: actor.Did, Reply: reply.Uri, Root: op.Uri})
+	nested := d.CreatePost(&TestPostRefInput{Actor: third.Did, Reply: reply.Uri, Root: op.Uri})
+	toSelf := d.CreatePost(&TestPostRefInput{Actor: other.Did, Reply: self.Uri, Root: op.Uri})
+
+	elsewhere := d.CreatePost(&TestPostRefInput{Actor: other.Did})
+	d.CreatePost(&TestPostRefInput{Actor: third.Did, Reply: elsewhere.Uri})
+
+	replies, err := d.SelectReplies(SQLiteMaxInt, 10, actor.Did)
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(t, []int64{toSelf.PostId, reply.PostId}, CollectPostIds(replies))
+	assert.Equal(t, PostSourceReply, replies[0].Source)
+
+	conversations, err := d.SelectConversations(SQLiteMaxInt, 10, actor.Did)
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(t, []int64{toSelf.PostId, nested.PostId, reply.PostId}, CollectPostIds(conversations))
+
+	conversations, err = d.SelectConversations(nested.PostId, 10, actor.Did)
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(t, []int64{reply.PostId}, CollectPostIds(conversations))
+}
+
+func TestDBxSelectThreadRepliesFollowed(t *testing.T) {
+	d, cleanup := NewTestDBx()
+	defer cleanup()
+
+	actor := d.CreateActor()
+	followed := d.CreateActor()
+	stranger := d.CreateActor()
+	follow := d.CreateFollow(actor, followed)
+
+	_, err := d.FollowsIndexed.FindOrCreateByActorId(actor.ActorId)
+	if err != nil {
+		panic(err)
+	}
+	err = d.FollowsIndexed.SetLastFollow(actor.ActorId, follow.FollowId)
+	if err != nil {
+		panic(err)
+	}
+
+	mine := d.CreatePost(&TestPostRefInput{Actor: actor.Did})
+	theirs := d.CreatePost(&TestPostRefInput{Actor: stranger.Did})
+	joined := d.CreatePost(&TestPostRefInput{Actor: actor.Did, Reply: theirs.Uri})
+	notJoined := d.CreatePost(&TestPostRefInput{Actor: stranger.Did})
+
+	inMine := d.CreatePost(&TestPostRefInput{Actor: followed.Did, Reply: mine.Uri})
+	d.CreatePost(&TestPostRefInput{Actor: stranger.Did, Reply: mine.Uri})
+	inTheirs := d.CreatePost(&TestPostRefInput{Actor: followed.Did, Reply: joined.Uri, Root: theirs.Uri})
+	d.CreatePost(&TestPostRefInput{Actor: followed.Did, Reply: notJoined.Uri})
+
+	replies, err := d.SelectThreadRepliesFollowed(SQLiteMaxInt, 10, actor.Did)
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(t, []int64{inTheirs.PostId, inMine.PostId}, CollectPostIds(replies))
+
+	replies, err = d.SelectThreadRepliesFollowed(SQLiteMaxInt, 1, actor.Did)
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(t, []int64{inTheirs.PostId}, CollectPostIds(replies))
+}
+
+func TestDBxSelectThreadRepliesFollowedUnindexedRoot(t *testing.T) {
+	d, cleanup := NewTestDBx()
+	defer cleanup()
+
+	actor := d.CreateActor()
+	followed := d.CreateActor()
+	stranger := d.CreateActor()
+	follow := d.CreateFollow(actor, followed)
+
+	_, err := d.FollowsIndexed.FindOrCreateByActorId(actor.ActorId)
+	if err != nil {
+		panic(err)
+	}
+	err = d.FollowsIndexed.SetLastFollow(actor.ActorId, follow.FollowId)
+	if err != nil {
+		panic(err)
+	}
+
+	mine := d.CreatePost(&TestPostRefInput{Actor: actor.Did})
+	d.CreatePost(&TestPostRefInput{Actor: actor.Did, Reply: NewTestPostUri(stranger.Did)})
+	d.CreatePost(&TestPostRefInput{Actor: followed.Did, Reply: NewTestPostUri(stranger.Did)})
+	inMine := d.CreatePost(&TestPostRefInput{Actor: followed.Did, Reply: mine.Uri})
+
+	replies, err := d.SelectThreadRepliesFollowed(SQLiteMaxInt, 10, actor.Did)
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(t, []int64{inMine.PostId}, CollectPostIds(replies))
+}
@@ -0,0 +1,187 @@
+package dbx
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const ReportStatusOpen = "open"
+const ReportStatusResolved = "resolved"
+
+type ReportRow struct {
+	ReportId   int64  `db:"report_id" json:"id"`
+	CreatedAt  int64  `db:"created_at" json:"createdAt"`
+	UpdatedAt  int64  `db:"updated_at" json:"updatedAt"`
+	Reporter   string `db:"reporter" json:"reporter"`
+	Subject    string `db:"subject" json:"subject"`
+	SubjectCid string `db:"subject_cid" json:"subjectCid,omitempty"`
+	ReasonType string `db:"reason_type" json:"reasonType"`
+	Reason     string `db:"reason" json:"reason,omitempty"`
+	Reports    int64  `db:"reports" json:"reports"`
+	Status     string `db:"status" json:"status"`
+	ResolvedBy string `db:"resolved_by" json:"resolvedBy,omitempty"`
+	ResolvedAt int64  `db:"resolved_at" json:"resolvedAt,omitempty"`
+	Resolution string `db:"resolution" json:"resolution,omitempty"`
+}
+
+type DBxTableReports struct {
+	*sqlx.DB `dbx-table:"reports" dbx-pk:"report_id"`
+	path     string
+}
+
+var ReportSchema = `
+CREATE TABLE IF NOT EXISTS reports (
+	report_id INTEGER PRIMARY KEY,
+	created_at INTEGER NOT NULL,
+	updated_at INTEGER NOT NULL,
+	reporter TEXT NOT NULL,
+	subject TEXT NOT NULL,
+	subject_cid TEXT DEFAULT '',
+	reason_type TEXT NOT NULL,
+	reason TEXT DEFAULT '',
+	reports INTEGER DEFAULT 1,
+	status TEXT NOT NULL,
+	resolved_by TEXT DEFAULT '',
+	resolved_at INTEGER DEFAULT 0,
+	resolution TEXT DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS idx_report_status_id
+ON reports(status, report_id);
+CREATE INDEX IF NOT EXISTS idx_report_dedupe
+ON reports(reporter, subject, reason_type, status);
+`
+
+func NewReportTable(dir string) *DBxTableReports {
+	path := filepath.Join(dir, "reports.db")
+	return &DBxTableReports{
+		SQLxMustOpen(path, ReportSchema),
+		path,
+	}
+}
+
+// InsertReport records a report, unless the reporter already has an open
+// report for the same subject and reason type. In that case the open report
+// is bumped instead and returned with created false.
+func (d *DBxTableReports) InsertReport(row *ReportRow) (*ReportRow, bool, error) {
+	tx, err := d.Beginx()
+	if err != nil {
+		return nil, false, err
+	}
+	defer tx.Rollback()
+
+	existing := &ReportRow{}
+	err = tx.Get(
+		existing,
+		"SELECT * FROM reports WHERE reporter = $1 AND subject = $2 AND reason_type = $3 AND status = $4 LIMIT 1",
+		row.Reporter,
+		row.Subject,
+		row.ReasonType,
+		ReportStatusOpen,
+	)
+	if err == nil {
+		existing.Reports++
+		existing.UpdatedAt = row.CreatedAt
+		if row.Reason != "" {
+			existing.Reason = row.Reason
+		}
+		if row.SubjectCid != "" {
+			existing.SubjectCid = row.SubjectCid
+		}
+
+		_, err = tx.NamedExec(
+			"UPDATE reports SET reports = :reports, updated_at = :updated_at, reason = :reason, subject_cid = :subject_cid WHERE report_id = :report_id",
+			existing,
+		)
+		if err != nil {
+			return nil, false, err
+		}
+
+		return existing, false, tx.Commit()
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return nil, false, err
+	}
+
+	row.UpdatedAt = row.CreatedAt
+	row.Reports = 1
+	row.Status = ReportStatusOpen
+	res, err := tx.NamedExec(
+		"INSERT INTO reports (created_at, updated_at, reporter, subject, subject_cid, reason_type, reason, reports, status) VALUES (:created_at, :updated_at, :reporter, :subject, :subject_cid, :reason_type, :reason, :reports, :status)",
+		row,
+	)
+	if err != nil {
+		return nil, false, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, false, err
+	}
+	row.ReportId = id
+
+	return row, true, tx.Commit()
+}
+
+func (d *DBxTableReports) FindReports(ids []int64) ([]*ReportRow, error) {
+	rows := make([]*ReportRow, 0, len(ids))
+	if len(ids) == 0 {
+		return rows, nil
+	}
+
+	err := d.Select(
+		&rows,
+		fmt.Sprintf("SELECT * FROM reports WHERE report_id IN (%s) ORDER BY report_id ASC", joinInt64s(ids)),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(rows) != len(uniqueInt64s(ids)) {
+		return nil, fmt.Errorf("could not find all of reports %s", joinInt64s(ids))
+	}
+
+	return rows, nil
+}
+
+func (d *DBxTableReports) SelectReports(status string, before int64, limit int) ([]*ReportRow, error) {
+	rows := make([]*ReportRow, 0)
+	err := d.Select(
+		&rows,
+		"SELECT * FROM reports WHERE status = $1 AND report_id < $2 ORDER BY report_id DESC LIMIT $3",
+		status,
+		before,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return rows, nil
+}
+
+func (d *DBxTableReports) ResolveReports(ids []int64, resolvedBy string, resolvedAt int64, resolution string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	_, err := d.Exec(
+		fmt.Sprintf("UPDATE reports SET status = $1, resolved_by = $2, resolved_at = $3, resolution = $4 WHERE report_id IN (%s)", joinInt64s(ids)),
+		ReportStatusResolved,
+		resolvedBy,
+		resolvedAt,
+		resolution,
+	)
+	return err
+}
+
+func joinInt64s(ids []int64) string {
+	strs := make([]string, len(ids))
+	for i, id := range ids {
+		strs[i] = fmt.Sprintf("%d", id)
+	}
+	return strings.Join(strs, ",")
+}
@@ -0,0 +1,103 @@
+package dbx
+
+import (
+	"context"
+	"testing"
+
+	"github.com/flicknow/go-bluesky-bot/pkg/clock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReportsDedupe(t *testing.T) {
+	d, cleanup := NewTestDBx()
+	defer cleanup()
+
+	actor := d.CreateActor()
+	reporter := d.CreateActor()
+
+	first, created, err := d.Reports.InsertReport(&ReportRow{CreatedAt: 1, Reporter: reporter.Did, Subject: actor.Did, ReasonType: "com.atproto.moderation.defs#reasonSpam"})
+	if err != nil {
+		panic(err)
+	}
+	assert.True(t, created)
+
+	second, created, err := d.Reports.InsertReport(&ReportRow{CreatedAt: 2, Reporter: reporter.Did, Subject: actor.Did, ReasonType: "com.atproto.moderation.defs#reasonSpam", Reason: "still spamming"})
+	if err != nil {
+		panic(err)
+	}
+	assert.False(t, created)
+	assert.Equal(t, first.ReportId, second.ReportId)
+	assert.Equal(t, int64(2), second.Reports)
+	assert.Equal(t, "still spamming", second.Reason)
+
+	_, created, err = d.Reports.InsertReport(&ReportRow{CreatedAt: 3, Reporter: reporter.Did, Subject: actor.Did, ReasonType: "com.atproto.moderation.defs#reasonRude"})
+	if err != nil {
+		panic(err)
+	}
+	assert.True(t, created)
+
+	open, err := d.Reports.SelectReports(ReportStatusOpen, SQLiteMaxInt, 10)
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(t, 2, len(open))
+}
+
+func TestDBxInsertReportUsesClock(t *testing.T) {
+	clock := clock.NewMockClock()
+	d, cleanup := NewTestDBxContext(context.WithValue(context.Background(), "clock", clock))
+	defer cleanup()
+
+	actor := d.CreateActor()
+	reporter := d.CreateActor()
+
+	report, created, err := d.InsertReport(&ReportRow{CreatedAt: 1, Reporter: reporter.Did, Subject: actor.Did, ReasonType: "com.atproto.moderation.defs#reasonSpam"})
+	if err != nil {
+		panic(err)
+	}
+	assert.True(t, created)
+	assert.Equal(t, clock.NowUnix(), report.CreatedAt)
+}
+
+func TestDBxResolveReports(t *testing.T) {
+	d, cleanup := NewTestDBx()
+	defer cleanup()
+
+	actor := d.CreateActor()
+	reporter := d.CreateActor()
+
+	report, _, err := d.Reports.InsertReport(&ReportRow{CreatedAt: 1, Reporter: reporter.Did, Subject: actor.Did, ReasonType: "com.atproto.moderation.defs#reasonSpam"})
+	if err != nil {
+		panic(err)
+	}
+
+	resolved, err := d.ResolveReports("admin", []int64{report.ReportId}, "spam", false)
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(t, 1, len(resolved))
+	assert.Equal(t, "apply:spam", resolved[0].Resolution)
+
+	active, err := d.SelectActiveLabels(actor.Did)
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(t, 1, len(active))
+	assert.Equal(t, "spam", active[0].Val)
+
+	open, err := d.Reports.SelectReports(ReportStatusOpen, SQLiteMaxInt, 10)
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(t, 0, len(open))
+
+	again, created, err := d.Reports.InsertReport(&ReportRow{CreatedAt: 2, Reporter: reporter.Did, Subject: actor.Did, ReasonType: "com.atproto.moderation.defs#reasonSpam"})
+	if err != nil {
+		panic(err)
+	}
+	assert.True(t, created)
+	assert.NotEqual(t, report.ReportId, again.ReportId)
+
+	_, err = d.ResolveReports("admin", []int64{again.ReportId, 999}, "", false)
+	assert.NotNil(t, err)
+}
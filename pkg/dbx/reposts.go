@@ -3,6 +3,7 @@ package dbx
 import (
 	"fmt"
 	"path/filepath"
+	"strings"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/flicknow/go-bluesky-bot/pkg/utils"
@@ -57,3 +58,41 @@ func (d *DBxTableReposts) FindByUri(uri string) (*RepostRow, error) {
 	repost.Uri = utils.HydrateUri(repost.DeHydratedUri, "app.bsky.feed.repost")
 	return repost, nil
 }
+
+// SelectLatestRepostsBySubjectIds finds the latest repost of each subject
+// made by one of actorids.
+func (d *DBxTableReposts) SelectLatestRepostsBySubjectIds(subjectids []int64, actorids []int64) ([]*RepostRow, error) {
+	reposts := make([]*RepostRow, 0, len(subjectids))
+
+	if (len(subjectids) == 0) || (len(actorids) == 0) {
+		return reposts, nil
+	}
+
+	params := make([]any, 0, len(subjectids)+len(actorids))
+	subjectPlcs := make([]string, len(subjectids))
+	for i, id := range subjectids {
+		params = append(params, id)
+		subjectPlcs[i] = "?"
+	}
+	actorPlcs := make([]string, len(actorids))
+	for i, id := range actorids {
+		params = append(params, id)
+		actorPlcs[i] = "?"
+	}
+	q := fmt.Sprintf(
+		"SELECT MAX(repost_id) AS repost_id, uri, actor_id, subject_id, created_at FROM reposts WHERE subject_id IN (%s) AND actor_id IN (%s) GROUP BY subject_id",
+		strings.Join(subjectPlcs, ", "),
+		strings.Join(actorPlcs, ", "),
+	)
+
+	err := d.Select(&reposts, q, params...)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, repost := range reposts {
+		repost.Uri = utils.HydrateUri(repost.DeHydratedUri, "app.bsky.feed.repost")
+	}
+
+	return reposts, nil
+}
@@ -112,6 +112,7 @@ type TestPostRefInput struct {
 	Mentions []string
 	Quote    string
 	Reply    string
+	Root     string
 	Text     string
 	Uri      string
 }
@@ -128,9 +129,13 @@ func NewTestPostRef(input *TestPostRefInput) *firehose.PostRef {
 		ref.Uri = NewTestPostUri(input.Actor)
 	}
 	if input.Reply != "" {
+		root := input.Root
+		if root == "" {
+			root = input.Reply
+		}
 		post.Reply = &bsky.FeedPost_ReplyRef{
 			Parent: &atproto.RepoStrongRef{Uri: input.Reply},
-			Root:   &atproto.RepoStrongRef{Uri: input.Reply},
+			Root:   &atproto.RepoStrongRef{Uri: root},
 		}
 	}
 
@@ -0,0 +1,177 @@
+package feeds
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CacheKey identifies a rendered feed page. Viewer is only set for feeds
+// that require auth, and is the verified did rather than the token, so a
+// viewer's fresh tokens keep hitting the same entry.
+type CacheKey struct {
+	Feed   string
+	Cursor string
+	Limit  string
+	Viewer string
+}
+
+type CacheStats struct {
+	Hits    int64 `json:"hits"`
+	Misses  int64 `json:"misses"`
+	Entries int   `json:"entries"`
+}
+
+type cacheEntry struct {
+	body        []byte
+	expires     time.Time
+	labels      []string
+	generations []int64
+}
+
+// Cache holds rendered feed responses until their ttl runs out or one of
+// the labels they were built from sees a new post.
+type Cache struct {
+	mu          sync.Mutex
+	entries     map[CacheKey]*cacheEntry
+	generations map[string]int64
+	maxEntries  int
+	now         func() time.Time
+	hits        atomic.Int64
+	misses      atomic.Int64
+}
+
+func NewCache(maxEntries int) *Cache {
+	return &Cache{
+		entries:     make(map[CacheKey]*cacheEntry),
+		generations: make(map[string]int64),
+		maxEntries:  maxEntries,
+		now:         time.Now,
+	}
+}
+
+func (c *Cache) Get(key CacheKey) ([]byte, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := c.entries[key]
+	if (entry != nil) && !c.freshLocked(entry) {
+		delete(c.entries, key)
+		entry = nil
+	}
+	if entry == nil {
+		c.misses.Add(1)
+		return nil, false
+	}
+
+	c.hits.Add(1)
+	return entry.body, true
+}
+
+// Snapshot reads the labels' current generations. Take it before running
+// the query behind a page and hand it to Set, so an Invalidate that lands
+// while the query runs isn't lost.
+func (c *Cache) Snapshot(labels []string) []int64 {
+	if c == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	generations := make([]int64, len(labels))
+	for i, label := range labels {
+		generations[i] = c.generations[label]
+	}
+	return generations
+}
+
+// Set caches a page built from labels as of generations, which must come
+// from Snapshot. Pages whose labels have moved on since are dropped.
+func (c *Cache) Set(key CacheKey, body []byte, ttl time.Duration, labels []string, generations []int64) {
+	if (c == nil) || (ttl <= 0) || (c.maxEntries <= 0) || (len(generations) != len(labels)) {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i, label := range labels {
+		if c.generations[label] != generations[i] {
+			return
+		}
+	}
+
+	if len(c.entries) >= c.maxEntries {
+		c.evictLocked()
+	}
+
+	c.entries[key] = &cacheEntry{
+		body:        body,
+		expires:     c.now().Add(ttl),
+		labels:      labels,
+		generations: generations,
+	}
+}
+
+// Invalidate drops every entry built from any of the labels.
+func (c *Cache) Invalidate(labels ...string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, label := range labels {
+		c.generations[label]++
+	}
+}
+
+func (c *Cache) Stats() *CacheStats {
+	if c == nil {
+		return &CacheStats{}
+	}
+
+	c.mu.Lock()
+	entries := len(c.entries)
+	c.mu.Unlock()
+
+	return &CacheStats{Hits: c.hits.Load(), Misses: c.misses.Load(), Entries: entries}
+}
+
+func (c *Cache) freshLocked(entry *cacheEntry) bool {
+	if !c.now().Before(entry.expires) {
+		return false
+	}
+
+	for i, label := range entry.labels {
+		if c.generations[label] != entry.generations[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// evictLocked drops stale entries, and if that doesn't free up a tenth of
+// the cache, arbitrary ones as well.
+func (c *Cache) evictLocked() {
+	for key, entry := range c.entries {
+		if !c.freshLocked(entry) {
+			delete(c.entries, key)
+		}
+	}
+
+	target := c.maxEntries - (c.maxEntries / 10) - 1
+	for key := range c.entries {
+		if len(c.entries) <= target {
+			break
+		}
+		delete(c.entries, key)
+	}
+}
@@ -0,0 +1,81 @@
+package feeds
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheExpires(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	cache := NewCache(10)
+	cache.now = func() time.Time { return now }
+
+	key := CacheKey{Feed: "gmgn", Limit: "25"}
+	_, ok := cache.Get(key)
+	assert.False(t, ok)
+
+	cache.Set(key, []byte("a"), 15*time.Second, []string{"gmgn"}, cache.Snapshot([]string{"gmgn"}))
+	b, ok := cache.Get(key)
+	assert.True(t, ok)
+	assert.Equal(t, []byte("a"), b)
+
+	_, ok = cache.Get(CacheKey{Feed: "gmgn", Limit: "25", Viewer: "did:plc:a"})
+	assert.False(t, ok)
+
+	now = now.Add(15 * time.Second)
+	_, ok = cache.Get(key)
+	assert.False(t, ok)
+
+	assert.Equal(t, &CacheStats{Hits: 1, Misses: 3, Entries: 0}, cache.Stats())
+}
+
+func TestCacheInvalidate(t *testing.T) {
+	cache := NewCache(10)
+
+	gmgn := CacheKey{Feed: "gmgn"}
+	lewds := CacheKey{Feed: "lewds"}
+	cache.Set(gmgn, []byte("a"), time.Minute, []string{"gmgn"}, cache.Snapshot([]string{"gmgn"}))
+	cache.Set(lewds, []byte("b"), time.Minute, []string{"nudity", "porn"}, cache.Snapshot([]string{"nudity", "porn"}))
+
+	cache.Invalidate("porn")
+	_, ok := cache.Get(gmgn)
+	assert.True(t, ok)
+	_, ok = cache.Get(lewds)
+	assert.False(t, ok)
+
+	cache.Set(lewds, []byte("c"), time.Minute, []string{"nudity", "porn"}, cache.Snapshot([]string{"nudity", "porn"}))
+	b, ok := cache.Get(lewds)
+	assert.True(t, ok)
+	assert.Equal(t, []byte("c"), b)
+}
+
+func TestCacheInvalidateDuringQuery(t *testing.T) {
+	cache := NewCache(10)
+
+	key := CacheKey{Feed: "lewds"}
+	labels := []string{"nudity", "porn"}
+	generations := cache.Snapshot(labels)
+
+	cache.Invalidate("porn")
+	cache.Set(key, []byte("a"), time.Minute, labels, generations)
+	_, ok := cache.Get(key)
+	assert.False(t, ok)
+
+	cache.Set(key, []byte("b"), time.Minute, labels, cache.Snapshot(labels))
+	_, ok = cache.Get(key)
+	assert.True(t, ok)
+}
+
+func TestCacheEvicts(t *testing.T) {
+	cache := NewCache(10)
+	for i := 0; i < 25; i++ {
+		cache.Set(CacheKey{Feed: "gmgn", Cursor: string(rune('a' + i))}, []byte("a"), time.Minute, nil, nil)
+	}
+	assert.LessOrEqual(t, cache.Stats().Entries, 10)
+
+	disabled := NewCache(0)
+	disabled.Set(CacheKey{Feed: "gmgn"}, []byte("a"), time.Minute, nil, nil)
+	assert.Equal(t, 0, disabled.Stats().Entries)
+}
@@ -0,0 +1,104 @@
+package feeds
+
+import (
+	"fmt"
+
+	"github.com/flicknow/go-bluesky-bot/pkg/dbx"
+)
+
+// MaxComponents bounds how many feeds a composite feed can mix, since each
+// page runs a query per component.
+var MaxComponents = 8
+
+// Component is one of the feeds mixed into a composite feed, with its share
+// of each page.
+type Component struct {
+	Feed   string  `json:"feed"`
+	Weight float64 `json:"weight"`
+}
+
+// CompositeCursor holds where each component of a composite feed is paged
+// to, in the order the components are listed. Components page by different
+// ids, ie bangers by label, so one id cannot stand in for all of them.
+type CompositeCursor []int64
+
+// NewCompositeCursor starts every component at its newest post.
+func NewCompositeCursor(components int) CompositeCursor {
+	cursor := make(CompositeCursor, components)
+	for i := range cursor {
+		cursor[i] = dbx.SQLiteMaxInt
+	}
+	return cursor
+}
+
+// CompositeItem is a post picked for a page of a composite feed, along with
+// the component it came from.
+type CompositeItem struct {
+	Post      *dbx.PostRow
+	Component *Component
+}
+
+// Interleave mixes the pages fetched for each component at cursor into one
+// page of up to limit posts. Components take turns by weight, using smooth
+// weighted round robin so each is spread through the page, and posts already
+// picked from another component are dropped. The returned cursor only moves
+// each component past the posts it used up, so nothing is lost between pages.
+func (f *Feed) Interleave(cursor CompositeCursor, pages [][]*dbx.PostRow, limit int) ([]*CompositeItem, CompositeCursor) {
+	next := make(CompositeCursor, len(cursor))
+	copy(next, cursor)
+
+	offsets := make([]int, len(f.Components))
+	current := make([]float64, len(f.Components))
+	seen := make(map[string]bool)
+	items := make([]*CompositeItem, 0, limit)
+	for len(items) < limit {
+		best := -1
+		total := 0.0
+		for i, component := range f.Components {
+			if (i >= len(pages)) || (offsets[i] >= len(pages[i])) {
+				continue
+			}
+
+			current[i] += component.Weight
+			total += component.Weight
+			if (best == -1) || (current[i] > current[best]) {
+				best = i
+			}
+		}
+		if best == -1 {
+			break
+		}
+		current[best] -= total
+
+		post := pages[best][offsets[best]]
+		offsets[best]++
+		next[best] = post.FeedPosition()
+
+		if seen[post.Uri] {
+			continue
+		}
+		seen[post.Uri] = true
+		items = append(items, &CompositeItem{Post: post, Component: f.Components[best]})
+	}
+
+	return items, next
+}
+
+func (r *Registry) validateComponents(f *Feed) error {
+	for _, c := range f.Components {
+		component, _ := r.Resolve(c.Feed)
+		if component == nil {
+			return fmt.Errorf("feed %s mixes in unknown feed %s", f.Name, c.Feed)
+		}
+		if component.Kind == KindComposite {
+			return fmt.Errorf("feed %s cannot mix in composite feed %s", f.Name, c.Feed)
+		}
+		if !(c.Weight > 0) {
+			return fmt.Errorf("feed %s needs a positive weight for %s", f.Name, c.Feed)
+		}
+		if component.Auth && !f.Auth {
+			return fmt.Errorf("feed %s must require auth to mix in %s", f.Name, c.Feed)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package feeds
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/flicknow/go-bluesky-bot/pkg/dbx"
+	"github.com/stretchr/testify/assert"
+)
+
+func testPosts(name string, ids ...int64) []*dbx.PostRow {
+	posts := make([]*dbx.PostRow, 0, len(ids))
+	for _, id := range ids {
+		posts = append(posts, &dbx.PostRow{PostId: id, Uri: fmt.Sprintf("at://%s/%d", name, id)})
+	}
+	return posts
+}
+
+func TestInterleave(t *testing.T) {
+	feed := &Feed{Name: "mix", Kind: KindComposite, Components: []*Component{
+		{Feed: "a", Weight: 70},
+		{Feed: "b", Weight: 20},
+		{Feed: "c", Weight: 10},
+	}}
+
+	pages := [][]*dbx.PostRow{
+		testPosts("a", 100, 99, 98, 97, 96, 95, 94, 93, 92, 91),
+		testPosts("b", 50, 49, 48, 47, 46, 45, 44, 43, 42, 41),
+		testPosts("c", 20, 19, 18, 17, 16, 15, 14, 13, 12, 11),
+	}
+
+	items, next := feed.Interleave(NewCompositeCursor(3), pages, 10)
+	counts := make(map[string]int)
+	for _, item := range items {
+		counts[item.Component.Feed]++
+	}
+	assert.Equal(t, map[string]int{"a": 7, "b": 2, "c": 1}, counts)
+	assert.Equal(t, CompositeCursor{94, 49, 20}, next)
+	assert.Equal(t, "a", items[0].Component.Feed)
+}
+
+func TestInterleavePosition(t *testing.T) {
+	feed := &Feed{Name: "mix", Kind: KindComposite, Components: []*Component{{Feed: "bangers", Weight: 1}}}
+
+	posts := testPosts("bangers", 5, 4)
+	posts[0].Position = 900
+	posts[1].Position = 800
+
+	items, next := feed.Interleave(NewCompositeCursor(1), [][]*dbx.PostRow{posts}, 10)
+	assert.Len(t, items, 2)
+	assert.Equal(t, CompositeCursor{800}, next)
+}
+
+func TestInterleaveDedupes(t *testing.T) {
+	feed := &Feed{Name: "mix", Kind: KindComposite, Components: []*Component{
+		{Feed: "a", Weight: 1},
+		{Feed: "b", Weight: 1},
+	}}
+
+	shared := testPosts("shared", 7)[0]
+	pages := [][]*dbx.PostRow{
+		append([]*dbx.PostRow{shared}, testPosts("a", 6)...),
+		append([]*dbx.PostRow{{PostId: 30, Uri: shared.Uri}}, testPosts("b", 29, 28)...),
+	}
+
+	items, next := feed.Interleave(NewCompositeCursor(2), pages, 10)
+	uris := make([]string, 0, len(items))
+	for _, item := range items {
+		uris = append(uris, item.Post.Uri)
+	}
+	assert.Equal(t, []string{shared.Uri, "at://a/6", "at://b/29", "at://b/28"}, uris)
+	assert.Equal(t, CompositeCursor{6, 28}, next)
+
+	items, next = feed.Interleave(CompositeCursor{5, 1}, [][]*dbx.PostRow{nil, nil}, 10)
+	assert.Empty(t, items)
+	assert.Equal(t, CompositeCursor{5, 1}, next)
+}
@@ -0,0 +1,158 @@
+package feeds
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// CursorVersion is written into every cursor, so the encoding can change
+// without misreading cursors handed out before.
+const CursorVersion = 1
+
+var MaxCursorLength = 512
+
+const cursorMacSize = 16
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// legacy cursors were "<createdAt>::P<postid>", "<createdAt>::C<id>.<id>"
+// for composite feeds, and "<epoch>::<rkey>" before that
+var legacyCursorRegex = regexp.MustCompile(`^([0-9]+)::(?:P([0-9]+)|C([0-9]+(?:\.[0-9]+)*)|([a-zA-Z0-9._~:-]+))$`)
+
+// Cursor is where the next page of a feed starts. Positions holds one id per
+// component for composite feeds and a single id for everything else.
+type Cursor struct {
+	Version   int
+	Kind      Kind
+	Positions []int64
+	// Rkey is only set by legacy timestamp cursors, which page from the post
+	// with this rkey made at the epoch in Positions[0].
+	Rkey string
+}
+
+// Legacy cursors were not signed and do not know their feed kind.
+func (c *Cursor) Legacy() bool {
+	return c.Version == 0
+}
+
+// CursorCodec turns cursors into opaque strings signed with an HMAC, so
+// clients cannot page from positions we never handed them.
+type CursorCodec struct {
+	key    []byte
+	legacy bool
+}
+
+// NewCursorCodec signs cursors with key. When legacy is set, cursors in the
+// old plain text formats are still accepted.
+func NewCursorCodec(key []byte, legacy bool) *CursorCodec {
+	return &CursorCodec{key: key, legacy: legacy}
+}
+
+func (c *CursorCodec) mac(payload []byte) []byte {
+	h := hmac.New(sha256.New, c.key)
+	h.Write(payload)
+	return h.Sum(nil)[:cursorMacSize]
+}
+
+func (c *CursorCodec) Encode(kind Kind, positions ...int64) string {
+	payload := []byte{CursorVersion}
+	payload = binary.AppendUvarint(payload, uint64(len(kind)))
+	payload = append(payload, kind...)
+	payload = binary.AppendUvarint(payload, uint64(len(positions)))
+	for _, position := range positions {
+		payload = binary.AppendVarint(payload, position)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(append(payload, c.mac(payload)...))
+}
+
+func (c *CursorCodec) Decode(cursor string) (*Cursor, error) {
+	if (cursor == "") || (len(cursor) > MaxCursorLength) {
+		return nil, ErrInvalidCursor
+	}
+	if strings.Contains(cursor, "::") {
+		if !c.legacy {
+			return nil, ErrInvalidCursor
+		}
+		return decodeLegacyCursor(cursor)
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if (err != nil) || (len(b) <= cursorMacSize) {
+		return nil, ErrInvalidCursor
+	}
+
+	payload, mac := b[:len(b)-cursorMacSize], b[len(b)-cursorMacSize:]
+	if !hmac.Equal(mac, c.mac(payload)) {
+		return nil, ErrInvalidCursor
+	}
+	if payload[0] != CursorVersion {
+		return nil, ErrInvalidCursor
+	}
+	payload = payload[1:]
+
+	size, n := binary.Uvarint(payload)
+	if (n <= 0) || (size > uint64(len(payload)-n)) {
+		return nil, ErrInvalidCursor
+	}
+	payload = payload[n:]
+	decoded := &Cursor{Version: CursorVersion, Kind: Kind(payload[:size])}
+	payload = payload[size:]
+
+	count, n := binary.Uvarint(payload)
+	if (n <= 0) || (count > uint64(len(payload)-n)) {
+		return nil, ErrInvalidCursor
+	}
+	payload = payload[n:]
+
+	decoded.Positions = make([]int64, 0, count)
+	for i := uint64(0); i < count; i++ {
+		position, n := binary.Varint(payload)
+		if n <= 0 {
+			return nil, ErrInvalidCursor
+		}
+		payload = payload[n:]
+		decoded.Positions = append(decoded.Positions, position)
+	}
+	if len(payload) != 0 {
+		return nil, ErrInvalidCursor
+	}
+
+	return decoded, nil
+}
+
+func decodeLegacyCursor(cursor string) (*Cursor, error) {
+	match := legacyCursorRegex.FindStringSubmatch(cursor)
+	if match == nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var fields []string
+	decoded := &Cursor{}
+	switch {
+	case match[2] != "":
+		fields = []string{match[2]}
+	case match[3] != "":
+		fields = strings.Split(match[3], ".")
+	default:
+		fields = []string{match[1]}
+		decoded.Rkey = match[4]
+	}
+
+	decoded.Positions = make([]int64, 0, len(fields))
+	for _, field := range fields {
+		position, err := strconv.ParseInt(field, 10, 64)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		decoded.Positions = append(decoded.Positions, position)
+	}
+
+	return decoded, nil
+}
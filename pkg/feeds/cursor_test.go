@@ -0,0 +1,106 @@
+package feeds
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testCursorKey = []byte("test cursor key")
+
+func TestCursorRoundTrip(t *testing.T) {
+	codec := NewCursorCodec(testCursorKey, false)
+
+	encoded := codec.Encode(KindComposite, 12, 9223372036854775807, 0, -1)
+	assert.NotContains(t, encoded, "::")
+
+	cursor, err := codec.Decode(encoded)
+	assert.NoError(t, err)
+	assert.Equal(t, &Cursor{Version: CursorVersion, Kind: KindComposite, Positions: []int64{12, 9223372036854775807, 0, -1}}, cursor)
+	assert.False(t, cursor.Legacy())
+
+	_, err = NewCursorCodec([]byte("another key"), false).Decode(encoded)
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+
+	tampered := []byte(encoded)
+	tampered[2] ^= 1
+	_, err = codec.Decode(string(tampered))
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+
+	_, err = codec.Decode(strings.Repeat("a", MaxCursorLength+1))
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+}
+
+func TestLegacyCursor(t *testing.T) {
+	codec := NewCursorCodec(testCursorKey, true)
+
+	cursor, err := codec.Decode("1700000000::P42")
+	assert.NoError(t, err)
+	assert.Equal(t, &Cursor{Positions: []int64{42}}, cursor)
+	assert.True(t, cursor.Legacy())
+
+	cursor, err = codec.Decode("1700000000::C12.3")
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{12, 3}, cursor.Positions)
+
+	cursor, err = codec.Decode("1700000000::3kabc")
+	assert.NoError(t, err)
+	assert.Equal(t, &Cursor{Positions: []int64{1700000000}, Rkey: "3kabc"}, cursor)
+
+	for _, bad := range []string{"1700000000::", "::P1", "1::P99999999999999999999", "1::C1.99999999999999999999", "1::/"} {
+		_, err = codec.Decode(bad)
+		assert.ErrorIs(t, err, ErrInvalidCursor, bad)
+	}
+
+	_, err = NewCursorCodec(testCursorKey, false).Decode("1700000000::P42")
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+}
+
+func FuzzCursorDecode(f *testing.F) {
+	codec := NewCursorCodec(testCursorKey, true)
+	for _, seed := range []string{
+		"",
+		"1700000000::P42",
+		"1700000000::C12.3",
+		"1700000000::3kabc",
+		"1700000000::",
+		codec.Encode(KindLatest, 42),
+		codec.Encode(KindComposite, 1, 2, 3),
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, s string) {
+		cursor, err := codec.Decode(s)
+		if err != nil {
+			assert.ErrorIs(t, err, ErrInvalidCursor)
+			return
+		}
+		if cursor.Legacy() {
+			assert.Contains(t, s, "::")
+			return
+		}
+
+		again, err := codec.Decode(codec.Encode(cursor.Kind, cursor.Positions...))
+		assert.NoError(t, err)
+		assert.Equal(t, cursor, again)
+	})
+}
+
+func FuzzCursorRoundTrip(f *testing.F) {
+	f.Add("latest", int64(42), int64(0))
+	f.Add("composite", int64(9223372036854775807), int64(-9223372036854775808))
+
+	codec := NewCursorCodec(testCursorKey, false)
+	f.Fuzz(func(t *testing.T, kind string, a int64, b int64) {
+		encoded := codec.Encode(Kind(kind), a, b)
+		if len(encoded) > MaxCursorLength {
+			t.Skip()
+		}
+
+		cursor, err := codec.Decode(encoded)
+		assert.NoError(t, err)
+		assert.Equal(t, &Cursor{Version: CursorVersion, Kind: Kind(kind), Positions: []int64{a, b}}, cursor)
+	})
+}
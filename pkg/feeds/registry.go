@@ -0,0 +1,334 @@
+package feeds
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/flicknow/go-bluesky-bot/pkg/rules"
+)
+
+var DefaultDid = "did:web:flicknow.xyz"
+
+type Kind string
+
+const (
+	KindLabels            Kind = "labels"
+	KindFollowedLabels    Kind = "followed-labels"
+	KindMentions          Kind = "mentions"
+	KindFollowedMentions  Kind = "followed-mentions"
+	KindDms               Kind = "dms"
+	KindMark              Kind = "mark"
+	KindQuotes            Kind = "quotes"
+	KindReplies           Kind = "replies"
+	KindThreadsFollowed   Kind = "followed-threads"
+	KindConversations     Kind = "conversations"
+	KindBangers           Kind = "bangers"
+	KindMilestone         Kind = "milestone"
+	KindFollowedMilestone Kind = "followed-milestone"
+	KindLatest            Kind = "latest"
+	KindComposite         Kind = "composite"
+)
+
+// personalKinds are queried for the requesting viewer, so they only work
+// with a verified did and responses vary by authorization.
+var personalKinds = map[Kind]bool{
+	KindFollowedLabels:    true,
+	KindMentions:          true,
+	KindFollowedMentions:  true,
+	KindDms:               true,
+	KindMark:              true,
+	KindQuotes:            true,
+	KindReplies:           true,
+	KindThreadsFollowed:   true,
+	KindConversations:     true,
+	KindFollowedMilestone: true,
+}
+
+var labelKinds = map[Kind]bool{
+	KindLabels:            true,
+	KindFollowedLabels:    true,
+	KindMilestone:         true,
+	KindFollowedMilestone: true,
+}
+
+var knownKinds = map[Kind]bool{
+	KindLabels:            true,
+	KindFollowedLabels:    true,
+	KindMentions:          true,
+	KindFollowedMentions:  true,
+	KindDms:               true,
+	KindMark:              true,
+	KindQuotes:            true,
+	KindReplies:           true,
+	KindThreadsFollowed:   true,
+	KindConversations:     true,
+	KindBangers:           true,
+	KindMilestone:         true,
+	KindFollowedMilestone: true,
+	KindLatest:            true,
+	KindComposite:         true,
+}
+
+// Feed is one entry in the registry. A name ending in "*" is a pattern that
+// matches any feed with that prefix, and a "*" in its labels is replaced by
+// whatever the pattern matched. A composite feed mixes the feeds named in
+// its components instead of running a query of its own.
+type Feed struct {
+	Name       string          `json:"name"`
+	Aliases    []string        `json:"aliases,omitempty"`
+	Kind       Kind            `json:"kind"`
+	Labels     []string        `json:"labels,omitempty"`
+	Components []*Component    `json:"components,omitempty"`
+	Auth       bool            `json:"auth,omitempty"`
+	CacheTTL   *rules.Duration `json:"cacheTtl,omitempty"`
+	PinnedPost string          `json:"pinnedPost,omitempty"`
+	Disabled   bool            `json:"disabled,omitempty"`
+	Hidden     bool            `json:"hidden,omitempty"`
+}
+
+type Registry struct {
+	Did      string  `json:"did"`
+	Feeds    []*Feed `json:"feeds"`
+	byName   map[string]*Feed
+	patterns []*Feed
+}
+
+func (f *Feed) IsPattern() bool {
+	return strings.HasSuffix(f.Name, "*")
+}
+
+func (f *Feed) Prefix() string {
+	return strings.TrimSuffix(f.Name, "*")
+}
+
+// CacheMaxAge is the max-age in seconds for a response, with zero meaning it
+// should not be cached. Later pages change less, so they default to longer.
+func (f *Feed) CacheMaxAge(paged bool) int {
+	if f.CacheTTL != nil {
+		return int(f.CacheTTL.Duration / time.Second)
+	}
+	if paged {
+		return 600
+	}
+	return 15
+}
+
+func (f *Feed) validate() error {
+	if f.Name == "" {
+		return fmt.Errorf("feed %q needs a name", f.Name)
+	}
+	if strings.Contains(f.Prefix(), "*") {
+		return fmt.Errorf("feed %s can only have a '*' at the end of its name", f.Name)
+	}
+	if !knownKinds[f.Kind] {
+		return fmt.Errorf("feed %s has unknown kind %q", f.Name, f.Kind)
+	}
+	if personalKinds[f.Kind] && !f.Auth {
+		return fmt.Errorf("feed %s of kind %s must require auth", f.Name, f.Kind)
+	}
+	if labelKinds[f.Kind] {
+		if len(f.Labels) == 0 && !f.IsPattern() {
+			return fmt.Errorf("feed %s of kind %s needs labels", f.Name, f.Kind)
+		}
+		if (f.Kind == KindMilestone || f.Kind == KindFollowedMilestone) && len(f.Labels) > 1 {
+			return fmt.Errorf("feed %s of kind %s takes a single label", f.Name, f.Kind)
+		}
+	} else if len(f.Labels) > 0 {
+		return fmt.Errorf("feed %s of kind %s does not take labels", f.Name, f.Kind)
+	}
+	if f.Kind == KindComposite {
+		if f.IsPattern() {
+			return fmt.Errorf("feed %s is composite and cannot be a pattern", f.Name)
+		}
+		if len(f.Components) == 0 {
+			return fmt.Errorf("feed %s of kind %s needs components", f.Name, f.Kind)
+		}
+		if len(f.Components) > MaxComponents {
+			return fmt.Errorf("feed %s mixes more than %d feeds", f.Name, MaxComponents)
+		}
+	} else if len(f.Components) > 0 {
+		return fmt.Errorf("feed %s of kind %s does not take components", f.Name, f.Kind)
+	}
+	if (f.CacheTTL != nil) && (f.CacheTTL.Duration < 0) {
+		return fmt.Errorf("feed %s has a negative cacheTtl", f.Name)
+	}
+
+	return nil
+}
+
+func NewRegistry(did string, feeds []*Feed) (*Registry, error) {
+	if did == "" {
+		did = DefaultDid
+	}
+
+	registry := &Registry{Did: did, Feeds: feeds, byName: make(map[string]*Feed), patterns: make([]*Feed, 0)}
+	for _, feed := range feeds {
+		err := feed.validate()
+		if err != nil {
+			return nil, err
+		}
+
+		if feed.IsPattern() {
+			if len(feed.Aliases) > 0 {
+				return nil, fmt.Errorf("feed %s is a pattern and cannot have aliases", feed.Name)
+			}
+			registry.patterns = append(registry.patterns, feed)
+			continue
+		}
+
+		for _, name := range append([]string{feed.Name}, feed.Aliases...) {
+			if registry.byName[name] != nil {
+				return nil, fmt.Errorf("feed %s is defined more than once", name)
+			}
+			registry.byName[name] = feed
+		}
+	}
+
+	// components can name feeds defined after them, so they are checked
+	// once everything is registered
+	for _, feed := range feeds {
+		err := registry.validateComponents(feed)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return registry, nil
+}
+
+func LoadRegistry(path string) (*Registry, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading feeds %s: %w", path, err)
+	}
+
+	parsed := &Registry{}
+	err = json.Unmarshal(b, parsed)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing feeds %s: %w", path, err)
+	}
+
+	return NewRegistry(parsed.Did, parsed.Feeds)
+}
+
+// Resolve finds the feed serving name along with the labels it queries.
+// Exact names and aliases win over patterns, which are tried in order.
+func (r *Registry) Resolve(name string) (*Feed, []string) {
+	if (r == nil) || (name == "") {
+		return nil, nil
+	}
+
+	feed := r.byName[name]
+	if feed != nil {
+		return feed, feed.Labels
+	}
+
+	for _, feed := range r.patterns {
+		prefix := feed.Prefix()
+		if (len(name) <= len(prefix)) || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+
+		match := name[len(prefix):]
+		labels := feed.Labels
+		if len(labels) == 0 {
+			labels = []string{"*"}
+		}
+
+		expanded := make([]string, 0, len(labels))
+		for _, label := range labels {
+			expanded = append(expanded, strings.ReplaceAll(label, "*", match))
+		}
+		return feed, expanded
+	}
+
+	return nil, nil
+}
+
+func (r *Registry) Uri(name string) string {
+	return fmt.Sprintf("at://%s/app.bsky.feed.generator/%s", r.Did, name)
+}
+
+// Add appends feeds that are not already registered by name.
+func (r *Registry) Add(feeds ...*Feed) error {
+	for _, feed := range feeds {
+		if feed.IsPattern() || (r.byName[feed.Name] != nil) {
+			continue
+		}
+
+		err := feed.validate()
+		if err != nil {
+			return err
+		}
+		err = r.validateComponents(feed)
+		if err != nil {
+			return err
+		}
+		r.Feeds = append(r.Feeds, feed)
+		r.byName[feed.Name] = feed
+	}
+
+	return nil
+}
+
+// MilestoneFeeds are the global and followed feeds for a milestone label.
+func MilestoneFeeds(name string, label string) []*Feed {
+	return []*Feed{
+		{Name: name, Kind: KindMilestone, Labels: []string{label}},
+		{Name: "f-" + name, Kind: KindFollowedMilestone, Labels: []string{label}, Auth: true},
+	}
+}
+
+func DefaultFeeds() []*Feed {
+	lewds := []string{"underwear", "nudity", "porn", "sexual"}
+	noCache := &rules.Duration{}
+
+	feeds := []*Feed{
+		{Name: "allmentions", Kind: KindMentions, Auth: true},
+		{Name: "f-allmentions", Kind: KindFollowedMentions, Auth: true},
+		{Name: "ceusemlimites", Kind: KindLabels, Labels: []string{"ceusemlimites"}},
+		{Name: "conversations", Kind: KindConversations, Auth: true},
+		{Name: "dms", Kind: KindDms, Auth: true},
+		{Name: "firehose", Kind: KindLatest, CacheTTL: noCache},
+		{Name: "first20", Kind: KindLabels, Labels: []string{"first20"}},
+		{Name: "bangers", Kind: KindBangers},
+	}
+	feeds = append(feeds, MilestoneFeeds("birthdays", "birthday")...)
+	feeds = append(
+		feeds,
+		&Feed{Name: "gmgn", Kind: KindLabels, Labels: []string{"gmgn"}},
+		&Feed{Name: "f-gmgn", Kind: KindFollowedLabels, Labels: []string{"gmgn"}, Auth: true},
+		&Feed{Name: "lewds", Kind: KindLabels, Labels: lewds},
+		&Feed{Name: "f-lewds", Kind: KindFollowedLabels, Labels: lewds, Auth: true, Disabled: true},
+		&Feed{Name: "mark", Kind: KindMark, Auth: true},
+		&Feed{Name: "mentions", Kind: KindMentions, Auth: true},
+		&Feed{Name: "f-mentions", Kind: KindFollowedMentions, Auth: true},
+		&Feed{Name: "newskies", Aliases: []string{"newsky", "newskie"}, Kind: KindLabels, Labels: []string{"newskie"}},
+		&Feed{Name: "noskies", Kind: KindLabels, Labels: []string{"newskie"}},
+		&Feed{Name: "quotes", Kind: KindQuotes, Auth: true},
+		&Feed{Name: "rembangs", Kind: KindLabels, Labels: []string{"rembangs"}},
+		&Feed{Name: "replies", Kind: KindReplies, Auth: true},
+		&Feed{Name: "renewskies", Aliases: []string{"renewskie"}, Kind: KindLabels, Labels: []string{"renewskie"}},
+		&Feed{Name: "f-renewskies", Kind: KindFollowedLabels, Labels: []string{"renewskie"}, Auth: true},
+		&Feed{Name: "rude", Kind: KindLabels, Labels: []string{"rude"}},
+		&Feed{Name: "f-threads", Kind: KindThreadsFollowed, Auth: true},
+		&Feed{
+			Name: "mixtape",
+			Kind: KindComposite,
+			Auth: true,
+			Components: []*Component{
+				{Feed: "f-mentions", Weight: 70},
+				{Feed: "bangers", Weight: 20},
+				{Feed: "newskie", Weight: 10},
+			},
+		},
+		&Feed{Name: "newskie-*", Kind: KindLabels, Labels: []string{"newskie-*"}},
+		&Feed{Name: "f-*", Kind: KindFollowedLabels, Auth: true, Hidden: true},
+		&Feed{Name: "*", Kind: KindLabels, Hidden: true},
+	)
+
+	return feeds
+}
@@ -0,0 +1,162 @@
+package feeds
+
+import (
+	"testing"
+
+	"github.com/flicknow/go-bluesky-bot/pkg/labeler"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadRegistryConfig(t *testing.T) {
+	registry, err := LoadRegistry("../../config/feeds.json")
+	if err != nil {
+		panic(err)
+	}
+
+	assert.Equal(t, "did:web:flicknow.xyz", registry.Did)
+	assert.Equal(t, "at://did:web:flicknow.xyz/app.bsky.feed.generator/bangers", registry.Uri("bangers"))
+
+	feed, labels := registry.Resolve("f-bday-one")
+	assert.Equal(t, KindFollowedMilestone, feed.Kind)
+	assert.Equal(t, []string{"bday-one"}, labels)
+
+	feed, _ = registry.Resolve("firehose")
+	assert.Equal(t, 0, feed.CacheMaxAge(false))
+}
+
+// config/feeds.json is the built in feeds plus the milestones in
+// config/milestones.json, written out for people who want to edit them.
+func TestRegistryConfigMatchesDefaults(t *testing.T) {
+	file, err := LoadRegistry("../../config/feeds.json")
+	if err != nil {
+		panic(err)
+	}
+
+	defaults, err := NewRegistry(DefaultDid, DefaultFeeds())
+	if err != nil {
+		panic(err)
+	}
+	milestones, err := labeler.LoadMilestones("../../config/milestones.json")
+	if err != nil {
+		panic(err)
+	}
+	for _, milestone := range milestones.Milestones {
+		if milestone.Label == "birthday" {
+			continue
+		}
+		err = defaults.Add(MilestoneFeeds(milestone.Label, milestone.Label)...)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	byName := func(feeds []*Feed) map[string]*Feed {
+		named := make(map[string]*Feed)
+		for _, feed := range feeds {
+			named[feed.Name] = feed
+		}
+		return named
+	}
+
+	assert.Equal(t, defaults.Did, file.Did)
+	assert.Equal(t, byName(defaults.Feeds), byName(file.Feeds))
+}
+
+func TestRegistryResolve(t *testing.T) {
+	registry, err := NewRegistry("", DefaultFeeds())
+	if err != nil {
+		panic(err)
+	}
+
+	feed, labels := registry.Resolve("newsky")
+	assert.Equal(t, "newskies", feed.Name)
+	assert.Equal(t, []string{"newskie"}, labels)
+
+	feed, labels = registry.Resolve("newskie-en")
+	assert.Equal(t, "newskie-*", feed.Name)
+	assert.Equal(t, []string{"newskie-en"}, labels)
+
+	feed, labels = registry.Resolve("f-gmgn")
+	assert.Equal(t, "f-gmgn", feed.Name)
+	assert.True(t, feed.Auth)
+
+	feed, _ = registry.Resolve("f-threads")
+	assert.Equal(t, KindThreadsFollowed, feed.Kind)
+	assert.True(t, feed.Auth)
+
+	feed, labels = registry.Resolve("f-rembangs")
+	assert.Equal(t, "f-*", feed.Name)
+	assert.Equal(t, []string{"rembangs"}, labels)
+
+	feed, labels = registry.Resolve("anything")
+	assert.Equal(t, "*", feed.Name)
+	assert.Equal(t, []string{"anything"}, labels)
+
+	feed, _ = registry.Resolve("bangers")
+	assert.Equal(t, 15, feed.CacheMaxAge(false))
+	assert.Equal(t, 600, feed.CacheMaxAge(true))
+
+	feed, _ = registry.Resolve("")
+	assert.Nil(t, feed)
+}
+
+func TestRegistryInvalid(t *testing.T) {
+	_, err := NewRegistry("", []*Feed{{Name: "mentions", Kind: KindMentions}})
+	assert.NotNil(t, err)
+
+	_, err = NewRegistry("", []*Feed{{Name: "lewds", Kind: KindLabels}})
+	assert.NotNil(t, err)
+
+	_, err = NewRegistry("", []*Feed{{Name: "latest", Kind: "newest"}})
+	assert.NotNil(t, err)
+
+	_, err = NewRegistry("", []*Feed{{Name: "a*b", Kind: KindLabels, Labels: []string{"a"}}})
+	assert.NotNil(t, err)
+
+	_, err = NewRegistry("", []*Feed{
+		{Name: "bangers", Kind: KindBangers},
+		{Name: "rembangs", Aliases: []string{"bangers"}, Kind: KindBangers},
+	})
+	assert.NotNil(t, err)
+}
+
+func TestRegistryComposite(t *testing.T) {
+	registry, err := NewRegistry("", DefaultFeeds())
+	if err != nil {
+		panic(err)
+	}
+
+	feed, _ := registry.Resolve("mixtape")
+	assert.Equal(t, KindComposite, feed.Kind)
+	assert.Len(t, feed.Components, 3)
+
+	_, err = NewRegistry("", []*Feed{
+		{Name: "mix", Kind: KindComposite, Auth: true, Components: []*Component{{Feed: "nope", Weight: 1}}},
+	})
+	assert.ErrorContains(t, err, "unknown feed nope")
+
+	_, err = NewRegistry("", []*Feed{
+		{Name: "mix", Kind: KindComposite, Components: []*Component{{Feed: "mentions", Weight: 1}}},
+		{Name: "mentions", Kind: KindMentions, Auth: true},
+	})
+	assert.ErrorContains(t, err, "must require auth")
+
+	_, err = NewRegistry("", []*Feed{
+		{Name: "mix", Kind: KindComposite, Components: []*Component{{Feed: "bangers", Weight: 0}}},
+		{Name: "bangers", Kind: KindBangers},
+	})
+	assert.ErrorContains(t, err, "positive weight")
+
+	_, err = NewRegistry("", []*Feed{
+		{Name: "mix", Kind: KindComposite, Components: []*Component{{Feed: "bangers", Weight: 1}}},
+		{Name: "remix", Kind: KindComposite, Components: []*Component{{Feed: "mix", Weight: 1}}},
+		{Name: "bangers", Kind: KindBangers},
+	})
+	assert.ErrorContains(t, err, "cannot mix in composite")
+
+	_, err = NewRegistry("", []*Feed{{Name: "mix", Kind: KindComposite}})
+	assert.ErrorContains(t, err, "needs components")
+
+	_, err = NewRegistry("", []*Feed{{Name: "bangers", Kind: KindBangers, Components: []*Component{{Feed: "bangers", Weight: 1}}}})
+	assert.ErrorContains(t, err, "does not take components")
+}
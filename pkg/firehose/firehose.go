@@ -9,6 +9,8 @@ import (
 	"net/url"
 	"regexp"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	comatproto "github.com/bluesky-social/indigo/api/atproto"
 	appbsky "github.com/bluesky-social/indigo/api/bsky"
@@ -16,6 +18,7 @@ import (
 	lexutil "github.com/bluesky-social/indigo/lex/util"
 	"github.com/bluesky-social/indigo/repo"
 	"github.com/bluesky-social/indigo/repomgr"
+	"github.com/flicknow/go-bluesky-bot/pkg/metrics"
 	"github.com/flicknow/go-bluesky-bot/pkg/utils"
 )
 
@@ -213,7 +216,8 @@ type FirehoseEvent struct {
 }
 
 type Firehose struct {
-	s *Subscriber
+	s         *Subscriber
+	lastEvent atomic.Int64
 }
 
 func NewFirehose(ctx context.Context) *Firehose {
@@ -246,8 +250,19 @@ func NewFirehose(ctx context.Context) *Firehose {
 	}
 }
 
+// LastEventTime is when the latest commit seen was made, or zero if none
+// have been seen.
+func (f *Firehose) LastEventTime() time.Time {
+	last := f.lastEvent.Load()
+	if last == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, last)
+}
+
 func (f *Firehose) Ack(seq int64) {
 	f.s.Ack(seq)
+	metrics.StreamCursor.WithLabelValues("firehose").Set(float64(seq))
 }
 
 func (f *Firehose) proxyStream(sCh <-chan *SubscriberEvent) <-chan *FirehoseEvent {
@@ -276,6 +291,7 @@ func (f *Firehose) proxyStream(sCh <-chan *SubscriberEvent) <-chan *FirehoseEven
 			}
 
 			for _, lEvt := range lEvts {
+				metrics.Events.WithLabelValues("firehose", lEvt.Type).Inc()
 				fCh <- lEvt
 
 				if (lEvt.Error != nil) && (errors.Is(lEvt.Error, ErrFatal)) {
@@ -310,6 +326,7 @@ func (f *Firehose) Stop() {
 }
 
 func (f *Firehose) Restart(ctx context.Context) (<-chan *FirehoseEvent, error) {
+	metrics.StreamReconnects.WithLabelValues("firehose").Inc()
 	ch, err := f.s.Restart(ctx)
 	if err != nil {
 		return nil, err
@@ -369,6 +386,10 @@ func (f *Firehose) processSubscriberEvent(sEvt *SubscriberEvent) []*FirehoseEven
 			return []*FirehoseEvent{&FirehoseEvent{Error: fmt.Errorf("error unmarshalling #commit: %w", err), Type: EvtKindError}}
 		}
 
+		if t := metrics.ObserveLag("firehose", CommitEvt.Time); !t.IsZero() {
+			f.lastEvent.Store(t.UnixNano())
+		}
+
 		if CommitEvt.TooBig {
 			return nil
 		}
@@ -5,11 +5,14 @@ import (
 	"fmt"
 	"log"
 	"net/url"
+	"sync/atomic"
+	"time"
 
 	"errors"
 
 	comatproto "github.com/bluesky-social/indigo/api/atproto"
 	"github.com/bluesky-social/indigo/events"
+	"github.com/flicknow/go-bluesky-bot/pkg/metrics"
 )
 
 var DefaultLabelerHost = "https://mod.bsky.app"
@@ -28,7 +31,8 @@ type LabelerEvent struct {
 }
 
 type LabelerFirehose struct {
-	s *Subscriber
+	s            *Subscriber
+	lastReceived atomic.Int64
 }
 
 func NewLabelerFirehose(ctx context.Context) *LabelerFirehose {
@@ -61,8 +65,19 @@ func NewLabelerFirehose(ctx context.Context) *LabelerFirehose {
 	}
 }
 
+// LastReceived is when the labeler last sent anything, or zero if it has
+// not yet.
+func (l *LabelerFirehose) LastReceived() time.Time {
+	last := l.lastReceived.Load()
+	if last == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, last)
+}
+
 func (l *LabelerFirehose) Ack(seq int64) {
 	l.s.Ack(seq)
+	metrics.StreamCursor.WithLabelValues("labeler").Set(float64(seq))
 }
 
 func (l *LabelerFirehose) proxyStream(sCh <-chan *SubscriberEvent) <-chan *LabelerEvent {
@@ -90,6 +105,10 @@ func (l *LabelerFirehose) proxyStream(sCh <-chan *SubscriberEvent) <-chan *Label
 				lEvt = &LabelerEvent{Error: err, Type: EvtKindError}
 			}
 
+			metrics.Events.WithLabelValues("labeler", lEvt.Type).Inc()
+			if lEvt.Error == nil {
+				l.lastReceived.Store(time.Now().UnixNano())
+			}
 			lCh <- lEvt
 
 			if seq != 0 {
@@ -121,6 +140,7 @@ func (l *LabelerFirehose) Stop() {
 }
 
 func (l *LabelerFirehose) Restart(ctx context.Context) (<-chan *LabelerEvent, error) {
+	metrics.StreamReconnects.WithLabelValues("labeler").Inc()
 	sCh, err := l.s.Restart(ctx)
 	if err != nil {
 		return nil, err
@@ -152,6 +172,9 @@ func (l *LabelerFirehose) processSubscriberEvent(sEvt *SubscriberEvent) *Labeler
 		if err := evt.UnmarshalCBOR(sEvt.Body); err != nil {
 			return &LabelerEvent{Error: fmt.Errorf("error unmarshalling #label: %w", err), Type: EvtKindError}
 		}
+		if len(evt.Labels) > 0 {
+			metrics.ObserveLag("labeler", evt.Labels[len(evt.Labels)-1].Cts)
+		}
 		return &LabelerEvent{Labels: &evt, Seq: evt.Seq, Type: EvtKindLabel}
 	}
 
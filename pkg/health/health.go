@@ -0,0 +1,188 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+var CheckTimeout = 5 * time.Second
+
+type Result struct {
+	Name     string `json:"name"`
+	Ok       bool   `json:"ok"`
+	Optional bool   `json:"optional,omitempty"`
+	Message  string `json:"message,omitempty"`
+}
+
+type Response struct {
+	Ok     bool      `json:"ok"`
+	Checks []*Result `json:"checks"`
+}
+
+// Check is a named probe. Run returns a short description of what it saw,
+// or an error when the check fails. Optional checks are reported but don't
+// fail the response.
+type Check struct {
+	Name     string
+	Run      func(ctx context.Context) (string, error)
+	Optional bool
+}
+
+// Optional marks a check as reported only.
+func Optional(check *Check) *Check {
+	check.Optional = true
+	return check
+}
+
+// Config holds the thresholds checks are measured against.
+type Config struct {
+	DiskPath          string
+	MinDiskFree       float64
+	MaxFirehoseLag    time.Duration
+	MaxLabelerSilence time.Duration
+	MaxLoopStall      time.Duration
+}
+
+func NewConfig(ctx context.Context) *Config {
+	diskPath, _ := ctx.Value("db-dir").(string)
+	minDiskFree, _ := ctx.Value("health-min-disk-free").(float64)
+	maxFirehoseLag, _ := ctx.Value("health-max-firehose-lag").(time.Duration)
+	maxLabelerSilence, _ := ctx.Value("health-max-labeler-silence").(time.Duration)
+	maxLoopStall, _ := ctx.Value("health-max-loop-stall").(time.Duration)
+
+	return &Config{
+		DiskPath:          diskPath,
+		MinDiskFree:       minDiskFree,
+		MaxFirehoseLag:    maxFirehoseLag,
+		MaxLabelerSilence: maxLabelerSilence,
+		MaxLoopStall:      maxLoopStall,
+	}
+}
+
+func Run(ctx context.Context, checks ...*Check) *Response {
+	ctx, cancel := context.WithTimeout(ctx, CheckTimeout)
+	defer cancel()
+
+	response := &Response{Ok: true, Checks: make([]*Result, 0, len(checks))}
+	for _, check := range checks {
+		result := &Result{Name: check.Name, Ok: true, Optional: check.Optional}
+		message, err := check.Run(ctx)
+		if err != nil {
+			result.Ok = false
+			result.Message = err.Error()
+			if !check.Optional {
+				response.Ok = false
+			}
+		} else {
+			result.Message = message
+		}
+		response.Checks = append(response.Checks, result)
+	}
+
+	return response
+}
+
+// Handler serves the checks as JSON, with a 503 if any of them fail.
+func Handler(checks ...*Check) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		response := Run(r.Context(), checks...)
+
+		b, err := json.Marshal(response)
+		if err != nil {
+			w.WriteHeader(500)
+			return
+		}
+
+		status := 200
+		if !response.Ok {
+			status = 503
+		}
+
+		w.Header().Add("cache-control", "no-cache")
+		w.Header().Add("content-type", "application/json; charset=utf-8")
+		w.WriteHeader(status)
+		w.Write(b)
+	}
+}
+
+// Heartbeat records when something last happened.
+type Heartbeat struct {
+	last atomic.Int64
+}
+
+func (h *Heartbeat) Beat() {
+	h.BeatAt(time.Now())
+}
+
+func (h *Heartbeat) BeatAt(t time.Time) {
+	h.last.Store(t.UnixNano())
+}
+
+// Since adapts a time getter for Fresh.
+func Since(last func() time.Time) func(ctx context.Context) (time.Time, error) {
+	return func(ctx context.Context) (time.Time, error) {
+		return last(), nil
+	}
+}
+
+func (h *Heartbeat) Last() time.Time {
+	last := h.last.Load()
+	if last == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, last)
+}
+
+// Fresh fails when last is older than max, or has never happened.
+func Fresh(name string, max time.Duration, last func(ctx context.Context) (time.Time, error)) *Check {
+	return &Check{
+		Name: name,
+		Run: func(ctx context.Context) (string, error) {
+			t, err := last(ctx)
+			if err != nil {
+				return "", err
+			} else if t.IsZero() {
+				return "", fmt.Errorf("nothing seen yet")
+			}
+
+			age := time.Since(t).Truncate(time.Millisecond)
+			if (max > 0) && (age > max) {
+				return "", fmt.Errorf("last seen %s ago, over %s", age, max)
+			}
+			return fmt.Sprintf("last seen %s ago", age), nil
+		},
+	}
+}
+
+func DiskFree(path string, minPercent float64) *Check {
+	return &Check{
+		Name: "disk",
+		Run: func(ctx context.Context) (string, error) {
+			stat := syscall.Statfs_t{}
+			err := syscall.Statfs(path, &stat)
+			if err != nil {
+				return "", err
+			}
+
+			free := 100 * float64(stat.Bavail) / float64(stat.Blocks)
+			if free < minPercent {
+				return "", fmt.Errorf("%s is %.2f%% free, under %.2f%%", path, free, minPercent)
+			}
+			return fmt.Sprintf("%s is %.2f%% free", path, free), nil
+		},
+	}
+}
+
+func Func(name string, f func(ctx context.Context) error) *Check {
+	return &Check{
+		Name: name,
+		Run: func(ctx context.Context) (string, error) {
+			return "", f(ctx)
+		},
+	}
+}
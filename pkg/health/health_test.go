@@ -0,0 +1,81 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandler(t *testing.T) {
+	ok := Func("ok", func(ctx context.Context) error { return nil })
+	broken := Func("broken", func(ctx context.Context) error { return fmt.Errorf("broken") })
+
+	w := httptest.NewRecorder()
+	Handler(ok)(w, httptest.NewRequest("GET", "/readyz", nil))
+	assert.Equal(t, 200, w.Code)
+
+	w = httptest.NewRecorder()
+	Handler(ok, broken)(w, httptest.NewRequest("GET", "/readyz", nil))
+	assert.Equal(t, 503, w.Code)
+
+	response := &Response{}
+	err := json.Unmarshal(w.Body.Bytes(), response)
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(
+		t,
+		&Response{
+			Ok: false,
+			Checks: []*Result{
+				{Name: "ok", Ok: true},
+				{Name: "broken", Ok: false, Message: "broken"},
+			},
+		},
+		response,
+	)
+
+	w = httptest.NewRecorder()
+	Handler(ok, Optional(broken))(w, httptest.NewRequest("GET", "/readyz", nil))
+	assert.Equal(t, 200, w.Code)
+
+	response = &Response{}
+	err = json.Unmarshal(w.Body.Bytes(), response)
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(t, &Result{Name: "broken", Ok: false, Optional: true, Message: "broken"}, response.Checks[1])
+}
+
+func TestFresh(t *testing.T) {
+	beat := &Heartbeat{}
+	check := Fresh("loop", time.Minute, Since(beat.Last))
+
+	_, err := check.Run(context.Background())
+	assert.ErrorContains(t, err, "nothing seen yet")
+
+	beat.BeatAt(time.Now().Add(-2 * time.Minute))
+	_, err = check.Run(context.Background())
+	assert.ErrorContains(t, err, "over 1m0s")
+
+	beat.Beat()
+	_, err = check.Run(context.Background())
+	assert.NoError(t, err)
+}
+
+func TestDiskFree(t *testing.T) {
+	_, err := DiskFree(os.TempDir(), 0).Run(context.Background())
+	assert.NoError(t, err)
+
+	_, err = DiskFree(os.TempDir(), 101).Run(context.Background())
+	assert.ErrorContains(t, err, "under 101.00%")
+
+	_, err = DiskFree("/does/not/exist", 0).Run(context.Background())
+	assert.Error(t, err)
+}
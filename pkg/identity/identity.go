@@ -0,0 +1,440 @@
+package identity
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrNotFound = errors.New("identity not found")
+var ErrHandleMismatch = errors.New("handle does not match did document")
+
+const InvalidHandle = "handle.invalid"
+
+var DefaultPlcHost = "https://plc.directory"
+
+type Service struct {
+	Id              string `json:"id"`
+	Type            string `json:"type"`
+	ServiceEndpoint string `json:"serviceEndpoint"`
+}
+
+type VerificationMethod struct {
+	Id                 string `json:"id"`
+	Type               string `json:"type"`
+	Controller         string `json:"controller"`
+	PublicKeyMultibase string `json:"publicKeyMultibase"`
+}
+
+type Document struct {
+	Id                  string                `json:"id"`
+	AlsoKnownAs         []string              `json:"alsoKnownAs"`
+	Services            []*Service            `json:"service"`
+	VerificationMethods []*VerificationMethod `json:"verificationMethod"`
+}
+
+// Handle is the first at:// alias in the document, which still has to be
+// verified against the handle's own did record before it can be trusted.
+func (d *Document) Handle() string {
+	for _, aka := range d.AlsoKnownAs {
+		if strings.HasPrefix(aka, "at://") {
+			return aka[len("at://"):]
+		}
+	}
+	return ""
+}
+
+// Pds is the #atproto_pds service endpoint, or the only service when the
+// document doesn't name one.
+func (d *Document) Pds() (string, error) {
+	for _, service := range d.Services {
+		if strings.HasSuffix(service.Id, "#atproto_pds") {
+			return service.ServiceEndpoint, nil
+		}
+	}
+	if len(d.Services) == 1 {
+		return d.Services[0].ServiceEndpoint, nil
+	}
+	return "", fmt.Errorf("could not find pds service in did document for %s", d.Id)
+}
+
+// VerificationMethod finds a key by its fragment, ie "atproto_label".
+func (d *Document) VerificationMethod(fragment string) *VerificationMethod {
+	for _, method := range d.VerificationMethods {
+		if strings.HasSuffix(method.Id, "#"+fragment) {
+			return method
+		}
+	}
+	return nil
+}
+
+type Config struct {
+	PlcHost     string
+	Timeout     time.Duration
+	TTL         time.Duration
+	NegativeTTL time.Duration
+	MaxEntries  int
+}
+
+func NewConfig(ctx context.Context) *Config {
+	plcHost, _ := ctx.Value("plc-host").(string)
+	if plcHost == "" {
+		plcHost = DefaultPlcHost
+	}
+
+	timeout, ok := ctx.Value("identity-timeout").(time.Duration)
+	if !ok {
+		timeout = 10 * time.Second
+	}
+
+	ttl, ok := ctx.Value("identity-cache-ttl").(time.Duration)
+	if !ok {
+		ttl = 1 * time.Hour
+	}
+
+	negativeTtl, ok := ctx.Value("identity-negative-ttl").(time.Duration)
+	if !ok {
+		negativeTtl = 1 * time.Minute
+	}
+
+	return &Config{
+		PlcHost:     strings.TrimSuffix(plcHost, "/"),
+		Timeout:     timeout,
+		TTL:         ttl,
+		NegativeTTL: negativeTtl,
+		MaxEntries:  100000,
+	}
+}
+
+type cacheEntry struct {
+	value   any
+	err     error
+	expires time.Time
+}
+
+// Resolver resolves handles to dids and dids to documents, remembering
+// answers for TTL and failures for NegativeTTL.
+type Resolver struct {
+	Config *Config
+
+	client    *http.Client
+	lookupTXT func(ctx context.Context, name string) ([]string, error)
+	wellKnown func(handle string) string
+	now       func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*cacheEntry
+}
+
+func NewResolver(config *Config) *Resolver {
+	dns := &net.Resolver{}
+	return &Resolver{
+		Config:    config,
+		client:    &http.Client{Timeout: config.Timeout},
+		lookupTXT: dns.LookupTXT,
+		wellKnown: func(handle string) string {
+			return fmt.Sprintf("https://%s/.well-known/atproto-did", handle)
+		},
+		now:     time.Now,
+		entries: make(map[string]*cacheEntry),
+	}
+}
+
+// Resolve returns the did for a handle, passing dids straight through.
+func (r *Resolver) Resolve(ctx context.Context, handleOrDid string) (string, error) {
+	if strings.HasPrefix(handleOrDid, "did:") {
+		return handleOrDid, nil
+	}
+	return r.ResolveHandle(ctx, handleOrDid)
+}
+
+// ResolveHandle looks up the did a handle claims, from its _atproto TXT
+// record or its /.well-known/atproto-did. The claim isn't verified, use
+// VerifyHandle for that.
+func (r *Resolver) ResolveHandle(ctx context.Context, handle string) (string, error) {
+	handle = strings.ToLower(strings.TrimPrefix(handle, "@"))
+	if handle == "" {
+		return "", fmt.Errorf("%w: empty handle", ErrNotFound)
+	}
+
+	value, err := r.cached(ctx, "handle:"+handle, func(ctx context.Context) (any, error) {
+		return r.resolveHandle(ctx, handle)
+	})
+	if err != nil {
+		return "", err
+	}
+	return value.(string), nil
+}
+
+func (r *Resolver) resolveHandle(ctx context.Context, handle string) (string, error) {
+	if strings.HasSuffix(handle, ".bsky.social") {
+		return r.resolveHandleByHttps(ctx, handle)
+	}
+
+	did, dnsErr := r.resolveHandleByDns(ctx, handle)
+	if dnsErr == nil {
+		return did, nil
+	}
+
+	did, httpsErr := r.resolveHandleByHttps(ctx, handle)
+	if httpsErr == nil {
+		return did, nil
+	}
+
+	if errors.Is(dnsErr, ErrNotFound) && errors.Is(httpsErr, ErrNotFound) {
+		return "", fmt.Errorf("%w: could not resolve %s: %s; %s", ErrNotFound, handle, dnsErr.Error(), httpsErr.Error())
+	}
+	return "", fmt.Errorf("could not resolve %s: %w; %s", handle, dnsErr, httpsErr.Error())
+}
+
+func (r *Resolver) resolveHandleByDns(ctx context.Context, handle string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.Config.Timeout)
+	defer cancel()
+
+	domain := fmt.Sprintf("_atproto.%s", handle)
+	records, err := r.lookupTXT(ctx, domain)
+	if err != nil {
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			return "", fmt.Errorf("%w: no txt record for %s", ErrNotFound, domain)
+		}
+		return "", fmt.Errorf("could not lookup txt record for %s: %w", domain, err)
+	}
+
+	for _, record := range records {
+		if strings.HasPrefix(record, "did=did:") {
+			return record[len("did="):], nil
+		}
+	}
+
+	return "", fmt.Errorf("%w: no did record for %s, found %s", ErrNotFound, domain, strings.Join(records, ", "))
+}
+
+func (r *Resolver) resolveHandleByHttps(ctx context.Context, handle string) (string, error) {
+	body, err := r.get(ctx, r.wellKnown(handle), 1<<10)
+	if err != nil {
+		return "", err
+	}
+
+	did := strings.TrimSpace(string(body))
+	if !strings.HasPrefix(did, "did:") {
+		return "", fmt.Errorf("%w: %s serves %q which is not a did", ErrNotFound, r.wellKnown(handle), did)
+	}
+	return did, nil
+}
+
+// ResolveDid fetches the document for a did:plc from the plc directory or a
+// did:web from its host.
+func (r *Resolver) ResolveDid(ctx context.Context, did string) (*Document, error) {
+	value, err := r.cached(ctx, "did:"+did, func(ctx context.Context) (any, error) {
+		return r.resolveDid(ctx, did)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.(*Document), nil
+}
+
+func (r *Resolver) resolveDid(ctx context.Context, did string) (*Document, error) {
+	var docUrl string
+	switch {
+	case strings.HasPrefix(did, "did:plc:"):
+		docUrl = fmt.Sprintf("%s/%s", r.Config.PlcHost, did)
+	case strings.HasPrefix(did, "did:web:"):
+		host, err := url.PathUnescape(did[len("did:web:"):])
+		if err != nil {
+			return nil, fmt.Errorf("could not parse host from %s: %w", did, err)
+		}
+		if (host == "") || strings.ContainsAny(host, "/@?#") {
+			return nil, fmt.Errorf("%s does not have a usable host", did)
+		}
+		docUrl = fmt.Sprintf("https://%s/.well-known/did.json", host)
+	default:
+		return nil, fmt.Errorf("unsupported did method for %s", did)
+	}
+
+	body, err := r.get(ctx, docUrl, 1<<20)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := &Document{}
+	if err := json.Unmarshal(body, doc); err != nil {
+		return nil, fmt.Errorf("error parsing did document for %s: %w", did, err)
+	}
+	if doc.Id != did {
+		return nil, fmt.Errorf("did document from %s is for %s", docUrl, doc.Id)
+	}
+
+	return doc, nil
+}
+
+// VerifyHandle resolves a handle to a did and checks that the did document
+// claims the handle back.
+func (r *Resolver) VerifyHandle(ctx context.Context, handle string) (string, error) {
+	did, err := r.ResolveHandle(ctx, handle)
+	if err != nil {
+		return "", err
+	}
+
+	doc, err := r.ResolveDid(ctx, did)
+	if err != nil {
+		return "", err
+	}
+
+	handle = strings.ToLower(strings.TrimPrefix(handle, "@"))
+	if strings.ToLower(doc.Handle()) != handle {
+		return "", fmt.Errorf("%w: %s resolves to %s which claims %q", ErrHandleMismatch, handle, did, doc.Handle())
+	}
+
+	return did, nil
+}
+
+// Handle returns the verified handle for a did, or handle.invalid when the
+// document's handle doesn't resolve back to it.
+func (r *Resolver) Handle(ctx context.Context, did string) (string, error) {
+	doc, err := r.ResolveDid(ctx, did)
+	if err != nil {
+		return "", err
+	}
+
+	handle := doc.Handle()
+	if handle == "" {
+		return InvalidHandle, nil
+	}
+
+	resolved, err := r.ResolveHandle(ctx, handle)
+	if (err != nil) || (resolved != did) {
+		return InvalidHandle, nil
+	}
+	return strings.ToLower(handle), nil
+}
+
+type plcAuditEntry struct {
+	Did       string `json:"did"`
+	CreatedAt string `json:"createdAt"`
+}
+
+// PlcCreatedAt returns when a did:plc was first registered as a unix
+// timestamp, or 0 when the plc directory doesn't know it.
+func (r *Resolver) PlcCreatedAt(ctx context.Context, did string) (int64, error) {
+	value, err := r.cached(ctx, "created:"+did, func(ctx context.Context) (any, error) {
+		body, err := r.get(ctx, fmt.Sprintf("%s/%s/log/audit", r.Config.PlcHost, did), 1<<22)
+		if errors.Is(err, ErrNotFound) {
+			return int64(0), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		entries := make([]*plcAuditEntry, 0)
+		if err := json.Unmarshal(body, &entries); err != nil {
+			return nil, fmt.Errorf("error parsing plc audit log for %s: %w", did, err)
+		}
+		if len(entries) == 0 {
+			return int64(0), nil
+		}
+
+		createdAt := entries[0].CreatedAt
+		t, err := time.Parse(time.RFC3339, createdAt)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing createdAt %s for plc did %s: %w", createdAt, did, err)
+		}
+		return t.UTC().Unix(), nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return value.(int64), nil
+}
+
+func (r *Resolver) get(ctx context.Context, url string, limit int64) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.Config.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if (resp.StatusCode == 404) || (resp.StatusCode == 410) {
+		return nil, fmt.Errorf("%w: %s returned %s", ErrNotFound, url, resp.Status)
+	}
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+
+	return io.ReadAll(io.LimitReader(resp.Body, limit))
+}
+
+// cached runs lookup once per TTL for a key. Failures are remembered for
+// the shorter NegativeTTL, unless the caller gave up on the request.
+func (r *Resolver) cached(ctx context.Context, key string, lookup func(ctx context.Context) (any, error)) (any, error) {
+	r.mu.Lock()
+	entry := r.entries[key]
+	if (entry != nil) && r.now().Before(entry.expires) {
+		r.mu.Unlock()
+		return entry.value, entry.err
+	}
+	r.mu.Unlock()
+
+	value, err := lookup(ctx)
+	if ctx.Err() != nil {
+		return value, err
+	}
+
+	ttl := r.Config.TTL
+	if err != nil {
+		ttl = r.Config.NegativeTTL
+	}
+	if ttl <= 0 {
+		return value, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if (r.Config.MaxEntries > 0) && (len(r.entries) >= r.Config.MaxEntries) {
+		r.evictLocked()
+	}
+	r.entries[key] = &cacheEntry{value: value, err: err, expires: r.now().Add(ttl)}
+
+	return value, err
+}
+
+func (r *Resolver) evictLocked() {
+	now := r.now()
+	for key, entry := range r.entries {
+		if !now.Before(entry.expires) {
+			delete(r.entries, key)
+		}
+	}
+
+	target := r.Config.MaxEntries - (r.Config.MaxEntries / 10) - 1
+	for key := range r.entries {
+		if len(r.entries) <= target {
+			break
+		}
+		delete(r.entries, key)
+	}
+}
+
+// Purge forgets a did's document, for callers that need the current one.
+func (r *Resolver) Purge(did string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.entries, "did:"+did)
+}
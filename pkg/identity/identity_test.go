@@ -0,0 +1,178 @@
+package identity
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveHandle(t *testing.T) {
+	d, cleanup := NewTestDirectory()
+	defer cleanup()
+
+	ctx := context.Background()
+	d.AddTxt("alice.example.com", "did:plc:alice")
+	d.AddWellKnown("bob.example.com", "did:plc:bob")
+
+	did, err := d.ResolveHandle(ctx, "@Alice.example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "did:plc:alice", did)
+
+	did, err = d.ResolveHandle(ctx, "bob.example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "did:plc:bob", did)
+
+	did, err = d.Resolve(ctx, "did:plc:carol")
+	assert.NoError(t, err)
+	assert.Equal(t, "did:plc:carol", did)
+
+	_, err = d.ResolveHandle(ctx, "nobody.example.com")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestResolveDid(t *testing.T) {
+	d, cleanup := NewTestDirectory()
+	defer cleanup()
+
+	ctx := context.Background()
+	d.AddAccount("did:plc:alice", "alice.example.com", time.Now())
+
+	doc, err := d.ResolveDid(ctx, "did:plc:alice")
+	assert.NoError(t, err)
+	assert.Equal(t, "alice.example.com", doc.Handle())
+
+	pds, err := doc.Pds()
+	assert.NoError(t, err)
+	assert.Equal(t, "https://pds.example.com", pds)
+
+	_, err = d.ResolveDid(ctx, "did:plc:nobody")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	_, err = d.ResolveDid(ctx, "did:example:alice")
+	assert.ErrorContains(t, err, "unsupported did method")
+}
+
+func TestResolveDidWeb(t *testing.T) {
+	var did string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/.well-known/did.json" {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(&Document{Id: did, AlsoKnownAs: []string{"at://feeds.example.com"}})
+	}))
+	defer server.Close()
+
+	u, _ := url.Parse(server.URL)
+	did = "did:web:" + strings.ReplaceAll(u.Host, ":", "%3A")
+
+	r := NewResolver(&Config{Timeout: time.Second, TTL: time.Hour})
+	r.client = server.Client()
+
+	doc, err := r.ResolveDid(context.Background(), did)
+	assert.NoError(t, err)
+	assert.Equal(t, "feeds.example.com", doc.Handle())
+
+	_, err = r.ResolveDid(context.Background(), "did:web:example.com%2Fevil")
+	assert.ErrorContains(t, err, "does not have a usable host")
+}
+
+func TestVerifyHandle(t *testing.T) {
+	d, cleanup := NewTestDirectory()
+	defer cleanup()
+
+	ctx := context.Background()
+	d.AddAccount("did:plc:alice", "alice.example.com", time.Now())
+	d.AddAccount("did:plc:mallory", "mallory.example.com", time.Now())
+	d.AddTxt("impostor.example.com", "did:plc:alice")
+
+	did, err := d.VerifyHandle(ctx, "alice.example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "did:plc:alice", did)
+
+	_, err = d.VerifyHandle(ctx, "impostor.example.com")
+	assert.ErrorIs(t, err, ErrHandleMismatch)
+
+	handle, err := d.Handle(ctx, "did:plc:alice")
+	assert.NoError(t, err)
+	assert.Equal(t, "alice.example.com", handle)
+
+	d.AddTxt("mallory.example.com", "did:plc:alice")
+	d.Advance(2 * time.Hour)
+	handle, err = d.Handle(ctx, "did:plc:mallory")
+	assert.NoError(t, err)
+	assert.Equal(t, InvalidHandle, handle)
+}
+
+func TestResolverCache(t *testing.T) {
+	d, cleanup := NewTestDirectory()
+	defer cleanup()
+
+	ctx := context.Background()
+	d.AddAccount("did:plc:alice", "alice.example.com", time.Now())
+
+	for i := 0; i < 3; i++ {
+		_, err := d.ResolveDid(ctx, "did:plc:alice")
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, int64(1), d.Requests.Load())
+
+	for i := 0; i < 3; i++ {
+		_, err := d.ResolveDid(ctx, "did:plc:bob")
+		assert.ErrorIs(t, err, ErrNotFound)
+	}
+	assert.Equal(t, int64(2), d.Requests.Load())
+
+	d.AddAccount("did:plc:bob", "bob.example.com", time.Now())
+	d.Advance(2 * time.Minute)
+
+	_, err := d.ResolveDid(ctx, "did:plc:bob")
+	assert.NoError(t, err)
+	_, err = d.ResolveDid(ctx, "did:plc:alice")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), d.Requests.Load())
+
+	d.Advance(2 * time.Hour)
+	_, err = d.ResolveDid(ctx, "did:plc:alice")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), d.Requests.Load())
+}
+
+func TestResolverCanceledIsNotCached(t *testing.T) {
+	d, cleanup := NewTestDirectory()
+	defer cleanup()
+
+	d.AddAccount("did:plc:alice", "alice.example.com", time.Now())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := d.ResolveDid(ctx, "did:plc:alice")
+	assert.Error(t, err)
+
+	_, err = d.ResolveDid(context.Background(), "did:plc:alice")
+	assert.NoError(t, err)
+}
+
+func TestPlcCreatedAt(t *testing.T) {
+	d, cleanup := NewTestDirectory()
+	defer cleanup()
+
+	ctx := context.Background()
+	createdAt := time.Date(2023, 4, 1, 12, 0, 0, 0, time.UTC)
+	d.AddAccount("did:plc:alice", "alice.example.com", createdAt)
+
+	ts, err := d.PlcCreatedAt(ctx, "did:plc:alice")
+	assert.NoError(t, err)
+	assert.Equal(t, createdAt.Unix(), ts)
+
+	ts, err = d.PlcCreatedAt(ctx, "did:plc:nobody")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), ts)
+}
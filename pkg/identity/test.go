@@ -0,0 +1,145 @@
+package identity
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// TestDirectory is a local stand-in for the plc directory, dns and handle
+// hosts, with a resolver pointed at it.
+type TestDirectory struct {
+	*Resolver
+	Server   *httptest.Server
+	Requests atomic.Int64
+
+	mu        sync.Mutex
+	documents map[string]*Document
+	createdAt map[string]time.Time
+	txt       map[string]string
+	wellKnown map[string]string
+}
+
+func NewTestDirectory() (*TestDirectory, func()) {
+	d := &TestDirectory{
+		documents: make(map[string]*Document),
+		createdAt: make(map[string]time.Time),
+		txt:       make(map[string]string),
+		wellKnown: make(map[string]string),
+	}
+	d.Server = httptest.NewServer(http.HandlerFunc(d.serve))
+
+	d.Resolver = NewResolver(&Config{
+		PlcHost:     d.Server.URL,
+		Timeout:     time.Second,
+		TTL:         time.Hour,
+		NegativeTTL: time.Minute,
+		MaxEntries:  1000,
+	})
+	d.Resolver.lookupTXT = d.lookupTXT
+	d.Resolver.wellKnown = func(handle string) string {
+		return fmt.Sprintf("%s/handle/%s", d.Server.URL, handle)
+	}
+
+	return d, d.Server.Close
+}
+
+// AddAccount registers a did:plc whose document and dns record both claim
+// the handle.
+func (d *TestDirectory) AddAccount(did string, handle string, createdAt time.Time) *Document {
+	doc := &Document{
+		Id:          did,
+		AlsoKnownAs: []string{"at://" + handle},
+		Services: []*Service{
+			{Id: "#atproto_pds", Type: "AtprotoPersonalDataServer", ServiceEndpoint: "https://pds.example.com"},
+		},
+	}
+
+	d.AddDocument(doc)
+	d.AddTxt(handle, did)
+
+	d.mu.Lock()
+	d.createdAt[did] = createdAt
+	d.mu.Unlock()
+
+	return doc
+}
+
+func (d *TestDirectory) AddDocument(doc *Document) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.documents[doc.Id] = doc
+}
+
+func (d *TestDirectory) AddTxt(handle string, did string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.txt[handle] = did
+}
+
+func (d *TestDirectory) AddWellKnown(handle string, did string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.wellKnown[handle] = did
+}
+
+// Advance moves the resolver's clock forward, to expire cached answers.
+func (d *TestDirectory) Advance(by time.Duration) {
+	now := d.Resolver.now()
+	d.Resolver.now = func() time.Time { return now.Add(by) }
+}
+
+func (d *TestDirectory) lookupTXT(ctx context.Context, name string) ([]string, error) {
+	d.Requests.Add(1)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	did, ok := d.txt[strings.TrimPrefix(name, "_atproto.")]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+	return []string{"did=" + did}, nil
+}
+
+func (d *TestDirectory) serve(w http.ResponseWriter, r *http.Request) {
+	d.Requests.Add(1)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	if handle, ok := strings.CutPrefix(path, "handle/"); ok {
+		did, ok := d.wellKnown[handle]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(did))
+		return
+	}
+
+	if did, ok := strings.CutSuffix(path, "/log/audit"); ok {
+		createdAt, ok := d.createdAt[did]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode([]*plcAuditEntry{{Did: did, CreatedAt: createdAt.UTC().Format(time.RFC3339)}})
+		return
+	}
+
+	doc, ok := d.documents[path]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	json.NewEncoder(w).Encode(doc)
+}
@@ -13,7 +13,3 @@ var CeuSemLimitesRegex = regexp.MustCompile(norm.NFC.String(fmt.Sprintf(`(?is).*
 	`(#(ceu|céu)semlimites\b)`,
 	`(\b(ceu|céu)\s+sem\s+limites\s+do\s+@minaj.com.br\b)`,
 }, "|"))))
-
-func IsCeuSemLimites(text string) bool {
-	return CeuSemLimitesRegex.MatchString(norm.NFC.String(text))
-}
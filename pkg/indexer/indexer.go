@@ -4,7 +4,6 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -16,6 +15,9 @@ import (
 	"github.com/flicknow/go-bluesky-bot/pkg/cmd"
 	"github.com/flicknow/go-bluesky-bot/pkg/dbx"
 	"github.com/flicknow/go-bluesky-bot/pkg/firehose"
+	"github.com/flicknow/go-bluesky-bot/pkg/identity"
+	"github.com/flicknow/go-bluesky-bot/pkg/labeler"
+	"github.com/flicknow/go-bluesky-bot/pkg/rules"
 	"github.com/flicknow/go-bluesky-bot/pkg/ticker"
 	"github.com/flicknow/go-bluesky-bot/pkg/utils"
 )
@@ -26,8 +28,9 @@ var TickBot = "did:plc:kwmcvt4maab47n7dgvepg4tr"
 var REM = "did:plc:3nodfbwjlsd77ckgrodawvpv"
 
 type Indexer struct {
-	Client client.Client
-	Db     *dbx.DBx
+	Client   client.Client
+	Db       *dbx.DBx
+	Identity *identity.Resolver
 
 	clock                    clock.Clock
 	debug                    bool
@@ -40,6 +43,8 @@ type Indexer struct {
 	customLabelerTicker      *ticker.Ticker
 	labelTicker              *ticker.Ticker
 	prunerTicker             *ticker.Ticker
+	rules                    *rules.Engine
+	Milestones               *labeler.Milestones
 	wg                       *sync.WaitGroup
 }
 
@@ -76,8 +81,27 @@ func NewIndexer(ctx context.Context, client client.Client) (*Indexer, error) {
 		prunerTickMinutes = 1
 	}
 
+	rulesPath, _ := ctx.Value("rules").(string)
+	engine, err := rules.NewEngine(rulesPath, DefaultRules)
+	if err != nil {
+		return nil, err
+	}
+
+	milestones, err := labeler.NewMilestones(labeler.DefaultMilestones)
+	if err != nil {
+		return nil, err
+	}
+	milestonesPath, _ := ctx.Value("milestones").(string)
+	if milestonesPath != "" {
+		milestones, err = labeler.LoadMilestones(milestonesPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	indexer := &Indexer{
 		Client:                   client,
+		Identity:                 identity.NewResolver(identity.NewConfig(ctx)),
 		clock:                    clk,
 		debug:                    cmd.DebuggingEnabled(ctx, "indexer"),
 		keepSeconds:              keepDays * 24 * 60 * 60,
@@ -86,14 +110,42 @@ func NewIndexer(ctx context.Context, client client.Client) (*Indexer, error) {
 		labelTickMinutes:         labelTickMinutes,
 		prunerTickMinutes:        prunerTickMinutes,
 		extendedIndexing:         extendedIndexing,
+		rules:                    engine,
+		Milestones:               milestones,
 		wg:                       &sync.WaitGroup{},
 	}
 
 	indexer.Db = dbx.NewDBx(ctx)
 
+	err = milestones.Validate(indexer.Db.LabelDefinitions)
+	if err != nil {
+		return nil, err
+	}
+
 	return indexer, nil
 }
 
+func (i *Indexer) ReloadRules() error {
+	if i.rules == nil {
+		return nil
+	}
+
+	err := i.rules.Reload()
+	if err != nil {
+		return err
+	}
+
+	log.Printf("reloaded %d label rules from %s\n", len(i.rules.RuleSet().Rules), i.rules.Path())
+	return nil
+}
+
+func (i *Indexer) evaluateRules(s *rules.Subject) *rules.Result {
+	if i.rules == nil {
+		return DefaultRules.Evaluate(s)
+	}
+	return i.rules.Evaluate(s)
+}
+
 func (i *Indexer) Start() {
 	if (i.customLabelerTicker == nil) && (i.customLabelerTickMinutes != 0) {
 		i.customLabelerTicker = ticker.NewTicker(time.Duration(i.customLabelerTickMinutes) * time.Minute)
@@ -447,7 +499,7 @@ func (i *Indexer) InitializeActorBirthdaysOnce(cutoff int64, chunk int) ([]*dbx.
 	}
 	for _, actor := range actors {
 		did := actor.Did
-		createdAt, err := LookupDidPlcCreatedAt(did)
+		createdAt, err := i.Identity.PlcCreatedAt(context.Background(), did)
 		if err != nil {
 			return nil, err
 		}
@@ -482,31 +534,15 @@ func (i *Indexer) runCustomLabelerOnce() {
 		},
 		func() error {
 			clock := i.clock
-			clock.NowString()
 
-			year, err := strconv.ParseInt(clock.NowString()[:4], 10, 64)
-			if err != nil {
-				return err
-			}
-
-			yearsSince := int(year - 2022)
-			for yearsSince > 0 {
-				err := i.Db.RecordBirthdayLabels(clock, yearsSince)
-				if err != nil {
-					return err
-				}
-
-				err = i.Db.RecordUnbirthdayLabels(clock, yearsSince)
+			for _, milestone := range i.Milestones.Milestones {
+				err := i.Db.RecordMilestoneLabels(clock, milestone)
 				if err != nil {
 					return err
 				}
-
-				yearsSince--
 			}
 
-			err = i.Db.PruneCustomLabels(clock)
-
-			return err
+			return i.Db.PruneCustomLabels(clock)
 		},
 	)
 	if len(errs) > 0 {
@@ -760,6 +796,8 @@ func (i *Indexer) Delete(uri string) error {
 		err = db.DeletePost(uri)
 	} else if strings.Contains(uri, "app.bsky.feed.repost") {
 		err = db.DeleteRepost(uri)
+	} else if strings.Contains(uri, "app.bsky.graph.block") {
+		err = db.DeleteBlock(uri)
 	} else if strings.Contains(uri, "app.bsky.graph.follow") {
 		//err = db.DeleteFollow(uri)
 	}
@@ -959,8 +997,12 @@ func (i *Indexer) Newskie(newskie string) error {
 }
 
 func (i *Indexer) Block(blockRef *firehose.BlockRef) error {
-	did := utils.ParseDid(blockRef.Ref.Uri)
-	if did != "" {
+	return i.Db.InsertBlock(blockRef)
+}
+
+// Tombstone stops indexing and serving an account that has been deleted.
+func (i *Indexer) Tombstone(did string) error {
+	if did == "" {
 		return nil
 	}
 
@@ -977,45 +1019,29 @@ func (i *Indexer) Post(postRef *firehose.PostRef) (*dbx.PostRow, error) {
 		return nil, nil
 	}
 
-	labels := make([]string, 0, 2)
-	if IsCeuSemLimites(postRef.Post.Text) {
-		labels = append(labels, "ceusemlimites")
-	}
-
 	actor, err := i.Db.Actors.FindOrCreateActor(did)
 	if err != nil {
 		log.Printf("error finding or creating actor for post %s: %+v\n", postRef.Ref.Uri, err)
 		return nil, err
 	}
 
-	if !actor.Blocked && (actor.CreatedAt != 0) && ((postRef.Post.Reply == nil) || (postRef.Post.Reply.Parent == nil)) {
-		if actor.Posts == 0 {
-			labels = append(labels, "newskie")
-
-			for _, lang := range postRef.Post.Langs {
-				labels = append(labels, fmt.Sprintf("newskie-%s", lang))
-			}
-		}
-
-		if (actor.LastPost > 0) && (actor.LastPost <= (i.clock.NowUnix() - (14 * 24 * 60 * 60))) {
-			labels = append(labels, "renewskie")
-		}
-	}
-
-	if (postRef.Post.Reply == nil) && isGm(postRef.Post) {
-		labels = append(labels, "gmgn")
-	}
-
-	if strings.Contains(postRef.Post.Text, "‼") && (actor.Did == REM) {
-		labels = append(labels, "rembangs")
-	}
+	result := i.evaluateRules(&rules.Subject{
+		Author: did,
+		Post:   postRef.Post,
+		Quote:  postRef.Quotes,
+		Actor: &rules.ActorStats{
+			Initialized: !actor.Blocked && (actor.CreatedAt != 0),
+			Posts:       actor.Posts,
+			LastPost:    actor.LastPost,
+		},
+		Now: i.clock.NowUnix(),
+	})
+	labels := result.Labels
 
-	selfLabels := postRef.Post.Labels
-	if (selfLabels != nil) && (selfLabels.LabelDefs_SelfLabels != nil) && (selfLabels.LabelDefs_SelfLabels.Values != nil) {
-		for _, value := range selfLabels.LabelDefs_SelfLabels.Values {
-			if (value != nil) && (value.Val != "") {
-				labels = append(labels, value.Val)
-			}
+	if len(result.AccountLabels) > 0 {
+		err := i.Db.InsertAccountLabels(actor, result.AccountLabels...)
+		if err != nil {
+			log.Printf("error inserting account labels %v for %s: %+v\n", result.AccountLabels, did, err)
 		}
 	}
 
@@ -3,6 +3,7 @@ package indexer
 import (
 	"context"
 	"sync"
+	"time"
 
 	"github.com/bluesky-social/indigo/api/atproto"
 	"github.com/bluesky-social/indigo/api/bsky"
@@ -11,6 +12,7 @@ import (
 	"github.com/flicknow/go-bluesky-bot/pkg/client"
 	"github.com/flicknow/go-bluesky-bot/pkg/clock"
 	"github.com/flicknow/go-bluesky-bot/pkg/dbx"
+	"github.com/flicknow/go-bluesky-bot/pkg/identity"
 	"github.com/flicknow/go-bluesky-bot/pkg/ticker"
 	"github.com/flicknow/go-bluesky-bot/pkg/utils"
 	"github.com/stretchr/testify/assert"
@@ -29,9 +31,15 @@ func NewTestIndexer(ctx context.Context, db *dbx.DBx) *Indexer {
 		cli = client.NewMockClient(ctx)
 	}
 
+	resolver, ok := ctx.Value("identity").(*identity.Resolver)
+	if !ok {
+		resolver = identity.NewResolver(identity.NewConfig(ctx))
+	}
+
 	indexer := &Indexer{
 		Client:           cli,
 		Db:               db,
+		Identity:         resolver,
 		clock:            clk,
 		extendedIndexing: true,
 		labelTicker:      ticker.NewTicker(0),
@@ -452,3 +460,43 @@ func TestInitNewskieActorInfo(t *testing.T) {
 
 	assert.Equal(t, i.clock.NowUnix(), newksie.CreatedAt)
 }
+
+func TestInitializeActorBirthdays(t *testing.T) {
+	d, cleanup := dbx.NewTestDBx()
+	defer cleanup()
+
+	directory, cleanupDirectory := identity.NewTestDirectory()
+	defer cleanupDirectory()
+
+	i := NewTestIndexer(context.WithValue(context.Background(), "identity", directory.Resolver), d.DBx)
+
+	born := time.Date(2023, 4, 1, 12, 0, 0, 0, time.UTC)
+	actor := d.CreateActor()
+	directory.AddAccount(actor.Did, "alice.example.com", born)
+	missing := d.CreateActor()
+
+	actors, err := i.InitializeActorBirthdaysOnce(0, 10)
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(t, 2, len(actors))
+
+	remaining, err := d.Actors.SelectActorsWithoutBirthdays(0, 10)
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(t, 0, len(remaining))
+
+	row := &dbx.ActorRow{}
+	err = d.Actors.Get(row, "SELECT * FROM actors WHERE did = ?", actor.Did)
+	if err != nil {
+		panic(err)
+	}
+	assert.Equal(t, born.Unix(), row.Birthday)
+
+	err = d.Actors.Get(row, "SELECT * FROM actors WHERE did = ?", missing.Did)
+	if err != nil {
+		panic(err)
+	}
+	assert.True(t, row.Blocked)
+}
@@ -0,0 +1,82 @@
+package indexer
+
+import (
+	"regexp"
+	"time"
+
+	"github.com/flicknow/go-bluesky-bot/pkg/rules"
+)
+
+var BskyAppLinkRegex = regexp.MustCompile(`/bsky\.app/`)
+var RemBangsRegex = regexp.MustCompile(`‼`)
+
+var DefaultRules = mustCompileRules(&rules.RuleSet{
+	Rules: []*rules.Rule{
+		{
+			Name:   "ceusemlimites",
+			Labels: []string{"ceusemlimites"},
+			Match:  &rules.Condition{Text: []string{CeuSemLimitesRegex.String()}},
+		},
+		{
+			Name:   "newskie",
+			Labels: []string{"newskie", "newskie-" + rules.LangTemplate},
+			Match: &rules.Condition{
+				Reply: rules.Bool(false),
+				Actor: &rules.ActorCondition{Initialized: rules.Bool(true), MaxPosts: rules.Int64(0)},
+			},
+		},
+		{
+			Name:   "renewskie",
+			Labels: []string{"renewskie"},
+			Match: &rules.Condition{
+				Reply: rules.Bool(false),
+				Actor: &rules.ActorCondition{
+					Initialized:       rules.Bool(true),
+					LastPostOlderThan: &rules.Duration{Duration: 14 * 24 * time.Hour},
+				},
+			},
+		},
+		{
+			Name:   "gmgn",
+			Labels: []string{"gmgn"},
+			Match: &rules.Condition{
+				Reply: rules.Bool(false),
+				Any: []*rules.Condition{
+					{
+						Text: []string{GoodMorningRegex.String()},
+						// if they have a link, and it's not a bsky link
+						// maybe it's a General Motors news article and we should skip it
+						Not: &rules.Condition{
+							Text:             []string{GeneralMotorsRegex.String()},
+							LinksNotMatching: []string{BskyAppLinkRegex.String()},
+						},
+					},
+					{
+						Text: []string{
+							GoodNightRegex.String(),
+							GoodAfternoonRegex.String(),
+							GoodEveningRegex.String(),
+						},
+					},
+				},
+			},
+		},
+		{
+			Name:   "rembangs",
+			Labels: []string{"rembangs"},
+			Match:  &rules.Condition{Authors: []string{REM}, Text: []string{RemBangsRegex.String()}},
+		},
+		{
+			Name:   "self-labels",
+			Labels: []string{rules.SelfLabelsTemplate},
+		},
+	},
+})
+
+func mustCompileRules(ruleset *rules.RuleSet) *rules.RuleSet {
+	err := ruleset.Compile("")
+	if err != nil {
+		panic(err)
+	}
+	return ruleset
+}
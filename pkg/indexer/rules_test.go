@@ -0,0 +1,38 @@
+package indexer
+
+import (
+	"testing"
+
+	"github.com/bluesky-social/indigo/api/bsky"
+	"github.com/flicknow/go-bluesky-bot/pkg/rules"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefaultRulesGmgn(t *testing.T) {
+	evaluate := func(post *bsky.FeedPost) []string {
+		return DefaultRules.Evaluate(&rules.Subject{Author: "did:plc:foo", Post: post, Actor: &rules.ActorStats{}}).Labels
+	}
+
+	assert.Equal(t, []string{"gmgn"}, evaluate(&bsky.FeedPost{Text: "gm everyone"}))
+	assert.Equal(t, []string{"gmgn"}, evaluate(&bsky.FeedPost{Text: "good night friends"}))
+	assert.Empty(t, evaluate(&bsky.FeedPost{Text: "hello"}))
+
+	news := &bsky.FeedPost{
+		Text: "GM recalls more trucks",
+		Facets: []*bsky.RichtextFacet{
+			{Features: []*bsky.RichtextFacet_Features_Elem{
+				{RichtextFacet_Link: &bsky.RichtextFacet_Link{Uri: "https://example.com/gm"}},
+			}},
+		},
+	}
+	assert.Empty(t, evaluate(news))
+
+	news.Facets[0].Features[0].RichtextFacet_Link.Uri = "https://bsky.app/profile/foo"
+	assert.Equal(t, []string{"gmgn"}, evaluate(news))
+}
+
+func TestDefaultRulesRemBangs(t *testing.T) {
+	post := &bsky.FeedPost{Text: "‼"}
+	assert.Equal(t, []string{"rembangs"}, DefaultRules.Evaluate(&rules.Subject{Author: REM, Post: post}).Labels)
+	assert.Empty(t, DefaultRules.Evaluate(&rules.Subject{Author: "did:plc:foo", Post: post}).Labels)
+}
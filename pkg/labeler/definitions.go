@@ -0,0 +1,174 @@
+package labeler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+
+	"github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/api/bsky"
+)
+
+var ErrUnknownLabel = errors.New("unknown label")
+
+var LabelValueRegex = regexp.MustCompile(`^[a-z-]+$`)
+
+var validSeverities = map[string]bool{"inform": true, "alert": true, "none": true}
+var validBlurs = map[string]bool{"content": true, "media": true, "none": true}
+var validDefaultSettings = map[string]bool{"ignore": true, "warn": true, "hide": true}
+
+type LabelLocale struct {
+	Lang        string `json:"lang"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type LabelDefinition struct {
+	Value          string         `json:"value"`
+	Locales        []*LabelLocale `json:"locales"`
+	Severity       string         `json:"severity"`
+	Blurs          string         `json:"blurs"`
+	DefaultSetting string         `json:"defaultSetting,omitempty"`
+	AdultOnly      bool           `json:"adultOnly,omitempty"`
+}
+
+type Definitions struct {
+	Labels  []*LabelDefinition `json:"labels"`
+	byValue map[string]*LabelDefinition
+}
+
+func LoadDefinitions(path string) (*Definitions, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading label definitions %s: %w", path, err)
+	}
+
+	return ParseDefinitions(b)
+}
+
+func ParseDefinitions(b []byte) (*Definitions, error) {
+	defs := &Definitions{}
+	err := json.Unmarshal(b, defs)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing label definitions: %w", err)
+	}
+
+	defs.byValue = make(map[string]*LabelDefinition)
+	for _, def := range defs.Labels {
+		err := def.validate()
+		if err != nil {
+			return nil, err
+		}
+
+		if defs.byValue[def.Value] != nil {
+			return nil, fmt.Errorf("label %s is defined more than once", def.Value)
+		}
+		defs.byValue[def.Value] = def
+	}
+
+	return defs, nil
+}
+
+func (def *LabelDefinition) validate() error {
+	if !LabelValueRegex.MatchString(def.Value) {
+		return fmt.Errorf("label value %q must only contain lowercase ascii and '-'", def.Value)
+	}
+	if !validSeverities[def.Severity] {
+		return fmt.Errorf("label %s has invalid severity %q", def.Value, def.Severity)
+	}
+	if !validBlurs[def.Blurs] {
+		return fmt.Errorf("label %s has invalid blurs %q", def.Value, def.Blurs)
+	}
+	if (def.DefaultSetting != "") && !validDefaultSettings[def.DefaultSetting] {
+		return fmt.Errorf("label %s has invalid defaultSetting %q", def.Value, def.DefaultSetting)
+	}
+	if len(def.Locales) == 0 {
+		return fmt.Errorf("label %s must have at least one locale", def.Value)
+	}
+	for _, locale := range def.Locales {
+		if (locale == nil) || (locale.Lang == "") || (locale.Name == "") {
+			return fmt.Errorf("label %s has a locale without a lang or name", def.Value)
+		}
+	}
+
+	return nil
+}
+
+func (defs *Definitions) Find(val string) *LabelDefinition {
+	if defs == nil {
+		return nil
+	}
+
+	return defs.byValue[val]
+}
+
+func (defs *Definitions) Validate(vals ...string) error {
+	if defs == nil {
+		return nil
+	}
+
+	for _, val := range vals {
+		if defs.byValue[val] == nil {
+			return fmt.Errorf("%w: label %s is not defined in the label definitions", ErrUnknownLabel, val)
+		}
+	}
+
+	return nil
+}
+
+func (defs *Definitions) Values() []string {
+	vals := make([]string, 0, len(defs.Labels))
+	for _, def := range defs.Labels {
+		vals = append(vals, def.Value)
+	}
+	return vals
+}
+
+func (def *LabelDefinition) LabelValueDefinition() *atproto.LabelDefs_LabelValueDefinition {
+	locales := make([]*atproto.LabelDefs_LabelValueDefinitionStrings, 0, len(def.Locales))
+	for _, locale := range def.Locales {
+		locales = append(locales, &atproto.LabelDefs_LabelValueDefinitionStrings{
+			Description: locale.Description,
+			Lang:        locale.Lang,
+			Name:        locale.Name,
+		})
+	}
+
+	valueDef := &atproto.LabelDefs_LabelValueDefinition{
+		Blurs:      def.Blurs,
+		Identifier: def.Value,
+		Locales:    locales,
+		Severity:   def.Severity,
+	}
+	if def.AdultOnly {
+		adultOnly := true
+		valueDef.AdultOnly = &adultOnly
+	}
+	if def.DefaultSetting != "" {
+		defaultSetting := def.DefaultSetting
+		valueDef.DefaultSetting = &defaultSetting
+	}
+
+	return valueDef
+}
+
+func (defs *Definitions) LabelerService(createdAt string) *bsky.LabelerService {
+	policies := &bsky.LabelerDefs_LabelerPolicies{
+		LabelValueDefinitions: make([]*atproto.LabelDefs_LabelValueDefinition, 0, len(defs.Labels)),
+		LabelValues:           make([]*string, 0, len(defs.Labels)),
+	}
+
+	for _, def := range defs.Labels {
+		val := def.Value
+		policies.LabelValues = append(policies.LabelValues, &val)
+		policies.LabelValueDefinitions = append(policies.LabelValueDefinitions, def.LabelValueDefinition())
+	}
+
+	return &bsky.LabelerService{
+		LexiconTypeID: "app.bsky.labeler.service",
+		CreatedAt:     createdAt,
+		Policies:      policies,
+	}
+}
@@ -0,0 +1,40 @@
+package labeler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDefinitions(t *testing.T) {
+	defs, err := ParseDefinitions([]byte(`{"labels": [{"value": "birthday", "severity": "inform", "blurs": "none", "defaultSetting": "warn", "adultOnly": false, "locales": [{"lang": "en", "name": "Birthday", "description": "happy birthday"}]}]}`))
+	if err != nil {
+		panic(err)
+	}
+
+	assert.Equal(t, []string{"birthday"}, defs.Values())
+	assert.Nil(t, defs.Validate("birthday"))
+	assert.NotNil(t, defs.Validate("birthday", "banger"))
+
+	service := defs.LabelerService("2024-01-01T00:00:00Z")
+	assert.Equal(t, "birthday", *service.Policies.LabelValues[0])
+	assert.Equal(t, "birthday", service.Policies.LabelValueDefinitions[0].Identifier)
+	assert.Equal(t, "warn", *service.Policies.LabelValueDefinitions[0].DefaultSetting)
+	assert.Nil(t, service.Policies.LabelValueDefinitions[0].AdultOnly)
+}
+
+func TestParseDefinitionsInvalid(t *testing.T) {
+	_, err := ParseDefinitions([]byte(`{"labels": [{"value": "Birthday", "severity": "inform", "blurs": "none", "locales": [{"lang": "en", "name": "Birthday"}]}]}`))
+	assert.NotNil(t, err)
+
+	_, err = ParseDefinitions([]byte(`{"labels": [{"value": "birthday", "severity": "loud", "blurs": "none", "locales": [{"lang": "en", "name": "Birthday"}]}]}`))
+	assert.NotNil(t, err)
+
+	_, err = ParseDefinitions([]byte(`{"labels": [{"value": "birthday", "severity": "inform", "blurs": "none", "locales": []}]}`))
+	assert.NotNil(t, err)
+}
+
+func TestNilDefinitionsAllowEverything(t *testing.T) {
+	var defs *Definitions = nil
+	assert.Nil(t, defs.Validate("anything"))
+}
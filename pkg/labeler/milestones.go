@@ -0,0 +1,107 @@
+package labeler
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/flicknow/go-bluesky-bot/pkg/rules"
+)
+
+// FirstBirthdayYear is the year the oldest accounts turned one, so yearly
+// milestones are checked for every anniversary up to now.
+var FirstBirthdayYear = 2023
+
+// Milestone is a label applied when an account reaches an age, counted from
+// ActorRow.Birthday, and negated again once Duration has passed. Yearly
+// milestones repeat on every anniversary.
+type Milestone struct {
+	Label    string         `json:"label"`
+	Years    int            `json:"years,omitempty"`
+	Days     int            `json:"days,omitempty"`
+	Yearly   bool           `json:"yearly,omitempty"`
+	Duration rules.Duration `json:"duration"`
+}
+
+type Milestones struct {
+	Milestones []*Milestone `json:"milestones"`
+	byLabel    map[string]*Milestone
+}
+
+var DefaultMilestones = []*Milestone{
+	{Label: "birthday", Yearly: true, Duration: rules.Duration{Duration: 24 * time.Hour}},
+}
+
+func NewMilestones(milestones []*Milestone) (*Milestones, error) {
+	ms := &Milestones{Milestones: milestones, byLabel: make(map[string]*Milestone)}
+	for _, m := range milestones {
+		if !LabelValueRegex.MatchString(m.Label) {
+			return nil, fmt.Errorf("milestone label %q must only contain lowercase ascii and '-'", m.Label)
+		}
+		if !m.Yearly && (m.Years == 0) && (m.Days == 0) {
+			return nil, fmt.Errorf("milestone %s needs years, days, or yearly", m.Label)
+		}
+		if m.Duration.Duration <= 0 {
+			return nil, fmt.Errorf("milestone %s needs a positive duration", m.Label)
+		}
+		if ms.byLabel[m.Label] != nil {
+			return nil, fmt.Errorf("milestone %s is defined more than once", m.Label)
+		}
+		ms.byLabel[m.Label] = m
+	}
+
+	return ms, nil
+}
+
+func LoadMilestones(path string) (*Milestones, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading milestones %s: %w", path, err)
+	}
+
+	parsed := &Milestones{}
+	err = json.Unmarshal(b, parsed)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing milestones %s: %w", path, err)
+	}
+
+	return NewMilestones(parsed.Milestones)
+}
+
+func (ms *Milestones) Find(label string) *Milestone {
+	if ms == nil {
+		return nil
+	}
+	return ms.byLabel[label]
+}
+
+// Validate checks every milestone has a label definition, so the labeler
+// declaration describes everything we emit.
+func (ms *Milestones) Validate(defs *Definitions) error {
+	if (ms == nil) || (defs == nil) {
+		return nil
+	}
+
+	for _, m := range ms.Milestones {
+		if defs.Find(m.Label) == nil {
+			return fmt.Errorf("%w: milestone %s has no label definition", ErrUnknownLabel, m.Label)
+		}
+	}
+
+	return nil
+}
+
+// Ages lists the account ages, as years and days, the milestone is reached
+// at as of now.
+func (m *Milestone) Ages(now time.Time) [][2]int {
+	if !m.Yearly {
+		return [][2]int{{m.Years, m.Days}}
+	}
+
+	ages := make([][2]int, 0)
+	for years := now.Year() - FirstBirthdayYear + 1; years > 0; years-- {
+		ages = append(ages, [2]int{years, m.Days})
+	}
+	return ages
+}
@@ -0,0 +1,48 @@
+package labeler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadMilestonesConfig(t *testing.T) {
+	milestones, err := LoadMilestones("../../config/milestones.json")
+	if err != nil {
+		panic(err)
+	}
+
+	defs, err := LoadDefinitions("../../config/labels.json")
+	if err != nil {
+		panic(err)
+	}
+
+	assert.Nil(t, milestones.Validate(defs))
+	assert.Equal(t, 7*24*time.Hour, milestones.Find("bday-one").Duration.Duration)
+	assert.Nil(t, milestones.Find("banger"))
+}
+
+func TestMilestonesInvalid(t *testing.T) {
+	_, err := NewMilestones([]*Milestone{{Label: "bday-1y", Years: 1, Duration: DefaultMilestones[0].Duration}})
+	assert.NotNil(t, err)
+
+	_, err = NewMilestones([]*Milestone{{Label: "bday", Duration: DefaultMilestones[0].Duration}})
+	assert.NotNil(t, err)
+
+	_, err = NewMilestones([]*Milestone{{Label: "bday", Years: 1}})
+	assert.NotNil(t, err)
+
+	milestones, err := NewMilestones([]*Milestone{{Label: "bday", Years: 1, Duration: DefaultMilestones[0].Duration}})
+	if err != nil {
+		panic(err)
+	}
+	assert.ErrorIs(t, milestones.Validate(&Definitions{byValue: map[string]*LabelDefinition{}}), ErrUnknownLabel)
+}
+
+func TestMilestoneAges(t *testing.T) {
+	now := time.Date(FirstBirthdayYear+2, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, [][2]int{{3, 0}, {2, 0}, {1, 0}}, DefaultMilestones[0].Ages(now))
+	assert.Equal(t, [][2]int{{0, 100}}, (&Milestone{Label: "hundred-days", Days: 100}).Ages(now))
+}
@@ -0,0 +1,77 @@
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var Events = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "bluesky_stream_events_total",
+	Help: "Events received from a stream, by stream and event kind.",
+}, []string{"stream", "kind"})
+
+var StreamLag = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "bluesky_stream_lag_seconds",
+	Help: "How far behind now the last event from a stream was created.",
+}, []string{"stream"})
+
+var StreamCursor = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "bluesky_stream_cursor",
+	Help: "The last seq acked for a stream.",
+}, []string{"stream"})
+
+var StreamReconnects = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "bluesky_stream_reconnects_total",
+	Help: "Times a stream was restarted.",
+}, []string{"stream"})
+
+var IndexDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "bluesky_index_duration_seconds",
+	Help:    "Time spent indexing a record, by table and operation.",
+	Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+}, []string{"table", "op"})
+
+var DbLockRetries = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "bluesky_db_lock_retries_total",
+	Help: "Queries retried because the database was locked.",
+})
+
+var FeedDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "bluesky_feed_request_duration_seconds",
+	Help:    "Time spent serving feed requests, by feed.",
+	Buckets: prometheus.DefBuckets,
+}, []string{"feed"})
+
+var FeedCache = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "bluesky_feed_cache_requests_total",
+	Help: "Feed responses by cache result, one of hit, miss, or bypass.",
+}, []string{"result"})
+
+// TimeIndex starts timing an index operation, to be finished with a defer:
+//
+//	defer metrics.TimeIndex("posts", "insert")()
+func TimeIndex(table string, op string) func() {
+	start := time.Now()
+	return func() {
+		IndexDuration.WithLabelValues(table, op).Observe(time.Since(start).Seconds())
+	}
+}
+
+// ObserveLag records how old the latest event from a stream is, given its
+// RFC3339 creation time, and returns the parsed time, or zero if invalid.
+func ObserveLag(stream string, createdAt string) time.Time {
+	t, err := time.Parse(time.RFC3339, createdAt)
+	if err != nil {
+		return time.Time{}
+	}
+	StreamLag.WithLabelValues(stream).Set(time.Since(t).Seconds())
+	return t
+}
+
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
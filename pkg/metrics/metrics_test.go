@@ -0,0 +1,58 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+)
+
+func scrape(t *testing.T) string {
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, 200, w.Code)
+	return w.Body.String()
+}
+
+func TestTimeIndex(t *testing.T) {
+	done := TimeIndex("metrics-test", "insert")
+	done()
+
+	m := &dto.Metric{}
+	err := IndexDuration.WithLabelValues("metrics-test", "insert").(prometheus.Metric).Write(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, uint64(1), m.GetHistogram().GetSampleCount())
+
+	assert.Contains(t, scrape(t), `bluesky_index_duration_seconds_count{op="insert",table="metrics-test"} 1`)
+}
+
+func TestObserveLag(t *testing.T) {
+	createdAt := time.Now().Add(-time.Minute).UTC().Truncate(time.Second)
+	parsed := ObserveLag("metrics-test", createdAt.Format(time.RFC3339))
+	assert.True(t, createdAt.Equal(parsed))
+
+	m := &dto.Metric{}
+	err := StreamLag.WithLabelValues("metrics-test").Write(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.InDelta(t, 60, m.GetGauge().GetValue(), 5)
+
+	assert.True(t, ObserveLag("metrics-test", "not a time").IsZero())
+}
+
+func TestHandler(t *testing.T) {
+	FeedCache.WithLabelValues("hit").Inc()
+	Events.WithLabelValues("metrics-test", "commit").Inc()
+	DbLockRetries.Inc()
+
+	body := scrape(t)
+	assert.Contains(t, body, `bluesky_feed_cache_requests_total{result="hit"}`)
+	assert.Contains(t, body, `bluesky_stream_events_total{kind="commit",stream="metrics-test"} 1`)
+	assert.Contains(t, body, "bluesky_db_lock_retries_total")
+}
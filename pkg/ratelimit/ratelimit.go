@@ -0,0 +1,215 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/flicknow/go-bluesky-bot/pkg/rules"
+	"golang.org/x/time/rate"
+)
+
+// IdleTimeout is how long a client's bucket is kept after its last request.
+// A bucket that has been idle this long has refilled anyway.
+var IdleTimeout = 10 * time.Minute
+
+// Budget allows Requests every Per, with bursts of up to Burst requests,
+// which defaults to Requests.
+type Budget struct {
+	Requests int            `json:"requests"`
+	Per      rules.Duration `json:"per"`
+	Burst    int            `json:"burst,omitempty"`
+}
+
+// Route applies budgets to every path starting with one of its prefixes.
+// Routes with the same name share their buckets.
+type Route struct {
+	Name     string   `json:"name"`
+	Prefixes []string `json:"prefixes"`
+	Ip       *Budget  `json:"ip,omitempty"`
+	Did      *Budget  `json:"did,omitempty"`
+}
+
+type Config struct {
+	TrustForwardedFor bool     `json:"trustForwardedFor,omitempty"`
+	Routes            []*Route `json:"routes"`
+}
+
+type bucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// Limiter is a set of token buckets, one per route and client.
+type Limiter struct {
+	Config   *Config
+	mu       sync.Mutex
+	buckets  map[string]*bucket
+	prunedAt time.Time
+	now      func() time.Time
+}
+
+func (b *Budget) validate() error {
+	if b.Requests <= 0 {
+		return fmt.Errorf("needs a positive number of requests")
+	}
+	if b.Per.Duration <= 0 {
+		return fmt.Errorf("needs a positive period")
+	}
+	if b.Burst < 0 {
+		return fmt.Errorf("has a negative burst")
+	}
+	return nil
+}
+
+func (b *Budget) limit() rate.Limit {
+	return rate.Limit(float64(b.Requests) / b.Per.Seconds())
+}
+
+func (b *Budget) burst() int {
+	if b.Burst == 0 {
+		return b.Requests
+	}
+	return b.Burst
+}
+
+func NewLimiter(config *Config) (*Limiter, error) {
+	for _, route := range config.Routes {
+		if route.Name == "" {
+			return nil, fmt.Errorf("rate limit route %v needs a name", route.Prefixes)
+		}
+		for kind, budget := range map[string]*Budget{"ip": route.Ip, "did": route.Did} {
+			if budget == nil {
+				continue
+			}
+			err := budget.validate()
+			if err != nil {
+				return nil, fmt.Errorf("rate limit route %s %s budget %w", route.Name, kind, err)
+			}
+		}
+	}
+
+	return &Limiter{Config: config, buckets: make(map[string]*bucket), now: time.Now}, nil
+}
+
+func LoadConfig(path string) (*Config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading rate limits %s: %w", path, err)
+	}
+
+	config := &Config{}
+	err = json.Unmarshal(b, config)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing rate limits %s: %w", path, err)
+	}
+
+	return config, nil
+}
+
+// Route finds the route with the longest prefix matching path.
+func (l *Limiter) Route(path string) *Route {
+	var found *Route
+	longest := -1
+	for _, route := range l.Config.Routes {
+		for _, prefix := range route.Prefixes {
+			if strings.HasPrefix(path, prefix) && (len(prefix) > longest) {
+				found = route
+				longest = len(prefix)
+			}
+		}
+	}
+	return found
+}
+
+// AllowIp takes a token from the client ip's bucket for the route, returning
+// how long the client should wait before retrying if there are none left.
+func (l *Limiter) AllowIp(route *Route, ip string) (bool, time.Duration) {
+	if (route == nil) || (route.Ip == nil) || (ip == "") {
+		return true, 0
+	}
+	return l.allow(route.Name+" ip "+ip, route.Ip)
+}
+
+// AllowDid is AllowIp for verified viewers.
+func (l *Limiter) AllowDid(route *Route, did string) (bool, time.Duration) {
+	if (route == nil) || (route.Did == nil) || (did == "") {
+		return true, 0
+	}
+	return l.allow(route.Name+" did "+did, route.Did)
+}
+
+func (l *Limiter) allow(key string, budget *Budget) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if now.Sub(l.prunedAt) > IdleTimeout {
+		for k, b := range l.buckets {
+			if now.Sub(b.lastSeen) > IdleTimeout {
+				delete(l.buckets, k)
+			}
+		}
+		l.prunedAt = now
+	}
+
+	b := l.buckets[key]
+	if b == nil {
+		b = &bucket{limiter: rate.NewLimiter(budget.limit(), budget.burst())}
+		l.buckets[key] = b
+	}
+	b.lastSeen = now
+
+	reservation := b.limiter.ReserveN(now, 1)
+	delay := reservation.DelayFrom(now)
+	if delay == 0 {
+		return true, 0
+	}
+
+	reservation.CancelAt(now)
+	return false, delay
+}
+
+// RetryAfter rounds a delay up to whole seconds for a Retry-After header.
+func RetryAfter(delay time.Duration) string {
+	return fmt.Sprintf("%d", int64(math.Max(1, math.Ceil(delay.Seconds()))))
+}
+
+func DefaultConfig() *Config {
+	second := rules.Duration{Duration: time.Second}
+	minute := rules.Duration{Duration: time.Minute}
+
+	return &Config{
+		Routes: []*Route{
+			{
+				Name:     "default",
+				Prefixes: []string{"/"},
+				Ip:       &Budget{Requests: 20, Per: second, Burst: 100},
+			},
+			// feed requests are proxied by the appview from a handful of
+			// ips, so the ip budgets are generous and only there to stop
+			// anonymous or unverified clients calling us directly
+			{
+				Name:     "feeds",
+				Prefixes: []string{"/xrpc/app.bsky.feed.getFeedSkeleton", "/xrpc/app.bsky.unspecced.getPopular"},
+				Ip:       &Budget{Requests: 500, Per: second, Burst: 2000},
+				Did:      &Budget{Requests: 5, Per: second, Burst: 30},
+			},
+			{
+				Name:     "interactions",
+				Prefixes: []string{"/xrpc/app.bsky.feed.sendInteractions"},
+				Ip:       &Budget{Requests: 200, Per: second, Burst: 1000},
+				Did:      &Budget{Requests: 2, Per: second, Burst: 20},
+			},
+			{
+				Name:     "lookups",
+				Prefixes: []string{"/did/", "/pds/", "/skychat/", "/quotes/"},
+				Ip:       &Budget{Requests: 30, Per: minute, Burst: 10},
+			},
+		},
+	}
+}
@@ -0,0 +1,79 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/flicknow/go-bluesky-bot/pkg/rules"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadConfig(t *testing.T) {
+	config, err := LoadConfig("../../config/rate-limits.json")
+	if err != nil {
+		panic(err)
+	}
+
+	assert.Equal(t, DefaultConfig(), config)
+}
+
+func TestLimiterRoute(t *testing.T) {
+	limiter, err := NewLimiter(DefaultConfig())
+	if err != nil {
+		panic(err)
+	}
+
+	assert.Equal(t, "feeds", limiter.Route("/xrpc/app.bsky.feed.getFeedSkeleton").Name)
+	assert.Equal(t, "lookups", limiter.Route("/pds/alice.bsky.social").Name)
+	assert.Equal(t, "default", limiter.Route("/xrpc/com.atproto.label.queryLabels").Name)
+}
+
+func TestLimiterAllow(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	limiter, err := NewLimiter(&Config{
+		Routes: []*Route{
+			{
+				Name:     "feeds",
+				Prefixes: []string{"/xrpc/"},
+				Ip:       &Budget{Requests: 2, Per: rules.Duration{Duration: time.Second}},
+				Did:      &Budget{Requests: 1, Per: rules.Duration{Duration: time.Minute}},
+			},
+		},
+	})
+	if err != nil {
+		panic(err)
+	}
+	limiter.now = func() time.Time { return now }
+
+	route := limiter.Route("/xrpc/app.bsky.feed.getFeedSkeleton")
+	for i := 0; i < 2; i++ {
+		ok, _ := limiter.AllowIp(route, "10.0.0.1")
+		assert.True(t, ok)
+	}
+	ok, delay := limiter.AllowIp(route, "10.0.0.1")
+	assert.False(t, ok)
+	assert.Equal(t, 500*time.Millisecond, delay)
+
+	ok, _ = limiter.AllowIp(route, "10.0.0.2")
+	assert.True(t, ok)
+
+	now = now.Add(500 * time.Millisecond)
+	ok, _ = limiter.AllowIp(route, "10.0.0.1")
+	assert.True(t, ok)
+
+	ok, _ = limiter.AllowDid(route, "did:plc:a")
+	assert.True(t, ok)
+	ok, delay = limiter.AllowDid(route, "did:plc:a")
+	assert.False(t, ok)
+	assert.Equal(t, "60", RetryAfter(delay))
+
+	ok, _ = limiter.AllowDid(route, "")
+	assert.True(t, ok)
+	ok, _ = limiter.AllowIp(limiter.Route("/pds/"), "10.0.0.1")
+	assert.True(t, ok)
+}
+
+func TestNewLimiterValidates(t *testing.T) {
+	_, err := NewLimiter(&Config{Routes: []*Route{{Name: "feeds", Prefixes: []string{"/"}, Ip: &Budget{Requests: 1}}}})
+	assert.ErrorContains(t, err, "rate limit route feeds ip budget needs a positive period")
+}
@@ -0,0 +1,53 @@
+package rules
+
+import (
+	"sync/atomic"
+)
+
+type Engine struct {
+	path    string
+	ruleset atomic.Pointer[RuleSet]
+}
+
+func NewEngine(path string, defaults *RuleSet) (*Engine, error) {
+	e := &Engine{path: path}
+	if path == "" {
+		e.ruleset.Store(defaults)
+		return e, nil
+	}
+
+	err := e.Reload()
+	if err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+func (e *Engine) Path() string {
+	return e.path
+}
+
+// Reload swaps in the rules from disk, keeping the current rules if the
+// file can't be loaded.
+func (e *Engine) Reload() error {
+	if e.path == "" {
+		return nil
+	}
+
+	ruleset, err := Load(e.path)
+	if err != nil {
+		return err
+	}
+
+	e.ruleset.Store(ruleset)
+	return nil
+}
+
+func (e *Engine) RuleSet() *RuleSet {
+	return e.ruleset.Load()
+}
+
+func (e *Engine) Evaluate(s *Subject) *Result {
+	return e.RuleSet().Evaluate(s)
+}
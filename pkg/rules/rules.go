@@ -0,0 +1,554 @@
+package rules
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bluesky-social/indigo/api/bsky"
+	"golang.org/x/text/unicode/norm"
+)
+
+const LangTemplate = "{lang}"
+const SelfLabelsTemplate = "{self}"
+
+type Duration struct {
+	time.Duration
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	day := 24 * time.Hour
+	if (d.Duration != 0) && (d.Duration%day == 0) {
+		return json.Marshal(fmt.Sprintf("%dd", d.Duration/day))
+	}
+	return json.Marshal(d.String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	err := json.Unmarshal(b, &s)
+	if err != nil {
+		return err
+	}
+
+	d.Duration, err = ParseDuration(s)
+	return err
+}
+
+func ParseDuration(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.ParseInt(s[:len(s)-1], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("could not parse duration %s: %w", s, err)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+
+	return time.ParseDuration(s)
+}
+
+type ActorCondition struct {
+	Initialized       *bool     `json:"initialized,omitempty"`
+	MinPosts          *int64    `json:"minPosts,omitempty"`
+	MaxPosts          *int64    `json:"maxPosts,omitempty"`
+	LastPostOlderThan *Duration `json:"lastPostOlderThan,omitempty"`
+	LastPostNewerThan *Duration `json:"lastPostNewerThan,omitempty"`
+}
+
+type Condition struct {
+	Text             []string        `json:"text,omitempty"`
+	Langs            []string        `json:"langs,omitempty"`
+	Links            []string        `json:"links,omitempty"`
+	LinksNotMatching []string        `json:"linksNotMatching,omitempty"`
+	Tags             []string        `json:"tags,omitempty"`
+	Mentions         []string        `json:"mentions,omitempty"`
+	Reply            *bool           `json:"reply,omitempty"`
+	Quote            *bool           `json:"quote,omitempty"`
+	Authors          []string        `json:"authors,omitempty"`
+	AuthorsFile      string          `json:"authorsFile,omitempty"`
+	Actor            *ActorCondition `json:"actor,omitempty"`
+	All              []*Condition    `json:"all,omitempty"`
+	Any              []*Condition    `json:"any,omitempty"`
+	Not              *Condition      `json:"not,omitempty"`
+
+	text             []*regexp.Regexp
+	links            []*regexp.Regexp
+	linksNotMatching []*regexp.Regexp
+	authors          map[string]bool
+	mentions         map[string]bool
+}
+
+type Rule struct {
+	Name          string     `json:"name"`
+	Labels        []string   `json:"labels,omitempty"`
+	AccountLabels []string   `json:"accountLabels,omitempty"`
+	Match         *Condition `json:"match,omitempty"`
+}
+
+type RuleSet struct {
+	Rules []*Rule `json:"rules"`
+}
+
+type ActorStats struct {
+	Initialized bool
+	Posts       int64
+	LastPost    int64
+}
+
+type Subject struct {
+	Author string
+	Post   *bsky.FeedPost
+	Quote  string
+	Actor  *ActorStats
+	Now    int64
+}
+
+type Result struct {
+	Rules         []string `json:"rules"`
+	Labels        []string `json:"labels"`
+	AccountLabels []string `json:"accountLabels"`
+}
+
+func Load(path string) (*RuleSet, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading rules %s: %w", path, err)
+	}
+
+	ruleset := &RuleSet{}
+	err = json.Unmarshal(b, ruleset)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing rules %s: %w", path, err)
+	}
+
+	err = ruleset.Compile(filepath.Dir(path))
+	if err != nil {
+		return nil, fmt.Errorf("error compiling rules %s: %w", path, err)
+	}
+
+	return ruleset, nil
+}
+
+func (r *RuleSet) Compile(dir string) error {
+	seen := make(map[string]bool)
+	for _, rule := range r.Rules {
+		if rule.Name == "" {
+			return fmt.Errorf("rule is missing a name")
+		}
+		if seen[rule.Name] {
+			return fmt.Errorf("rule %s is defined more than once", rule.Name)
+		}
+		seen[rule.Name] = true
+
+		if (len(rule.Labels) == 0) && (len(rule.AccountLabels) == 0) {
+			return fmt.Errorf("rule %s does not emit any labels", rule.Name)
+		}
+
+		if rule.Match == nil {
+			continue
+		}
+
+		err := rule.Match.compile(dir)
+		if err != nil {
+			return fmt.Errorf("rule %s: %w", rule.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func compileRegexes(patterns []string) ([]*regexp.Regexp, error) {
+	regexes := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(norm.NFC.String(pattern))
+		if err != nil {
+			return nil, err
+		}
+		regexes = append(regexes, re)
+	}
+	return regexes, nil
+}
+
+func readDids(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	dids := make([]string, 0)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if (line == "") || (line[0] == '#') {
+			continue
+		}
+		dids = append(dids, line)
+	}
+
+	return dids, scanner.Err()
+}
+
+func (c *Condition) compile(dir string) error {
+	var err error
+
+	c.text, err = compileRegexes(c.Text)
+	if err != nil {
+		return err
+	}
+
+	c.links, err = compileRegexes(c.Links)
+	if err != nil {
+		return err
+	}
+
+	c.linksNotMatching, err = compileRegexes(c.LinksNotMatching)
+	if err != nil {
+		return err
+	}
+
+	authors := c.Authors
+	if c.AuthorsFile != "" {
+		path := c.AuthorsFile
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+
+		dids, err := readDids(path)
+		if err != nil {
+			return fmt.Errorf("error reading authors file %s: %w", path, err)
+		}
+		authors = append(authors, dids...)
+	}
+	if (len(authors) > 0) || (c.AuthorsFile != "") {
+		c.authors = make(map[string]bool)
+		for _, did := range authors {
+			c.authors[did] = true
+		}
+	}
+
+	if len(c.Mentions) > 0 {
+		c.mentions = make(map[string]bool)
+		for _, did := range c.Mentions {
+			c.mentions[did] = true
+		}
+	}
+
+	for _, sub := range c.All {
+		err := sub.compile(dir)
+		if err != nil {
+			return err
+		}
+	}
+	for _, sub := range c.Any {
+		err := sub.compile(dir)
+		if err != nil {
+			return err
+		}
+	}
+	if c.Not != nil {
+		err := c.Not.compile(dir)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Subject) IsReply() bool {
+	reply := s.Post.Reply
+	return (reply != nil) && (reply.Parent != nil)
+}
+
+func (s *Subject) features() []*bsky.RichtextFacet_Features_Elem {
+	features := make([]*bsky.RichtextFacet_Features_Elem, 0)
+	for _, facet := range s.Post.Facets {
+		if facet == nil {
+			continue
+		}
+		for _, feature := range facet.Features {
+			if feature != nil {
+				features = append(features, feature)
+			}
+		}
+	}
+	return features
+}
+
+func (s *Subject) Links() []string {
+	links := make([]string, 0)
+	for _, feature := range s.features() {
+		if feature.RichtextFacet_Link != nil {
+			links = append(links, feature.RichtextFacet_Link.Uri)
+		}
+	}
+	return links
+}
+
+func (s *Subject) Tags() []string {
+	tags := make([]string, 0, len(s.Post.Tags))
+	for _, tag := range s.Post.Tags {
+		tags = append(tags, strings.ToLower(tag))
+	}
+	for _, feature := range s.features() {
+		if feature.RichtextFacet_Tag != nil {
+			tags = append(tags, strings.ToLower(feature.RichtextFacet_Tag.Tag))
+		}
+	}
+	return tags
+}
+
+func (s *Subject) Mentions() []string {
+	mentions := make([]string, 0)
+	for _, feature := range s.features() {
+		if feature.RichtextFacet_Mention != nil {
+			mentions = append(mentions, feature.RichtextFacet_Mention.Did)
+		}
+	}
+	return mentions
+}
+
+func (s *Subject) SelfLabels() []string {
+	labels := make([]string, 0)
+
+	selfLabels := s.Post.Labels
+	if (selfLabels == nil) || (selfLabels.LabelDefs_SelfLabels == nil) || (selfLabels.LabelDefs_SelfLabels.Values == nil) {
+		return labels
+	}
+
+	for _, value := range selfLabels.LabelDefs_SelfLabels.Values {
+		if (value != nil) && (value.Val != "") {
+			labels = append(labels, value.Val)
+		}
+	}
+
+	return labels
+}
+
+func matchesAny(regexes []*regexp.Regexp, s string) bool {
+	for _, re := range regexes {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesLang(langs []string, postLangs []string) bool {
+	for _, postLang := range postLangs {
+		postLang = strings.ToLower(postLang)
+		for _, lang := range langs {
+			lang = strings.ToLower(lang)
+			if (postLang == lang) || strings.HasPrefix(postLang, lang+"-") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (c *ActorCondition) matches(s *Subject) bool {
+	actor := s.Actor
+	if actor == nil {
+		actor = &ActorStats{}
+	}
+
+	if (c.Initialized != nil) && (*c.Initialized != actor.Initialized) {
+		return false
+	}
+	if (c.MinPosts != nil) && (actor.Posts < *c.MinPosts) {
+		return false
+	}
+	if (c.MaxPosts != nil) && (actor.Posts > *c.MaxPosts) {
+		return false
+	}
+	if c.LastPostOlderThan != nil {
+		if actor.LastPost <= 0 {
+			return false
+		}
+		if actor.LastPost > (s.Now - int64(c.LastPostOlderThan.Seconds())) {
+			return false
+		}
+	}
+	if c.LastPostNewerThan != nil {
+		if actor.LastPost <= 0 {
+			return false
+		}
+		if actor.LastPost < (s.Now - int64(c.LastPostNewerThan.Seconds())) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (c *Condition) Matches(s *Subject) bool {
+	if c == nil {
+		return true
+	}
+
+	if len(c.text) > 0 {
+		if !matchesAny(c.text, norm.NFC.String(s.Post.Text)) {
+			return false
+		}
+	}
+
+	if (len(c.Langs) > 0) && !matchesLang(c.Langs, s.Post.Langs) {
+		return false
+	}
+
+	if (len(c.links) > 0) || (len(c.linksNotMatching) > 0) {
+		found := false
+		for _, link := range s.Links() {
+			if (len(c.links) > 0) && matchesAny(c.links, link) {
+				found = true
+				break
+			}
+			if (len(c.linksNotMatching) > 0) && !matchesAny(c.linksNotMatching, link) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if len(c.Tags) > 0 {
+		found := false
+		tags := s.Tags()
+	TAGS:
+		for _, want := range c.Tags {
+			want = strings.ToLower(strings.TrimPrefix(want, "#"))
+			for _, tag := range tags {
+				if tag == want {
+					found = true
+					break TAGS
+				}
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if c.mentions != nil {
+		found := false
+		for _, did := range s.Mentions() {
+			if c.mentions[did] {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if (c.Reply != nil) && (*c.Reply != s.IsReply()) {
+		return false
+	}
+
+	if (c.Quote != nil) && (*c.Quote != (s.Quote != "")) {
+		return false
+	}
+
+	if (c.authors != nil) && !c.authors[s.Author] {
+		return false
+	}
+
+	if (c.Actor != nil) && !c.Actor.matches(s) {
+		return false
+	}
+
+	for _, sub := range c.All {
+		if !sub.Matches(s) {
+			return false
+		}
+	}
+
+	if len(c.Any) > 0 {
+		found := false
+		for _, sub := range c.Any {
+			if sub.Matches(s) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if (c.Not != nil) && c.Not.Matches(s) {
+		return false
+	}
+
+	return true
+}
+
+func expandLabels(templates []string, s *Subject) []string {
+	labels := make([]string, 0, len(templates))
+	for _, template := range templates {
+		if template == SelfLabelsTemplate {
+			labels = append(labels, s.SelfLabels()...)
+		} else if strings.Contains(template, LangTemplate) {
+			for _, lang := range s.Post.Langs {
+				labels = append(labels, strings.ReplaceAll(template, LangTemplate, lang))
+			}
+		} else {
+			labels = append(labels, template)
+		}
+	}
+	return labels
+}
+
+func (r *RuleSet) Evaluate(s *Subject) *Result {
+	result := &Result{
+		Rules:         []string{},
+		Labels:        []string{},
+		AccountLabels: []string{},
+	}
+	if (r == nil) || (s.Post == nil) {
+		return result
+	}
+
+	seen := make(map[string]bool)
+	seenAccount := make(map[string]bool)
+	for _, rule := range r.Rules {
+		if !rule.Match.Matches(s) {
+			continue
+		}
+
+		result.Rules = append(result.Rules, rule.Name)
+		for _, label := range expandLabels(rule.Labels, s) {
+			if !seen[label] {
+				seen[label] = true
+				result.Labels = append(result.Labels, label)
+			}
+		}
+		for _, label := range expandLabels(rule.AccountLabels, s) {
+			if !seenAccount[label] {
+				seenAccount[label] = true
+				result.AccountLabels = append(result.AccountLabels, label)
+			}
+		}
+	}
+
+	return result
+}
+
+func Bool(b bool) *bool {
+	return &b
+}
+
+func Int64(i int64) *int64 {
+	return &i
+}
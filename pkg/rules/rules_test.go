@@ -0,0 +1,147 @@
+package rules
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/api/bsky"
+	"github.com/stretchr/testify/assert"
+)
+
+func mustParse(t *testing.T, text string) *RuleSet {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "rules.json")
+	err := os.WriteFile(path, []byte(text), 0644)
+	if err != nil {
+		panic(err)
+	}
+
+	ruleset, err := Load(path)
+	if err != nil {
+		panic(err)
+	}
+	return ruleset
+}
+
+func TestEvaluateText(t *testing.T) {
+	ruleset := mustParse(t, `{"rules": [{"name": "cafe", "labels": ["cafe", "cafe-{lang}"], "match": {"text": ["(?i)\\bcafé"], "reply": false}}]}`)
+
+	// decomposed é should match the precomposed pattern
+	post := &bsky.FeedPost{Text: "a nice cafe\u0301 today", Langs: []string{"en", "fr"}}
+	result := ruleset.Evaluate(&Subject{Post: post})
+	assert.Equal(t, []string{"cafe"}, result.Rules)
+	assert.Equal(t, []string{"cafe", "cafe-en", "cafe-fr"}, result.Labels)
+
+	post.Reply = &bsky.FeedPost_ReplyRef{Parent: nil}
+	assert.Equal(t, []string{"cafe"}, ruleset.Evaluate(&Subject{Post: post}).Rules)
+
+	post.Reply = &bsky.FeedPost_ReplyRef{Parent: &atproto.RepoStrongRef{Uri: "at://did:plc:foo/app.bsky.feed.post/1"}}
+	assert.Empty(t, ruleset.Evaluate(&Subject{Post: post}).Rules)
+}
+
+func TestEvaluateFacetsAndAuthors(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "authors.txt"), []byte("# authors\ndid:plc:bar\n"), 0644)
+	if err != nil {
+		panic(err)
+	}
+	path := filepath.Join(dir, "rules.json")
+	err = os.WriteFile(path, []byte(`{"rules": [
+		{"name": "art", "labels": ["art"], "accountLabels": ["artist"], "match": {"tags": ["#Art"], "authors": ["did:plc:foo"], "authorsFile": "authors.txt"}},
+		{"name": "langs", "labels": ["pt"], "match": {"langs": ["pt"]}},
+		{"name": "not-bsky", "labels": ["external"], "match": {"linksNotMatching": ["/bsky\\.app/"]}}
+	]}`), 0644)
+	if err != nil {
+		panic(err)
+	}
+
+	ruleset, err := Load(path)
+	if err != nil {
+		panic(err)
+	}
+
+	post := &bsky.FeedPost{
+		Text:  "look",
+		Langs: []string{"pt-BR"},
+		Facets: []*bsky.RichtextFacet{
+			{Features: []*bsky.RichtextFacet_Features_Elem{
+				{RichtextFacet_Tag: &bsky.RichtextFacet_Tag{Tag: "art"}},
+				{RichtextFacet_Link: &bsky.RichtextFacet_Link{Uri: "https://bsky.app/profile/foo"}},
+			}},
+		},
+	}
+
+	result := ruleset.Evaluate(&Subject{Author: "did:plc:bar", Post: post})
+	assert.Equal(t, []string{"art", "langs"}, result.Rules)
+	assert.Equal(t, []string{"artist"}, result.AccountLabels)
+
+	result = ruleset.Evaluate(&Subject{Author: "did:plc:baz", Post: post})
+	assert.Equal(t, []string{"langs"}, result.Rules)
+
+	post.Facets[0].Features[1].RichtextFacet_Link.Uri = "https://example.com/"
+	result = ruleset.Evaluate(&Subject{Author: "did:plc:baz", Post: post})
+	assert.Equal(t, []string{"langs", "not-bsky"}, result.Rules)
+}
+
+func TestEvaluateActor(t *testing.T) {
+	ruleset := mustParse(t, `{"rules": [
+		{"name": "newskie", "labels": ["newskie"], "match": {"actor": {"initialized": true, "maxPosts": 0}}},
+		{"name": "renewskie", "labels": ["renewskie"], "match": {"actor": {"initialized": true, "lastPostOlderThan": "14d"}}}
+	]}`)
+
+	now := int64(100 * 24 * 60 * 60)
+	post := &bsky.FeedPost{Text: "hello"}
+
+	result := ruleset.Evaluate(&Subject{Post: post, Now: now, Actor: &ActorStats{Initialized: true}})
+	assert.Equal(t, []string{"newskie"}, result.Labels)
+
+	result = ruleset.Evaluate(&Subject{Post: post, Now: now, Actor: &ActorStats{Initialized: false}})
+	assert.Empty(t, result.Labels)
+
+	result = ruleset.Evaluate(&Subject{Post: post, Now: now, Actor: &ActorStats{Initialized: true, Posts: 3, LastPost: now - (15 * 24 * 60 * 60)}})
+	assert.Equal(t, []string{"renewskie"}, result.Labels)
+
+	result = ruleset.Evaluate(&Subject{Post: post, Now: now, Actor: &ActorStats{Initialized: true, Posts: 3, LastPost: now - 60}})
+	assert.Empty(t, result.Labels)
+}
+
+func TestCompileErrors(t *testing.T) {
+	ruleset := &RuleSet{Rules: []*Rule{{Name: "bad", Labels: []string{"bad"}, Match: &Condition{Text: []string{"("}}}}}
+	assert.NotNil(t, ruleset.Compile(""))
+
+	ruleset = &RuleSet{Rules: []*Rule{{Name: "empty"}}}
+	assert.NotNil(t, ruleset.Compile(""))
+
+	ruleset = &RuleSet{Rules: []*Rule{{Name: "dup", Labels: []string{"a"}}, {Name: "dup", Labels: []string{"b"}}}}
+	assert.NotNil(t, ruleset.Compile(""))
+}
+
+func TestEngineReloadKeepsRulesOnError(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "rules.json")
+	err := os.WriteFile(path, []byte(`{"rules": [{"name": "a", "labels": ["a"]}]}`), 0644)
+	if err != nil {
+		panic(err)
+	}
+
+	engine, err := NewEngine(path, nil)
+	if err != nil {
+		panic(err)
+	}
+
+	err = os.WriteFile(path, []byte(`{"rules": [`), 0644)
+	if err != nil {
+		panic(err)
+	}
+	assert.NotNil(t, engine.Reload())
+	assert.Equal(t, []string{"a"}, engine.Evaluate(&Subject{Post: &bsky.FeedPost{}}).Labels)
+
+	err = os.WriteFile(path, []byte(`{"rules": [{"name": "b", "labels": ["b"]}]}`), 0644)
+	if err != nil {
+		panic(err)
+	}
+	assert.Nil(t, engine.Reload())
+	assert.Equal(t, []string{"b"}, engine.Evaluate(&Subject{Post: &bsky.FeedPost{}}).Labels)
+}